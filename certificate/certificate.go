@@ -0,0 +1,323 @@
+// Package certificate obtains and renews certificates for duckdns domains with ACME DNS-01.
+package certificate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/dns01"
+	"github.com/ebrianne/duckdns-go/duckdns"
+)
+
+const (
+	// LetsEncryptURL is the production directory of Let's Encrypt
+	LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+	accountKeyFile = "account.key"
+	privateKeyFile = "privkey.pem"
+	chainFile      = "fullchain.pem"
+)
+
+// Config is the certificate configuration.
+type Config struct {
+	DirectoryURL string
+	Email        string
+	// Domains are the duckdns domains, with or without the duckdns.org suffix
+	Domains []string
+	// Wildcard also requests *.<domain> for every domain
+	Wildcard bool
+	// Dir is where the account key, the private key and the certificate chain are written
+	Dir string
+	// RenewBefore is how long before the expiry the certificate is renewed
+	RenewBefore time.Duration
+	// ReloadCommand is run after each new certificate (optional)
+	ReloadCommand string
+}
+
+// Manager obtains the certificate of the configured domains and renews it before expiry.
+type Manager struct {
+	Config *Config
+	Solver *dns01.Solver
+
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewManager returns a manager solving the challenges with solver.
+func NewManager(httpClient *http.Client, config *Config, solver *dns01.Solver) *Manager {
+	return &Manager{Config: config, Solver: solver, httpClient: httpClient, now: time.Now}
+}
+
+// Identifiers returns the names requested in the certificate.
+func (m *Manager) Identifiers() []string {
+	var ids []string
+	for _, domain := range m.Config.Domains {
+		ids = append(ids, duckdns.FQDN(domain))
+		if m.Config.Wildcard {
+			ids = append(ids, "*."+duckdns.FQDN(domain))
+		}
+	}
+	return ids
+}
+
+// NeedsRenewal checks if the certificate is missing, does not cover every identifier or expires within RenewBefore.
+func (m *Manager) NeedsRenewal() (bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(m.Config.Dir, chainFile))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return true, nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true, nil
+	}
+
+	names := make(map[string]bool, len(cert.DNSNames))
+	for _, name := range cert.DNSNames {
+		names[name] = true
+	}
+	for _, id := range m.Identifiers() {
+		if !names[id] {
+			klog.Infof("Certificate does not cover %v", id)
+			return true, nil
+		}
+	}
+	return m.now().Add(m.Config.RenewBefore).After(cert.NotAfter), nil
+}
+
+// Renew obtains a new certificate when NeedsRenewal and runs the reload command.
+func (m *Manager) Renew(ctx context.Context) error {
+	renew, err := m.NeedsRenewal()
+	if err != nil {
+		return err
+	}
+	if !renew {
+		klog.Infof("Certificate of %v is up to date", strings.Join(m.Identifiers(), ", "))
+		return nil
+	}
+
+	if err := m.Obtain(ctx); err != nil {
+		return err
+	}
+	return m.reload(ctx)
+}
+
+// Obtain requests a new certificate and writes it with its private key to Dir.
+func (m *Manager) Obtain(ctx context.Context) error {
+	if err := os.MkdirAll(m.Config.Dir, 0700); err != nil {
+		return err
+	}
+
+	accountKey, err := loadOrCreateKey(filepath.Join(m.Config.Dir, accountKeyFile))
+	if err != nil {
+		return fmt.Errorf("Unable to load the account key, %v", err)
+	}
+	client := &acme.Client{
+		Key:          accountKey,
+		DirectoryURL: m.Config.DirectoryURL,
+		HTTPClient:   m.httpClient,
+		UserAgent:    "duckdns-go/" + duckdns.Version,
+	}
+
+	account := &acme.Account{}
+	if m.Config.Email != "" {
+		account.Contact = []string{"mailto:" + m.Config.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return fmt.Errorf("Unable to register the ACME account, %v", err)
+	}
+
+	ids := m.Identifiers()
+	klog.Infof("Requesting a certificate for %v", strings.Join(ids, ", "))
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(ids...))
+	if err != nil {
+		return fmt.Errorf("Unable to create the order, %v", err)
+	}
+
+	thumbprint, err := acme.JWKThumbprint(accountKey.Public())
+	if err != nil {
+		return err
+	}
+	for _, url := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, url, thumbprint); err != nil {
+			return err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("Order is not ready, %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: ids[0]},
+		DNSNames: ids,
+	}, key)
+	if err != nil {
+		return err
+	}
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("Unable to finalize the order, %v", err)
+	}
+
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+	var chain []byte
+	for _, b := range der {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})...)
+	}
+	// the key and the chain are replaced together so that they always match
+	if err := writeFiles(
+		file{path: filepath.Join(m.Config.Dir, privateKeyFile), data: keyPEM, perm: 0600},
+		file{path: filepath.Join(m.Config.Dir, chainFile), data: chain, perm: 0644},
+	); err != nil {
+		return err
+	}
+
+	klog.Infof("Certificate written to %v", m.Config.Dir)
+	return nil
+}
+
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, url, thumbprint string) error {
+	z, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	}
+	if z.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range z.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("No dns-01 challenge offered for %v", z.Identifier.Value)
+	}
+
+	keyAuth := chal.Token + "." + thumbprint
+	if err := m.Solver.PresentContext(ctx, z.Identifier.Value, keyAuth); err != nil {
+		return err
+	}
+	defer func() {
+		if err := m.Solver.CleanUpContext(ctx, z.Identifier.Value, keyAuth); err != nil {
+			klog.Error(err)
+		}
+	}()
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("Unable to accept the challenge of %v, %v", z.Identifier.Value, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, z.URI); err != nil {
+		return fmt.Errorf("Authorization of %v failed, %v", z.Identifier.Value, err)
+	}
+	return nil
+}
+
+func (m *Manager) reload(ctx context.Context) error {
+	args := strings.Fields(m.Config.ReloadCommand)
+	if len(args) == 0 {
+		return nil
+	}
+
+	klog.Infof("Running reload command %v", m.Config.ReloadCommand)
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Reload command failed, %v: %s", err, out)
+	}
+	return nil
+}
+
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		data, err := encodeKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return key, writeFiles(file{path: path, data: data, perm: 0600})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data in " + path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// file is a file to write
+type file struct {
+	path string
+	data []byte
+	perm os.FileMode
+}
+
+// writeFiles writes every file to a temporary file first and only renames them once all
+// were written, so that readers never see a partial file and a failed write keeps the
+// previous files
+func writeFiles(files ...file) error {
+	for i, f := range files {
+		if err := ioutil.WriteFile(f.path+".tmp", f.data, f.perm); err != nil {
+			for _, written := range files[:i+1] {
+				os.Remove(written.path + ".tmp")
+			}
+			return err
+		}
+	}
+	for _, f := range files {
+		if err := os.Rename(f.path+".tmp", f.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/ebrianne/duckdns-go/dns01"
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/duckdnstest"
+)
+
+func writeTestCertificate(t *testing.T, dir string, names []string, notAfter time.Time) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     names,
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}, &x509.Certificate{SerialNumber: big.NewInt(1)}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(dir, chainFile), data, 0644); err != nil {
+		t.Fatalf("Unable to write certificate: %v", err)
+	}
+}
+
+func testManager(t *testing.T) *Manager {
+	dir, err := ioutil.TempDir("", "certificate")
+	if err != nil {
+		t.Fatalf("Unable to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	m := NewManager(http.DefaultClient, &Config{
+		Domains:     []string{"example", "other.duckdns.org"},
+		Wildcard:    true,
+		Dir:         dir,
+		RenewBefore: 30 * 24 * time.Hour,
+	}, nil)
+	m.now = func() time.Time { return time.Date(2021, 1, 13, 0, 0, 0, 0, time.UTC) }
+	return m
+}
+
+func TestIdentifiers(t *testing.T) {
+	m := testManager(t)
+	want := []string{"example.duckdns.org", "*.example.duckdns.org", "other.duckdns.org", "*.other.duckdns.org"}
+	if got := m.Identifiers(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Identifiers() expected %v, got %v", want, got)
+	}
+}
+
+func TestNeedsRenewal(t *testing.T) {
+	m := testManager(t)
+
+	if renew, err := m.NeedsRenewal(); err != nil || !renew {
+		t.Errorf("NeedsRenewal() expected true without certificate, got %v, %v", renew, err)
+	}
+
+	writeTestCertificate(t, m.Config.Dir, m.Identifiers(), m.now().Add(60*24*time.Hour))
+	if renew, err := m.NeedsRenewal(); err != nil || renew {
+		t.Errorf("NeedsRenewal() expected false for a fresh certificate, got %v, %v", renew, err)
+	}
+
+	writeTestCertificate(t, m.Config.Dir, m.Identifiers(), m.now().Add(10*24*time.Hour))
+	if renew, err := m.NeedsRenewal(); err != nil || !renew {
+		t.Errorf("NeedsRenewal() expected true for an expiring certificate, got %v, %v", renew, err)
+	}
+
+	writeTestCertificate(t, m.Config.Dir, []string{"example.duckdns.org"}, m.now().Add(60*24*time.Hour))
+	if renew, err := m.NeedsRenewal(); err != nil || !renew {
+		t.Errorf("NeedsRenewal() expected true when a domain is missing, got %v, %v", renew, err)
+	}
+}
+
+func TestRenewUpToDate(t *testing.T) {
+	m := testManager(t)
+	m.Config.ReloadCommand = "false"
+	writeTestCertificate(t, m.Config.Dir, m.Identifiers(), m.now().Add(60*24*time.Hour))
+
+	// neither the ACME server nor the reload command are used
+	if err := m.Renew(context.Background()); err != nil {
+		t.Errorf("Renew() returned error: %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	m := testManager(t)
+	marker := filepath.Join(m.Config.Dir, "reloaded")
+	m.Config.ReloadCommand = "touch " + marker
+
+	if err := m.reload(context.Background()); err != nil {
+		t.Fatalf("reload() returned error: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("reload() expected to run the command: %v", err)
+	}
+
+	m.Config.ReloadCommand = "false"
+	if err := m.reload(context.Background()); err == nil {
+		t.Errorf("reload() expected to return the command error")
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	m := testManager(t)
+	path := filepath.Join(m.Config.Dir, accountKeyFile)
+
+	created, err := loadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("loadOrCreateKey() returned error: %v", err)
+	}
+	loaded, err := loadOrCreateKey(path)
+	if err != nil {
+		t.Fatalf("loadOrCreateKey() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(created.Public(), loaded.Public()) {
+		t.Errorf("loadOrCreateKey() expected to reuse the stored key")
+	}
+
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Account key expected to be private, got %v", info.Mode())
+	}
+}
+
+// fakeACME is a minimal RFC 8555 directory, it validates the DNS-01 challenges against the
+// TXT records of a duckdnstest server and issues the certificates with a test CA
+type fakeACME struct {
+	*httptest.Server
+	duckdns    *duckdnstest.Server
+	thumbprint string
+	caKey      *ecdsa.PrivateKey
+
+	mu    sync.Mutex
+	authz []*fakeAuthz
+	chain []byte
+}
+
+type fakeAuthz struct {
+	domain, token, status string
+	wildcard              bool
+}
+
+func newFakeACME(t *testing.T, d *duckdnstest.Server, thumbprint string) *fakeACME {
+	a := &fakeACME{duckdns: d, thumbprint: thumbprint}
+	a.caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.Server = httptest.NewServer(http.HandlerFunc(a.serve))
+	t.Cleanup(a.Close)
+	return a
+}
+
+func (a *fakeACME) serve(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	w.Header().Set("Replay-Nonce", strconv.FormatInt(time.Now().UnixNano(), 36))
+
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	json.NewDecoder(r.Body).Decode(&jws)
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch path[0] {
+	case "dir":
+		a.reply(w, http.StatusOK, map[string]string{"newNonce": a.URL + "/nonce", "newAccount": a.URL + "/account", "newOrder": a.URL + "/order"})
+	case "nonce":
+		w.WriteHeader(http.StatusOK)
+	case "account":
+		w.Header().Set("Location", a.URL+"/account/1")
+		a.reply(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case "order":
+		w.Header().Set("Location", a.URL+"/order/1")
+		if len(path) == 1 {
+			var order struct{ Identifiers []acme.AuthzID }
+			json.Unmarshal(payload, &order)
+			a.authz, a.chain = nil, nil
+			for i, id := range order.Identifiers {
+				a.authz = append(a.authz, &fakeAuthz{domain: strings.TrimPrefix(id.Value, "*."), wildcard: strings.HasPrefix(id.Value, "*."), token: fmt.Sprintf("token%d", i), status: "pending"})
+			}
+			a.reply(w, http.StatusCreated, a.order())
+			return
+		}
+		a.reply(w, http.StatusOK, a.order())
+	case "authz":
+		a.reply(w, http.StatusOK, a.authorization(path[1]))
+	case "chal":
+		z := a.authz[index(path[1])]
+		sub, _ := duckdns.Subdomain(z.domain)
+		z.status = "invalid"
+		if record := a.duckdns.Record(sub); record != nil && record.TXT == dns01.ChallengeValue(z.token+"."+a.thumbprint) {
+			z.status = "valid"
+		}
+		a.reply(w, http.StatusOK, a.authorization(path[1])["challenges"].([]map[string]string)[0])
+	case "finalize":
+		var finalize struct{ CSR string }
+		json.Unmarshal(payload, &finalize)
+		der, _ := base64.RawURLEncoding.DecodeString(finalize.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			a.reply(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:badCSR", "detail": err.Error()})
+			return
+		}
+		a.issue(csr)
+		w.Header().Set("Location", a.URL+"/order/1")
+		a.reply(w, http.StatusOK, a.order())
+	case "cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(a.chain)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *fakeACME) reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (a *fakeACME) order() map[string]interface{} {
+	order := map[string]interface{}{"status": "ready", "finalize": a.URL + "/finalize"}
+	var urls []string
+	for i, z := range a.authz {
+		urls = append(urls, fmt.Sprintf("%v/authz/%d", a.URL, i))
+		if z.status != "valid" {
+			order["status"] = "pending"
+		}
+	}
+	order["authorizations"] = urls
+	if a.chain != nil {
+		order["status"], order["certificate"] = "valid", a.URL+"/cert"
+	}
+	return order
+}
+
+func (a *fakeACME) authorization(i string) map[string]interface{} {
+	z := a.authz[index(i)]
+	return map[string]interface{}{
+		"status":     z.status,
+		"wildcard":   z.wildcard,
+		"identifier": map[string]string{"type": "dns", "value": z.domain},
+		"challenges": []map[string]string{{"type": "dns-01", "url": a.URL + "/chal/" + i, "token": z.token, "status": z.status}},
+	}
+}
+
+// issue signs the certificate of csr, followed by the CA certificate
+func (a *fakeACME) issue(csr *x509.CertificateRequest) {
+	ca := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Fake CA"}, IsCA: true, BasicConstraintsValid: true,
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(365 * 24 * time.Hour), KeyUsage: x509.KeyUsageCertSign}
+	caDER, _ := x509.CreateCertificate(rand.Reader, ca, ca, &a.caKey.PublicKey, a.caKey)
+	leaf := &x509.Certificate{SerialNumber: big.NewInt(time.Now().UnixNano()), Subject: csr.Subject, DNSNames: csr.DNSNames,
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(90 * 24 * time.Hour)}
+	leafDER, _ := x509.CreateCertificate(rand.Reader, leaf, ca, csr.PublicKey, a.caKey)
+	a.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+}
+
+func index(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
+
+// readPair returns the public key of privkey.pem and the leaf certificate of fullchain.pem
+func readPair(t *testing.T, dir string) (interface{}, *x509.Certificate) {
+	keyPEM, err := ioutil.ReadFile(filepath.Join(dir, privateKeyFile))
+	if err != nil {
+		t.Fatalf("Unable to read the private key: %v", err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Unable to parse the private key: %v", err)
+	}
+	chainPEM, err := ioutil.ReadFile(filepath.Join(dir, chainFile))
+	if err != nil {
+		t.Fatalf("Unable to read the chain: %v", err)
+	}
+	block, _ = pem.Decode(chainPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Unable to parse the certificate: %v", err)
+	}
+	return key.Public(), cert
+}
+
+func TestObtain(t *testing.T) {
+	d := duckdnstest.NewServer("token", "example")
+	defer d.Close()
+
+	m := testManager(t)
+	m.Config.Domains = []string{"example"}
+	accountKey, err := loadOrCreateKey(filepath.Join(m.Config.Dir, accountKeyFile))
+	if err != nil {
+		t.Fatalf("loadOrCreateKey() returned error: %v", err)
+	}
+	thumbprint, _ := acme.JWKThumbprint(accountKey.Public())
+	m.Config.DirectoryURL = newFakeACME(t, d, thumbprint).URL + "/dir"
+
+	m.Solver = dns01.NewSolver(http.DefaultClient, "token")
+	m.Solver.BaseURL = d.URL
+	m.Solver.Resolvers = []duckdns.Resolver{d.Resolver()}
+	m.Solver.PollInterval = 10 * time.Millisecond
+
+	if err := m.Obtain(context.Background()); err != nil {
+		t.Fatalf("Obtain() returned error: %v", err)
+	}
+	public, cert := readPair(t, m.Config.Dir)
+	if !reflect.DeepEqual(public, cert.PublicKey) {
+		t.Errorf("Obtain() expected the private key of the certificate")
+	}
+	if want := m.Identifiers(); !reflect.DeepEqual(want, cert.DNSNames) {
+		t.Errorf("Obtain() expected a certificate of %v, got %v", want, cert.DNSNames)
+	}
+	if renew, err := m.NeedsRenewal(); err != nil || renew {
+		t.Errorf("NeedsRenewal() expected false after Obtain(), got %v, %v", renew, err)
+	}
+	if txt := d.Record("example").TXT; txt != "" {
+		t.Errorf("Obtain() expected the challenges to be cleaned up, got TXT %q", txt)
+	}
+
+	// a chain that cannot be written keeps the previous key and certificate
+	if err := os.Mkdir(filepath.Join(m.Config.Dir, chainFile+".tmp"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Obtain(context.Background()); err == nil {
+		t.Fatalf("Obtain() expected to fail writing the chain")
+	}
+	if kept, _ := readPair(t, m.Config.Dir); !reflect.DeepEqual(public, kept) {
+		t.Errorf("Obtain() expected to keep the private key of the previous certificate")
+	}
+	if _, err := os.Stat(filepath.Join(m.Config.Dir, privateKeyFile+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("Obtain() expected to remove the temporary key, got %v", err)
+	}
+}
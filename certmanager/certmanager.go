@@ -0,0 +1,229 @@
+// Package certmanager is a cert-manager external webhook solving DNS-01 challenges with duckdns.
+//
+// cert-manager reaches the solver through the Kubernetes API aggregation layer: it creates a
+// ChallengePayload on /apis/<group>/v1alpha1/<solver> with the Present or CleanUp action and
+// reads the result from the response field of the returned payload.
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/dns01"
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/redact"
+)
+
+const (
+	// SolverName is the solverName to use in the Issuer
+	SolverName = "duckdns"
+
+	payloadAPIVersion = "webhook.acme.cert-manager.io/v1alpha1"
+	payloadKind       = "ChallengePayload"
+
+	actionPresent = "Present"
+	actionCleanUp = "CleanUp"
+
+	defaultTimeout = 25 * time.Second
+)
+
+// ChallengePayload is the object exchanged with cert-manager.
+type ChallengePayload struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *ChallengeRequest  `json:"request,omitempty"`
+	Response   *ChallengeResponse `json:"response,omitempty"`
+}
+
+// ChallengeRequest is the challenge to present or clean up.
+type ChallengeRequest struct {
+	UID                     string          `json:"uid"`
+	Action                  string          `json:"action"`
+	Type                    string          `json:"type"`
+	DNSName                 string          `json:"dnsName"`
+	Key                     string          `json:"key"`
+	ResourceNamespace       string          `json:"resourceNamespace"`
+	ResolvedFQDN            string          `json:"fqdn"`
+	ResolvedZone            string          `json:"zone"`
+	AllowAmbientCredentials bool            `json:"allowAmbientCredentials"`
+	Config                  json.RawMessage `json:"config,omitempty"`
+}
+
+// ChallengeResponse is the result of a challenge request.
+type ChallengeResponse struct {
+	UID     string  `json:"uid"`
+	Success bool    `json:"success"`
+	Result  *Status `json:"status,omitempty"`
+}
+
+// Status is the subset of the Kubernetes Status used to report failures.
+type Status struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason,omitempty"`
+	Code    int    `json:"code"`
+}
+
+// SolverConfig is the webhook config of the Issuer.
+type SolverConfig struct {
+	TokenSecretRef struct {
+		Name string `json:"name"`
+		Key  string `json:"key"`
+	} `json:"tokenSecretRef"`
+}
+
+// SecretReader reads a key of a secret, kube.Client implements it.
+type SecretReader interface {
+	SecretKey(ctx context.Context, namespace, name, key string) (string, error)
+}
+
+// Server is the webhook HTTP handler.
+type Server struct {
+	GroupName string
+	Secrets   SecretReader
+	// BaseURL overrides the duckdns API URL (optional)
+	BaseURL string
+	// Limiter rate limits the requests of the tokens (optional)
+	Limiter *duckdns.Limiter
+	Timeout time.Duration
+
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	solvers map[string]*dns01.Solver
+}
+
+// NewServer returns the webhook of groupName, reading the duckdns tokens with secrets.
+func NewServer(httpClient *http.Client, groupName string, secrets SecretReader) *Server {
+	return &Server{
+		GroupName:  groupName,
+		Secrets:    secrets,
+		Timeout:    defaultTimeout,
+		httpClient: httpClient,
+		solvers:    make(map[string]*dns01.Solver),
+	}
+}
+
+// ServeHTTP serves the discovery of the API group version and the challenge payloads.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/apis/" + s.GroupName + "/v1alpha1"
+	switch {
+	case r.URL.Path == "/healthz":
+		w.Write([]byte("ok"))
+	case r.URL.Path == prefix && r.Method == http.MethodGet:
+		s.discovery(w)
+	case r.URL.Path == prefix+"/"+SolverName && r.Method == http.MethodPost:
+		s.challenge(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"kind":         "APIResourceList",
+		"apiVersion":   "v1",
+		"groupVersion": s.GroupName + "/v1alpha1",
+		"resources": []map[string]interface{}{{
+			"name":         SolverName,
+			"singularName": SolverName,
+			"namespaced":   false,
+			"kind":         payloadKind,
+			"verbs":        []string{"create"},
+		}},
+	})
+}
+
+func (s *Server) challenge(w http.ResponseWriter, r *http.Request) {
+	payload := &ChallengePayload{}
+	if err := json.NewDecoder(r.Body).Decode(payload); err != nil || payload.Request == nil {
+		http.Error(w, "invalid ChallengePayload", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.Timeout)
+	defer cancel()
+
+	req := payload.Request
+	err := s.solve(ctx, req)
+	payload.APIVersion, payload.Kind = payloadAPIVersion, payloadKind
+	payload.Response = &ChallengeResponse{UID: req.UID, Success: err == nil}
+	if err != nil {
+		klog.Errorf("%v of %v failed: %v", req.Action, req.ResolvedFQDN, err)
+		payload.Response.Result = &Status{Status: "Failure", Message: err.Error(), Code: http.StatusInternalServerError}
+	}
+	writeJSON(w, http.StatusCreated, payload)
+}
+
+func (s *Server) solve(ctx context.Context, req *ChallengeRequest) error {
+	if req.Type != "" && req.Type != "dns-01" {
+		return fmt.Errorf("unsupported challenge type %q", req.Type)
+	}
+
+	solver, err := s.solver(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	switch req.Action {
+	case actionPresent:
+		return solver.PresentValue(ctx, req.ResolvedFQDN, req.Key)
+	case actionCleanUp:
+		return solver.CleanUpValue(ctx, req.ResolvedFQDN, req.Key)
+	default:
+		return fmt.Errorf("unknown action %q", req.Action)
+	}
+}
+
+// solver returns the solver of the token referenced by the request config, the solvers are kept
+// so that the challenges of a domain are serialized across requests
+func (s *Server) solver(ctx context.Context, req *ChallengeRequest) (*dns01.Solver, error) {
+	config := SolverConfig{}
+	if len(req.Config) > 0 {
+		if err := json.Unmarshal(req.Config, &config); err != nil {
+			return nil, fmt.Errorf("invalid solver config, %v", err)
+		}
+	}
+	ref := config.TokenSecretRef
+	if ref.Name == "" {
+		return nil, errors.New("solver config needs tokenSecretRef.name")
+	}
+	if ref.Key == "" {
+		ref.Key = "token"
+	}
+
+	token, err := s.Secrets.SecretKey(ctx, req.ResourceNamespace, ref.Name, ref.Key)
+	if err != nil {
+		return nil, err
+	}
+	redact.Add(token)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	solver, ok := s.solvers[token]
+	if !ok {
+		solver = dns01.NewSolver(s.httpClient, token)
+		solver.BaseURL = s.BaseURL
+		solver.Limiter = s.Limiter
+		// cert-manager checks the propagation itself and retries Present, so the challenges
+		// of a domain are not waited for across its requests
+		solver.NoWait = true
+		s.solvers[token] = solver
+	}
+	return solver, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.Error(err)
+	}
+}
@@ -0,0 +1,162 @@
+package certmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ebrianne/duckdns-go/kube"
+	"github.com/ebrianne/duckdns-go/redact"
+)
+
+// presentPayload is a request body as sent by cert-manager
+const presentPayload = `{
+  "apiVersion": "webhook.acme.cert-manager.io/v1alpha1",
+  "kind": "ChallengePayload",
+  "request": {
+    "uid": "6f1b7c4a-2f5e-4d2b-9f0e-8a1f2b3c4d5e",
+    "action": "Present",
+    "type": "dns-01",
+    "dnsName": "example.duckdns.org",
+    "key": "LPJNul-wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ",
+    "resourceNamespace": "default",
+    "fqdn": "_acme-challenge.example.duckdns.org.",
+    "zone": "duckdns.org.",
+    "allowAmbientCredentials": false,
+    "config": {"tokenSecretRef": {"name": "duckdns", "key": "token"}}
+  }
+}`
+
+type fixture struct {
+	server  *Server
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{}
+
+	duckdns := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.queries = append(f.queries, r.URL.Query())
+		f.mu.Unlock()
+		if r.URL.Query().Get("token") != "example-token" {
+			fmt.Fprint(w, "KO")
+			return
+		}
+		fmt.Fprint(w, "OK")
+	}))
+	t.Cleanup(duckdns.Close)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sa-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/namespaces/default/secrets/duckdns":
+			fmt.Fprint(w, `{"kind":"Secret","data":{"token":"ZXhhbXBsZS10b2tlbg=="}}`)
+		case "/api/v1/namespaces/default/secrets/wrong":
+			fmt.Fprint(w, `{"kind":"Secret","data":{"token":"d3Jvbmc="}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","message":"secrets not found","code":404}`)
+		}
+	}))
+	t.Cleanup(api.Close)
+
+	f.server = NewServer(duckdns.Client(), "acme.example.com", kube.NewClient(api.Client(), api.URL, "sa-token"))
+	f.server.BaseURL = duckdns.URL
+	return f
+}
+
+func (f *fixture) post(t *testing.T, body string) *ChallengePayload {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/apis/acme.example.com/v1alpha1/duckdns", strings.NewReader(body))
+	f.server.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST expected to return 201, got %v: %v", rec.Code, rec.Body)
+	}
+	payload := &ChallengePayload{}
+	if err := json.NewDecoder(rec.Body).Decode(payload); err != nil {
+		t.Fatalf("Unable to decode the response: %v", err)
+	}
+	if payload.Kind != "ChallengePayload" || payload.Response == nil {
+		t.Fatalf("Unexpected response %+v", payload)
+	}
+	return payload
+}
+
+func TestPresentAndCleanUp(t *testing.T) {
+	f := newFixture(t)
+	defer redact.Reset()
+
+	for i := 0; i < 2; i++ {
+		// cert-manager retries Present until the record propagated
+		payload := f.post(t, presentPayload)
+		if !payload.Response.Success || payload.Response.UID != "6f1b7c4a-2f5e-4d2b-9f0e-8a1f2b3c4d5e" {
+			t.Fatalf("Present expected to succeed, got %+v", payload.Response)
+		}
+	}
+
+	// the token of the Secret is scrubbed from the logs
+	if got := redact.String("example-token"); got != redact.Mask {
+		t.Errorf("Expected the token to be registered for redaction, got %v", got)
+	}
+
+	payload := f.post(t, strings.Replace(presentPayload, `"Present"`, `"CleanUp"`, 1))
+	if !payload.Response.Success {
+		t.Fatalf("CleanUp expected to succeed, got %+v", payload.Response.Result)
+	}
+
+	if len(f.queries) != 2 {
+		t.Fatalf("Expected 2 duckdns requests, got %v", f.queries)
+	}
+	for i, q := range f.queries {
+		if q.Get("domains") != "example" || q.Get("txt") != "LPJNul-wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ" {
+			t.Errorf("Unexpected duckdns request %v", q)
+		}
+		if want, got := i == 1, q.Get("clear") == "true"; want != got {
+			t.Errorf("duckdns request %d clear expected %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestFailures(t *testing.T) {
+	f := newFixture(t)
+
+	for name, body := range map[string]string{
+		"missing secret": strings.Replace(presentPayload, `"name": "duckdns"`, `"name": "missing"`, 1),
+		"wrong token":    strings.Replace(presentPayload, `"name": "duckdns"`, `"name": "wrong"`, 1),
+		"no config":      strings.Replace(presentPayload, `"config": {"tokenSecretRef": {"name": "duckdns", "key": "token"}}`, `"config": {}`, 1),
+		"other zone":     strings.Replace(presentPayload, `example.duckdns.org.`, `example.com.`, 1),
+	} {
+		payload := f.post(t, body)
+		if payload.Response.Success || payload.Response.Result == nil || payload.Response.Result.Message == "" {
+			t.Errorf("%v: expected a failure with a message, got %+v", name, payload.Response)
+		}
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	f := newFixture(t)
+
+	rec := httptest.NewRecorder()
+	f.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/apis/acme.example.com/v1alpha1", nil))
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"name":"duckdns"`)) {
+		t.Errorf("Discovery expected to list the duckdns resource, got %v: %v", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	f.server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/apis/other.example.com/v1alpha1/duckdns", strings.NewReader(presentPayload)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Other groups expected to return 404, got %v", rec.Code)
+	}
+}
@@ -0,0 +1,325 @@
+// Package cli dispatches the subcommands of the command line.
+//
+// The first words of the arguments select the command, as in "txt set <record>", and the
+// flags follow, before or after the arguments. Every command accepts a subset of the flags of the application, setting
+// another flag is a usage error. The help, completion and __complete commands are built in.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Command is a subcommand of the application.
+type Command struct {
+	// Name is the words selecting the command, such as "txt set"
+	Name string
+	// Args describes the arguments in the usage line, such as "[record]"
+	Args string
+	// MinArgs and MaxArgs bound the number of arguments, a negative MaxArgs has no bound
+	MinArgs int
+	MaxArgs int
+	// Short is the one line description of the command
+	Short string
+	// Flags accepted by the command, a trailing * matches every flag with the prefix
+	Flags []string
+	Run   func(args []string) error
+}
+
+// accepts returns whether the command accepts the flag name
+func (c *Command) accepts(name string) bool {
+	for _, pattern := range c.Flags {
+		if pattern == name || strings.HasSuffix(pattern, "*") && strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// UsageError is returned for a wrong command line, nothing has been run.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+// Usagef returns a UsageError, for the validations left to the commands.
+func Usagef(format string, a ...interface{}) error {
+	return &UsageError{Message: fmt.Sprintf(format, a...)}
+}
+
+// App is the set of commands of the application.
+type App struct {
+	Name     string
+	Commands []*Command
+	// Flags defines every flag of the application on fs, the commands pick theirs
+	Flags func(fs *flag.FlagSet) error
+	// Legacy maps the boolean flags of the command line without subcommands to the name of
+	// their command, the arguments starting with a flag select one of them. The flag values
+	// are read once Flags ran, so a value it loaded, from the environment for example, selects
+	// a command too
+	Legacy map[string]string
+
+	// Stdout receives the help and the completion, os.Stdout by default
+	Stdout io.Writer
+}
+
+func (a *App) stdout() io.Writer {
+	if a.Stdout == nil {
+		return os.Stdout
+	}
+	return a.Stdout
+}
+
+// Run runs the command selected by args, the arguments without the program name.
+func (a *App) Run(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return a.runLegacy(args)
+	}
+
+	cmd, rest := a.find(args)
+	if cmd == nil {
+		if next := a.next(args[:1]); len(next) > 0 {
+			return Usagef("%v needs a subcommand: %v, see %v help %v", args[0], strings.Join(next, ", "), a.Name, args[0])
+		}
+		return Usagef("Unknown command %q, see %v help", args[0], a.Name)
+	}
+
+	fs, err := a.flagSet(cmd.Name)
+	if err != nil {
+		return err
+	}
+	args, err = parse(fs, rest, len(cmd.Flags) > 0)
+	if err == flag.ErrHelp {
+		a.commandHelp(a.stdout(), cmd)
+		return nil
+	} else if err != nil {
+		return Usagef("%v, see %v help %v", err, a.Name, cmd.Name)
+	}
+
+	var unused []string
+	fs.Visit(func(f *flag.Flag) {
+		if !cmd.accepts(f.Name) {
+			unused = append(unused, "-"+f.Name)
+		}
+	})
+	if len(unused) > 0 {
+		return Usagef("%v not used by the %v command, see %v help %v", strings.Join(unused, ", "), cmd.Name, a.Name, cmd.Name)
+	}
+	if n := len(args); n < cmd.MinArgs || cmd.MaxArgs >= 0 && n > cmd.MaxArgs {
+		return Usagef("Wrong number of arguments, usage: %v %v", a.Name, usageLine(cmd))
+	}
+	return cmd.Run(args)
+}
+
+// parse parses the flags of args and returns the arguments. With interspersed, the flags
+// may follow the arguments until "--", otherwise the first argument ends the flags.
+func parse(fs *flag.FlagSet, args []string, interspersed bool) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if !interspersed || len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional, args = append(positional, rest[0]), rest[1:]
+	}
+}
+
+// runLegacy runs the command of the single legacy flag set in args or by a.Flags
+func (a *App) runLegacy(args []string) error {
+	fs, err := a.flagSet(a.Name)
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		a.usage(a.stdout(), "")
+		return nil
+	} else if err != nil {
+		return Usagef("%v, see %v help", err, a.Name)
+	}
+
+	var selected []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := a.Legacy[f.Name]; ok && f.Value.String() == "true" {
+			selected = append(selected, "-"+f.Name)
+		}
+	})
+	switch len(selected) {
+	case 0:
+		return Usagef("No command given, see %v help", a.Name)
+	case 1:
+	default:
+		return Usagef("%v cannot be combined, run one command at a time, see %v help", strings.Join(selected, " and "), a.Name)
+	}
+	return a.command(a.Legacy[strings.TrimPrefix(selected[0], "-")]).Run(fs.Args())
+}
+
+func (a *App) flagSet(name string) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Usage = func() {}
+	if a.Flags != nil {
+		if err := a.Flags(fs); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+// commands returns the commands of the application and the built-in ones
+func (a *App) commands() []*Command {
+	return append(a.Commands[:len(a.Commands):len(a.Commands)],
+		&Command{Name: "help", Args: "[command]", MaxArgs: -1, Short: "Show the help of a command", Run: a.help},
+		&Command{Name: "completion", Args: "bash|zsh|fish", MinArgs: 1, MaxArgs: 1, Short: "Print the shell completion script", Run: a.completion},
+		&Command{Name: "__complete", MaxArgs: -1, Run: a.complete},
+	)
+}
+
+func (a *App) command(name string) *Command {
+	for _, cmd := range a.commands() {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// find returns the command with the most words matching the first arguments, and the
+// arguments after its name
+func (a *App) find(args []string) (*Command, []string) {
+	var found *Command
+	var words int
+	for _, cmd := range a.commands() {
+		name := strings.Fields(cmd.Name)
+		if len(name) > words && len(name) <= len(args) && equal(name, args[:len(name)]) {
+			found, words = cmd, len(name)
+		}
+	}
+	return found, args[words:]
+}
+
+// next returns the words following words in the names of the visible commands
+func (a *App) next(words []string) []string {
+	seen := make(map[string]bool)
+	var next []string
+	for _, cmd := range a.commands() {
+		name := strings.Fields(cmd.Name)
+		if strings.HasPrefix(cmd.Name, "__") || len(name) <= len(words) || !equal(name[:len(words)], words) {
+			continue
+		}
+		if word := name[len(words)]; !seen[word] {
+			seen[word] = true
+			next = append(next, word)
+		}
+	}
+	return next
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *App) help(args []string) error {
+	if len(args) == 0 {
+		a.usage(a.stdout(), "")
+		return nil
+	}
+	if cmd, rest := a.find(args); cmd != nil && len(rest) == 0 {
+		a.commandHelp(a.stdout(), cmd)
+		return nil
+	}
+	if len(a.next(args)) > 0 {
+		a.usage(a.stdout(), strings.Join(args, " "))
+		return nil
+	}
+	return Usagef("Unknown command %q, see %v help", strings.Join(args, " "), a.Name)
+}
+
+// usage prints the commands starting with prefix
+func (a *App) usage(w io.Writer, prefix string) {
+	fmt.Fprintf(w, "Usage: %v <command> [flags] [arguments]\n\nCommands:\n", a.Name)
+	for _, cmd := range a.commands() {
+		if strings.HasPrefix(cmd.Name, "__") || prefix != "" && !strings.HasPrefix(cmd.Name, prefix+" ") {
+			continue
+		}
+		fmt.Fprintf(w, "  %-22v %v\n", cmd.Name, cmd.Short)
+	}
+	fmt.Fprintf(w, "\nRun \"%v help <command>\" for the flags of a command.\n", a.Name)
+	if len(a.Legacy) > 0 && prefix == "" {
+		legacy := make([]string, 0, len(a.Legacy))
+		for name, cmd := range a.Legacy {
+			legacy = append(legacy, fmt.Sprintf("  -%-21v %v\n", name, cmd))
+		}
+		sort.Strings(legacy)
+		fmt.Fprintf(w, "\nThe flags without a command run the command of a single flag:\n%v", strings.Join(legacy, ""))
+	}
+}
+
+func usageLine(cmd *Command) string {
+	line := cmd.Name
+	if len(cmd.Flags) > 0 {
+		line += " [flags]"
+	}
+	if cmd.Args != "" {
+		line += " " + cmd.Args
+	}
+	return line
+}
+
+// commandHelp prints the usage of cmd and its flags, in the format of flag.PrintDefaults
+func (a *App) commandHelp(w io.Writer, cmd *Command) {
+	fmt.Fprintf(w, "Usage: %v %v\n\n%v\n", a.Name, usageLine(cmd), cmd.Short)
+	fs, err := a.flagSet(cmd.Name)
+	if err != nil || len(cmd.Flags) == 0 {
+		return
+	}
+
+	fmt.Fprint(w, "\nFlags:\n")
+	fs.VisitAll(func(f *flag.Flag) {
+		if !cmd.accepts(f.Name) {
+			return
+		}
+		line := "  -" + f.Name
+		if typ := flagType(f); typ != "" {
+			line += " " + typ
+		}
+		line += "\n    \t" + f.Usage
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" && f.DefValue != "0s" {
+			line += fmt.Sprintf(" (default %v)", f.DefValue)
+		}
+		fmt.Fprintln(w, line)
+	})
+}
+
+// flagType returns the type of the value of f, empty for a boolean flag
+func flagType(f *flag.Flag) string {
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return ""
+	}
+	if t, ok := f.Value.(interface{ Type() string }); ok {
+		return t.Type()
+	}
+	name, _ := flag.UnquoteUsage(f)
+	return name
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fixture struct {
+	app  *App
+	out  *bytes.Buffer
+	ran  string
+	args []string
+}
+
+func newFixture() *fixture {
+	f := &fixture{out: &bytes.Buffer{}}
+	run := func(name string) func([]string) error {
+		return func(args []string) error {
+			f.ran, f.args = name, args
+			return nil
+		}
+	}
+	f.app = &App{
+		Name: "duckdns-go",
+		Commands: []*Command{
+			{Name: "update", Short: "Update the IP", Flags: []string{"token", "ipv*"}, Run: run("update")},
+			{Name: "txt set", Args: "<record>", MinArgs: 1, MaxArgs: 1, Short: "Set the TXT record", Flags: []string{"token", "wait"}, Run: run("txt set")},
+			{Name: "txt get", Short: "Get the TXT record", Flags: []string{"token"}, Run: run("txt get")},
+			{Name: "daemon", Short: "Update the IP periodically", Flags: []string{"token"}, Run: run("daemon")},
+		},
+		Flags: func(fs *flag.FlagSet) error {
+			fs.String("token", "", "DuckDNS token")
+			fs.String("ipv4", "", "IPv4 address")
+			fs.Bool("wait", false, "Wait for the record")
+			fs.Bool("update-ip", false, "Update the IP periodically")
+			fs.Bool("get-record", false, "Get the TXT record")
+			return nil
+		},
+		Legacy: map[string]string{"update-ip": "daemon", "get-record": "txt get"},
+		Stdout: f.out,
+	}
+	return f
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		args []string
+		ran  string
+		rest []string
+	}{
+		{[]string{"update", "-token", "t", "-ipv4", "192.0.2.1"}, "update", []string{}},
+		{[]string{"txt", "set", "-wait", "value"}, "txt set", []string{"value"}},
+		{[]string{"txt", "set", "value", "-wait"}, "txt set", []string{"value"}},
+		{[]string{"txt", "set", "-token", "t", "--", "-value"}, "txt set", []string{"-value"}},
+		{[]string{"txt", "get"}, "txt get", []string{}},
+		{[]string{"-update-ip", "-token", "t"}, "daemon", []string{}},
+		{[]string{"-get-record", "-update-ip=false"}, "txt get", []string{}},
+	}
+	for _, test := range tests {
+		f := newFixture()
+		if err := f.app.Run(test.args); err != nil {
+			t.Errorf("Run(%v) returned error: %v", test.args, err)
+			continue
+		}
+		if f.ran != test.ran || !reflect.DeepEqual(f.args, test.rest) {
+			t.Errorf("Run(%v) expected to run %v %v, ran %v %v", test.args, test.ran, test.rest, f.ran, f.args)
+		}
+	}
+}
+
+func TestRunLegacyLoaded(t *testing.T) {
+	f := newFixture()
+	flags := f.app.Flags
+	// as the settings loaded from the environment, the value is set without parsing a flag
+	f.app.Flags = func(fs *flag.FlagSet) error {
+		if err := flags(fs); err != nil {
+			return err
+		}
+		return fs.Lookup("get-record").Value.Set("true")
+	}
+	if err := f.app.Run([]string{"-token", "t"}); err != nil || f.ran != "txt get" {
+		t.Errorf("Expected the loaded legacy flag to run txt get, ran %q: %v", f.ran, err)
+	}
+	if err := f.app.Run([]string{"-update-ip"}); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("Expected the loaded and the parsed legacy flags to conflict, got %v", err)
+	}
+}
+
+func TestRunUsageError(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"unknown"}, `Unknown command "unknown"`},
+		{[]string{"txt"}, "txt needs a subcommand: set, get"},
+		{[]string{"txt", "get", "-wait"}, "-wait not used by the txt get command"},
+		{[]string{"txt", "set"}, "Wrong number of arguments, usage: duckdns-go txt set [flags] <record>"},
+		{[]string{"update", "-unknown"}, "flag provided but not defined: -unknown"},
+		{[]string{"-update-ip", "-get-record"}, "-get-record and -update-ip cannot be combined"},
+		{[]string{"-token", "t"}, "No command given"},
+		{[]string{"completion", "powershell"}, `No completion for "powershell"`},
+	}
+	for _, test := range tests {
+		f := newFixture()
+		err := f.app.Run(test.args)
+		var usage *UsageError
+		if !errors.As(err, &usage) || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Run(%v) expected a usage error %q, got %v", test.args, test.want, err)
+		}
+		if f.ran != "" {
+			t.Errorf("Run(%v) expected to run nothing, ran %v", test.args, f.ran)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	f := newFixture()
+	f.app.Run([]string{"help"})
+	for _, want := range []string{"update", "txt set", "completion", "-update-ip", "daemon"} {
+		if !strings.Contains(f.out.String(), want) {
+			t.Errorf("help expected to list %v, got %v", want, f.out)
+		}
+	}
+	if strings.Contains(f.out.String(), "__complete") {
+		t.Errorf("help expected to hide __complete, got %v", f.out)
+	}
+
+	f = newFixture()
+	f.app.Run([]string{"txt", "set", "-h"})
+	want := "Usage: duckdns-go txt set [flags] <record>\n\nSet the TXT record\n\nFlags:\n" +
+		"  -token string\n    \tDuckDNS token\n  -wait\n    \tWait for the record\n"
+	if f.out.String() != want {
+		t.Errorf("txt set -h expected\n%v\ngot\n%v", want, f.out)
+	}
+
+	f = newFixture()
+	f.app.Run([]string{"help", "txt"})
+	if out := f.out.String(); !strings.Contains(out, "txt get") || strings.Contains(out, "daemon") {
+		t.Errorf("help txt expected to list the txt commands only, got %v", out)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{}, []string{"update", "txt", "daemon", "help", "completion"}},
+		{[]string{"txt"}, []string{"set", "get"}},
+		{[]string{"help", "txt"}, []string{"set", "get"}},
+		{[]string{"update"}, []string{"-ipv4", "-token"}},
+		{[]string{"update", "-token"}, nil},
+		{[]string{"txt", "set", "-wait"}, []string{"-token", "-wait"}},
+		{[]string{"completion"}, []string{"bash", "zsh", "fish"}},
+	}
+	for _, test := range tests {
+		f := newFixture()
+		if err := f.app.Run(append([]string{"__complete"}, test.args...)); err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Fields(f.out.String())
+		if len(got) == 0 {
+			got = nil
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("__complete %v expected %v, got %v", test.args, test.want, got)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		f := newFixture()
+		if err := f.app.Run([]string{"completion", shell}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(f.out.String(), "duckdns-go __complete") {
+			t.Errorf("completion %v expected to call __complete, got %v", shell, f.out)
+		}
+	}
+}
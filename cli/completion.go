@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// the scripts complete the words with the __complete command, given the words before the
+// one being completed
+const (
+	bashCompletion = `_%[2]v() {
+	local IFS=$'\n'
+	COMPREPLY=($(compgen -W "$(%[1]v __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}" 2>/dev/null)" -- "${COMP_WORDS[COMP_CWORD]}"))
+}
+complete -o default -F _%[2]v %[1]v
+`
+	zshCompletion = `#compdef %[1]v
+
+_%[2]v() {
+	local -a candidates
+	candidates=("${(@f)$(%[1]v __complete "${(@)words[2,CURRENT-1]}" 2>/dev/null)}")
+	compadd -a candidates
+}
+compdef _%[2]v %[1]v
+`
+	fishCompletion = `complete -c %[1]v -f -a '(%[1]v __complete (commandline -opc)[2..-1] 2>/dev/null)'
+`
+)
+
+func (a *App) completion(args []string) error {
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return Usagef("No completion for %q, the shells are bash, zsh and fish", args[0])
+	}
+	fmt.Fprintf(a.stdout(), script, a.Name, strings.NewReplacer("-", "_", ".", "_").Replace(a.Name))
+	return nil
+}
+
+// complete prints the candidates for the word following args, one per line
+func (a *App) complete(args []string) error {
+	for _, candidate := range a.candidates(args) {
+		fmt.Fprintln(a.stdout(), candidate)
+	}
+	return nil
+}
+
+func (a *App) candidates(args []string) []string {
+	cmd, rest := a.find(args)
+	switch {
+	case cmd == nil:
+		return a.next(args)
+	case cmd.Name == "help":
+		return a.next(rest)
+	}
+	if cmd.Name == "completion" {
+		if len(rest) == 0 {
+			return []string{"bash", "zsh", "fish"}
+		}
+		return nil
+	}
+
+	fs, err := a.flagSet(cmd.Name)
+	if err != nil {
+		return nil
+	}
+	if n := len(rest); n > 0 && strings.HasPrefix(rest[n-1], "-") && !strings.Contains(rest[n-1], "=") {
+		// the value of the previous flag is expected
+		if f := fs.Lookup(strings.TrimLeft(rest[n-1], "-")); f != nil && flagType(f) != "" {
+			return nil
+		}
+	}
+
+	var candidates []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if cmd.accepts(f.Name) {
+			candidates = append(candidates, "-"+f.Name)
+		}
+	})
+	return candidates
+}
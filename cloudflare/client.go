@@ -0,0 +1,171 @@
+// Package cloudflare publishes the records through a Cloudflare style REST DNS API.
+//
+// The zone IDs of the configured names are looked up once and cached, the records are
+// looked up before every change and only patched when their content differs from the value
+// to publish, so that a record changed outside is corrected.
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+const (
+	defaultBaseURL   = "https://api.cloudflare.com/client/v4"
+	defaultUserAgent = "duckdns-go/" + duckdns.Version
+)
+
+// Zone of the API
+type Zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Record of the API
+type Record struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl,omitempty"`
+}
+
+// APIError is an error of the API envelope
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// envelope wraps every API response
+type envelope struct {
+	Success bool            `json:"success"`
+	Errors  []APIError      `json:"errors"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// Client of the REST API, authenticated with an API token.
+type Client struct {
+	httpClient *http.Client
+	BaseURL    string
+	UserAgent  string
+	Token      string
+}
+
+// NewClient returns a client of the API using token.
+func NewClient(httpClient *http.Client, token string) *Client {
+	return &Client{
+		httpClient: httpClient,
+		BaseURL:    defaultBaseURL,
+		UserAgent:  defaultUserAgent,
+		Token:      token,
+	}
+}
+
+// Zones returns the zones named name.
+func (c *Client) Zones(ctx context.Context, name string) ([]Zone, error) {
+	var zones []Zone
+	err := c.do(ctx, http.MethodGet, "/zones?"+url.Values{"name": {name}}.Encode(), nil, &zones)
+	return zones, err
+}
+
+// Records returns the records of the zone with the type and the name.
+func (c *Client) Records(ctx context.Context, zoneID, recordType, name string) ([]Record, error) {
+	var records []Record
+	q := url.Values{"type": {recordType}, "name": {name}}
+	err := c.do(ctx, http.MethodGet, "/zones/"+zoneID+"/dns_records?"+q.Encode(), nil, &records)
+	return records, err
+}
+
+// CreateRecord creates the record in the zone.
+func (c *Client) CreateRecord(ctx context.Context, zoneID string, record *Record) (*Record, error) {
+	created := &Record{}
+	err := c.do(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", record, created)
+	return created, err
+}
+
+// UpdateRecord patches the content of the record.
+func (c *Client) UpdateRecord(ctx context.Context, zoneID, recordID, content string) (*Record, error) {
+	updated := &Record{}
+	err := c.do(ctx, http.MethodPatch, "/zones/"+zoneID+"/dns_records/"+recordID, map[string]string{"content": content}, updated)
+	return updated, err
+}
+
+// DeleteRecord deletes the record.
+func (c *Client) DeleteRecord(ctx context.Context, zoneID, recordID string) error {
+	return c.do(ctx, http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+recordID, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("User-Agent", c.UserAgent)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	klog.V(2).Infof("Sending %v request to %v", method, req.URL)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	env := &envelope{}
+	if err := json.NewDecoder(resp.Body).Decode(env); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return apiError(resp.StatusCode, nil)
+		}
+		return fmt.Errorf("Unable to decode the %v %v response, %v", method, path, err)
+	}
+	if !env.Success || resp.StatusCode >= http.StatusBadRequest {
+		return apiError(resp.StatusCode, env.Errors)
+	}
+	if out != nil && len(env.Result) > 0 {
+		return json.Unmarshal(env.Result, out)
+	}
+	return nil
+}
+
+// apiError returns the provider error of a failed request, rate limits and server errors are temporary
+func apiError(status int, errs []APIError) error {
+	e := &provider.Error{
+		Provider:  "cloudflare",
+		Code:      strconv.Itoa(status),
+		Temporary: status == http.StatusTooManyRequests || status >= http.StatusInternalServerError,
+	}
+	var messages []string
+	for _, apiErr := range errs {
+		messages = append(messages, fmt.Sprintf("%d %s", apiErr.Code, apiErr.Message))
+	}
+	if len(messages) > 0 {
+		e.Message = strings.Join(messages, "; ")
+	} else {
+		e.Message = http.StatusText(status)
+	}
+	return e
+}
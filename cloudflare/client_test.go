@@ -0,0 +1,153 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+const testToken = "example-token"
+
+// fakeAPI is an in-memory stand-in of the REST API with a single example.com zone
+type fakeAPI struct {
+	mu       sync.Mutex
+	records  map[string]*Record
+	nextID   int
+	requests []string
+	fail     int
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, *Client) {
+	api := &fakeAPI{records: make(map[string]*Record)}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.Client(), testToken)
+	client.BaseURL = server.URL
+	return api, client
+}
+
+func (a *fakeAPI) add(recordType, name, content string) *Record {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nextID++
+	record := &Record{ID: fmt.Sprintf("rec%d", a.nextID), Type: recordType, Name: name, Content: content, TTL: 1}
+	a.records[record.ID] = record
+	return record
+}
+
+func (a *fakeAPI) count(method string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, r := range a.requests {
+		if strings.HasPrefix(r, method+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests = append(a.requests, r.Method+" "+r.URL.Path)
+
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		reply(w, http.StatusForbidden, nil, APIError{Code: 9109, Message: "Invalid access token"})
+		return
+	}
+	if a.fail != 0 {
+		reply(w, a.fail, nil, APIError{Code: 10000, Message: "failure"})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/zones":
+		zones := []Zone{}
+		if r.URL.Query().Get("name") == "example.com" {
+			zones = append(zones, Zone{ID: "zone1", Name: "example.com"})
+		}
+		reply(w, http.StatusOK, zones)
+	case len(parts) == 3 && parts[1] == "zone1" && r.Method == http.MethodGet:
+		records := []Record{}
+		for _, record := range a.records {
+			if record.Type == r.URL.Query().Get("type") && record.Name == r.URL.Query().Get("name") {
+				records = append(records, *record)
+			}
+		}
+		reply(w, http.StatusOK, records)
+	case len(parts) == 3 && parts[1] == "zone1" && r.Method == http.MethodPost:
+		record := &Record{}
+		json.NewDecoder(r.Body).Decode(record)
+		a.nextID++
+		record.ID = fmt.Sprintf("rec%d", a.nextID)
+		a.records[record.ID] = record
+		reply(w, http.StatusOK, record)
+	case len(parts) == 4 && parts[1] == "zone1":
+		record, ok := a.records[parts[3]]
+		if !ok {
+			reply(w, http.StatusNotFound, nil, APIError{Code: 81044, Message: "Record does not exist"})
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(a.records, record.ID)
+			reply(w, http.StatusOK, map[string]string{"id": record.ID})
+			return
+		}
+		patch := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&patch)
+		record.Content = patch["content"]
+		reply(w, http.StatusOK, record)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func reply(w http.ResponseWriter, status int, result interface{}, errs ...APIError) {
+	data, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(envelope{Success: status < 300, Errors: errs, Result: data})
+}
+
+func TestClient_Zones(t *testing.T) {
+	_, client := newFakeAPI(t)
+
+	zones, err := client.Zones(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Zones() returned error: %v", err)
+	}
+	if len(zones) != 1 || zones[0].ID != "zone1" {
+		t.Errorf("Zones() expected zone1, got %v", zones)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	api, client := newFakeAPI(t)
+
+	client.Token = "wrong"
+	_, err := client.Zones(context.Background(), "example.com")
+	var e *provider.Error
+	if !errors.As(err, &e) || e.Code != "403" || !strings.Contains(e.Message, "Invalid access token") {
+		t.Errorf("Zones() expected a 403 error, got %v", err)
+	}
+	if provider.IsTemporary(err) {
+		t.Errorf("Zones() with a wrong token expected to be permanent")
+	}
+
+	client.Token = testToken
+	api.fail = http.StatusTooManyRequests
+	if _, err := client.Zones(context.Background(), "example.com"); !provider.IsTemporary(err) {
+		t.Errorf("Zones() rate limited expected to be temporary, got %v", err)
+	}
+}
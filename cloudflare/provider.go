@@ -0,0 +1,222 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+// Config contains the provider configuration.
+type Config struct {
+	// Names are the fully qualified names to update
+	Names []string
+	// Create the missing records instead of returning an error
+	Create bool
+	// TTL of the created records in seconds, 1 lets the API choose
+	TTL int
+}
+
+// Provider updates the records of the names through the API.
+type Provider struct {
+	Client *Client
+	Config *Config
+
+	mu sync.Mutex
+	// zones caches the zone ID of every name, the records are looked up before every change
+	// so that the records changed outside are corrected
+	zones map[string]string
+}
+
+// NewProvider returns the provider of the configured names.
+func NewProvider(client *Client, config *Config) (*Provider, error) {
+	if client.Token == "" || len(config.Names) == 0 {
+		return nil, errors.New("Cloudflare provider needs an API token and names")
+	}
+	return &Provider{
+		Client: client,
+		Config: config,
+		zones:  make(map[string]string),
+	}, nil
+}
+
+// Name returns the name of the API.
+func (p *Provider) Name() string {
+	return "cloudflare"
+}
+
+// Domains returns the names.
+func (p *Provider) Domains() []string {
+	domains := make([]string, 0, len(p.Config.Names))
+	for _, name := range p.Config.Names {
+		domains = append(domains, canonical(name))
+	}
+	return domains
+}
+
+// Capabilities of the API, which cannot tell the public IP of the daemon.
+func (p *Provider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{IPv4: true, IPv6: true, TXT: true, Clear: true}
+}
+
+// UpdateIP sets the A records to ipv4 and the AAAA records to ipv6 when they differ.
+func (p *Provider) UpdateIP(ctx context.Context, ipv4, ipv6 string) (*provider.Result, error) {
+	if ipv4 == "" && ipv6 == "" {
+		return nil, errors.New("Cloudflare updates need an IP address")
+	}
+
+	result := &provider.Result{IPv4: ipv4, IPv6: ipv6}
+	for _, name := range p.Domains() {
+		for _, record := range []struct {
+			recordType string
+			content    string
+		}{{"A", ipv4}, {"AAAA", ipv6}} {
+			if record.content == "" {
+				continue
+			}
+			changed, err := p.set(ctx, name, record.recordType, record.content)
+			if err != nil {
+				return nil, err
+			}
+			result.Changed = result.Changed || changed
+		}
+	}
+	return result, nil
+}
+
+// ClearIP deletes the A and AAAA records.
+func (p *Provider) ClearIP(ctx context.Context) error {
+	for _, name := range p.Domains() {
+		for _, recordType := range []string{"A", "AAAA"} {
+			if err := p.delete(ctx, name, recordType, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetTXT sets the TXT records to value.
+func (p *Provider) SetTXT(ctx context.Context, value string) error {
+	for _, name := range p.Domains() {
+		if _, err := p.set(ctx, name, "TXT", value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearTXT deletes the TXT records of value.
+func (p *Provider) ClearTXT(ctx context.Context, value string) error {
+	for _, name := range p.Domains() {
+		if err := p.delete(ctx, name, "TXT", value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set publishes content in the record of name, it returns whether the record changed
+func (p *Provider) set(ctx context.Context, name, recordType, content string) (bool, error) {
+	zoneID, err := p.zoneID(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	record, err := p.record(ctx, zoneID, name, recordType)
+	if err != nil {
+		return false, err
+	}
+
+	if record == nil {
+		if !p.Config.Create {
+			return false, fmt.Errorf("%v record of %v does not exist, it needs to be created or enabled with -cloudflare_create", recordType, name)
+		}
+		ttl := p.Config.TTL
+		if ttl <= 0 {
+			ttl = 1
+		}
+		if _, err := p.Client.CreateRecord(ctx, zoneID, &Record{Type: recordType, Name: name, Content: content, TTL: ttl}); err != nil {
+			return false, fmt.Errorf("Unable to create the %v record of %v, %w", recordType, name, err)
+		}
+		return true, nil
+	}
+
+	if sameContent(record.Content, content) {
+		return false, nil
+	}
+	if _, err := p.Client.UpdateRecord(ctx, zoneID, record.ID, content); err != nil {
+		return false, fmt.Errorf("Unable to update the %v record of %v, %w", recordType, name, err)
+	}
+	return true, nil
+}
+
+// delete deletes the records of name with the type, and with content when it is set
+func (p *Provider) delete(ctx context.Context, name, recordType, content string) error {
+	zoneID, err := p.zoneID(ctx, name)
+	if err != nil {
+		return err
+	}
+	records, err := p.Client.Records(ctx, zoneID, recordType, name)
+	if err != nil {
+		return fmt.Errorf("Unable to get the %v records of %v, %w", recordType, name, err)
+	}
+
+	for _, record := range records {
+		if content != "" && !sameContent(record.Content, content) {
+			continue
+		}
+		if err := p.Client.DeleteRecord(ctx, zoneID, record.ID); err != nil {
+			return fmt.Errorf("Unable to delete the %v record of %v, %w", recordType, name, err)
+		}
+	}
+	return nil
+}
+
+// zoneID returns the ID of the zone holding name, trying name and its parents
+func (p *Provider) zoneID(ctx context.Context, name string) (string, error) {
+	p.mu.Lock()
+	id, ok := p.zones[name]
+	p.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	labels := strings.Split(name, ".")
+	for i := 0; i < len(labels)-1; i++ {
+		zones, err := p.Client.Zones(ctx, strings.Join(labels[i:], "."))
+		if err != nil {
+			return "", fmt.Errorf("Unable to find the zone of %v, %w", name, err)
+		}
+		if len(zones) > 0 {
+			p.mu.Lock()
+			p.zones[name] = zones[0].ID
+			p.mu.Unlock()
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("Unable to find the zone of %v", name)
+}
+
+// record returns the record of name with the type, nil when it does not exist
+func (p *Provider) record(ctx context.Context, zoneID, name, recordType string) (*Record, error) {
+	records, err := p.Client.Records(ctx, zoneID, recordType, name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the %v records of %v, %w", recordType, name, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return &records[0], nil
+}
+
+func canonical(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// sameContent compares the contents, the API may return the TXT values quoted
+func sameContent(got, want string) bool {
+	return got == want || strings.Trim(got, `"`) == want
+}
@@ -0,0 +1,126 @@
+package cloudflare
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func newProvider(t *testing.T, client *Client, create bool) *Provider {
+	p, err := NewProvider(client, &Config{Names: []string{"home.example.com", "office.example.com."}, Create: create})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestUpdateIP(t *testing.T) {
+	api, client := newFakeAPI(t)
+	api.add("A", "home.example.com", "192.0.2.1")
+	office := api.add("A", "office.example.com", "192.0.2.2")
+	p := newProvider(t, client, false)
+
+	result, err := p.UpdateIP(context.Background(), "192.0.2.2", "")
+	if err != nil {
+		t.Fatalf("UpdateIP() returned error: %v", err)
+	}
+	if !result.Changed {
+		t.Errorf("UpdateIP() expected a change")
+	}
+	if got := api.count(http.MethodPatch); got != 1 {
+		t.Errorf("Only the differing record expected to be patched, got %v patches", got)
+	}
+	if got := api.records["rec1"].Content; got != "192.0.2.2" {
+		t.Errorf("home.example.com expected to be patched to 192.0.2.2, got %v", got)
+	}
+	if got := office.Content; got != "192.0.2.2" {
+		t.Errorf("office.example.com expected to be kept, got %v", got)
+	}
+
+	// the zones are cached, the records are looked up again
+	gets := api.count(http.MethodGet)
+	result, err = p.UpdateIP(context.Background(), "192.0.2.2", "")
+	if err != nil || result.Changed {
+		t.Errorf("UpdateIP() expected no change, got %+v, %v", result, err)
+	}
+	if got := api.count(http.MethodGet); got != gets+2 {
+		t.Errorf("Only the record lookups expected once the zones are cached, got %v more", got-gets)
+	}
+}
+
+func TestUpdateIP_Missing(t *testing.T) {
+	api, client := newFakeAPI(t)
+	api.add("A", "home.example.com", "192.0.2.1")
+
+	if _, err := newProvider(t, client, false).UpdateIP(context.Background(), "192.0.2.1", ""); err == nil {
+		t.Errorf("UpdateIP() expected an error for the missing record")
+	}
+
+	p := newProvider(t, client, true)
+	if _, err := p.UpdateIP(context.Background(), "192.0.2.1", "2001:db8::1"); err != nil {
+		t.Fatalf("UpdateIP() returned error: %v", err)
+	}
+	if got := api.count(http.MethodPost); got != 3 {
+		t.Errorf("The missing A and AAAA records expected to be created, got %v creations", got)
+	}
+}
+
+func TestUpdateIP_ChangedOutside(t *testing.T) {
+	api, client := newFakeAPI(t)
+	api.add("A", "home.example.com", "192.0.2.1")
+	api.add("A", "office.example.com", "192.0.2.1")
+	p := newProvider(t, client, false)
+	p.UpdateIP(context.Background(), "192.0.2.1", "")
+
+	// the records are changed and recreated outside of the daemon
+	api.records["rec2"].Content = "192.0.2.9"
+	delete(api.records, "rec1")
+	api.add("A", "home.example.com", "192.0.2.9")
+
+	result, err := p.UpdateIP(context.Background(), "192.0.2.1", "")
+	if err != nil || !result.Changed {
+		t.Fatalf("UpdateIP() expected to correct the records, got %+v, %v", result, err)
+	}
+	for _, record := range api.records {
+		if record.Content != "192.0.2.1" {
+			t.Errorf("%v expected to be corrected, got %v", record.Name, record.Content)
+		}
+	}
+}
+
+func TestTXT(t *testing.T) {
+	api, client := newFakeAPI(t)
+	p := newProvider(t, client, true)
+	ctx := context.Background()
+
+	if err := p.SetTXT(ctx, "hello"); err != nil {
+		t.Fatalf("SetTXT() returned error: %v", err)
+	}
+	api.add("TXT", "home.example.com", `"other"`)
+
+	if err := p.ClearTXT(ctx, "hello"); err != nil {
+		t.Fatalf("ClearTXT() returned error: %v", err)
+	}
+	var left []string
+	for _, record := range api.records {
+		left = append(left, record.Name+" "+record.Content)
+	}
+	if want := []string{`home.example.com "other"`}; !reflect.DeepEqual(want, left) {
+		t.Errorf("Only the other TXT record expected to be left, got %v", left)
+	}
+
+	if err := p.ClearIP(ctx); err != nil {
+		t.Fatalf("ClearIP() returned error: %v", err)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if _, err := NewProvider(NewClient(http.DefaultClient, ""), &Config{Names: []string{"home.example.com"}}); err == nil {
+		t.Errorf("NewProvider() expected an error without token")
+	}
+	p, _ := NewProvider(NewClient(http.DefaultClient, testToken), &Config{Names: []string{"Home.Example.com."}})
+	if want, got := []string{"home.example.com"}, p.Domains(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Domains() expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ebrianne/duckdns-go/cli"
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/externaldns"
+)
+
+var (
+	providerFlags = []string{"duckdns_token", "duckdns_domains", "duckdns_url", "duckdns_rate_*", "verbose", "provider", "resolver*", "metrics_addr", "dyndns2_*", "rfc2136_*", "cloudflare_*"}
+	ipFlags       = []string{"ipv4", "ipv6", "auto-ip", "ipv4-only", "notify_*", "verify*"}
+	txtFlags      = []string{"record", "wait", "wait_timeout", "wait_resolvers"}
+	webhookFlags  = []string{"webhook_addr", "webhook_tls_cert", "webhook_tls_key"}
+	outputFlags   = []string{"output"}
+	dryRunFlags   = []string{"dry-run"}
+)
+
+func flags(groups ...[]string) []string {
+	var all []string
+	for _, group := range groups {
+		all = append(all, group...)
+	}
+	return all
+}
+
+// legacyFlags are the flags selecting the command before the subcommands
+var legacyFlags = map[string]string{
+	"update-ip":            "daemon",
+	"clear-ip":             "clear",
+	"update-record":        "txt set",
+	"get-record":           "txt get",
+	"clear-record":         "txt clear",
+	"certificate":          "certificate",
+	"cert-manager-webhook": "cert-manager-webhook",
+	"external-dns-webhook": "external-dns-webhook",
+	"controller":           "controller",
+	"serve":                "serve",
+}
+
+var commands = []*cli.Command{
+	{
+		Name:  "update",
+		Short: "Update the IP of the domains once",
+		Flags: flags(providerFlags, ipFlags, outputFlags, dryRunFlags),
+		Run:   oneShot("update", update),
+	},
+	{
+		Name:  "clear",
+		Short: "Clear the IP of the domains",
+		Flags: flags(providerFlags, outputFlags, dryRunFlags),
+		Run: oneShot("clear", func(r *Result, args []string) error {
+			c.Init()
+			if err := setup(); err != nil {
+				return err
+			}
+			return ClearIP(r)
+		}),
+	},
+	{
+		Name:    "txt set",
+		Args:    "[record]",
+		MaxArgs: 1,
+		Short:   "Update the TXT record of the domains",
+		Flags:   flags(providerFlags, txtFlags, outputFlags, dryRunFlags),
+		Run: oneShot("txt set", func(r *Result, args []string) error {
+			record, err := recordArg("txt set", args)
+			if err != nil {
+				return err
+			}
+			c.Init()
+			if err := setup(); err != nil {
+				return err
+			}
+			return UpdateRecord(r, record)
+		}),
+	},
+	{
+		Name:  "txt get",
+		Short: "Get the TXT record of the domains",
+		Flags: flags(providerFlags, outputFlags),
+		Run: oneShot("txt get", func(r *Result, args []string) error {
+			c.Init()
+			if err := setup(); err != nil {
+				return err
+			}
+			if err := needDuckDNS("txt get"); err != nil {
+				return err
+			}
+			return GetRecord(r)
+		}),
+	},
+	{
+		Name:    "txt clear",
+		Args:    "[record]",
+		MaxArgs: 1,
+		Short:   "Clear the TXT record of the domains",
+		Flags:   flags(providerFlags, []string{"record"}, outputFlags, dryRunFlags),
+		Run: oneShot("txt clear", func(r *Result, args []string) error {
+			record, err := recordArg("txt clear", args)
+			if err != nil {
+				return err
+			}
+			c.Init()
+			if err := setup(); err != nil {
+				return err
+			}
+			return ClearRecord(r, record)
+		}),
+	},
+	{
+		Name:  "daemon",
+		Short: "Update the IP of the domains on a schedule, or once with -once",
+		Flags: flags(providerFlags, ipFlags, outputFlags, dryRunFlags, []string{"update_*", "detect_interval", "breaker_*", "once"}),
+		Run: func(args []string) error {
+			if c.Once || c.DryRun {
+				return oneShot("update", update)(args)
+			}
+			c.Init()
+			if err := validateIPs(); err != nil {
+				return err
+			}
+			updates, err := newSchedule()
+			if err != nil {
+				return err
+			}
+			if err := setup(); err != nil {
+				return err
+			}
+			UpdateIP(updates)
+			return nil
+		},
+	},
+	{
+		Name:  "status",
+		Short: "Show the published records of the domains",
+		Flags: flags(providerFlags, outputFlags),
+		Run: oneShot("status", func(r *Result, args []string) error {
+			c.Init()
+			if err := setup(); err != nil {
+				return err
+			}
+			return Status(r)
+		}),
+	},
+	{
+		Name:  "detect",
+		Short: "Show the IPs of the device",
+		Flags: flags([]string{"ipv4-only"}, outputFlags),
+		Run:   oneShot("detect", func(r *Result, args []string) error { return Detect(r) }),
+	},
+	{
+		Name:  "version",
+		Short: "Show the version",
+		Flags: outputFlags,
+		Run: oneShot("version", func(r *Result, args []string) error {
+			r.Version = duckdns.Version
+			return nil
+		}),
+	},
+	{
+		Name:  "certificate",
+		Short: "Obtain and renew a certificate for the domains with ACME DNS-01",
+		Flags: []string{"duckdns_token", "duckdns_domains", "duckdns_rate_*", "resolver_timeout", "wait_timeout", "wait_resolvers", "acme_*", "certificate_*"},
+		Run: func(args []string) error {
+			if c.ACME.CheckInterval <= 0 {
+				return configErrorf("-certificate_check_interval needs to be positive, got %v", c.ACME.CheckInterval)
+			}
+			c.Init()
+			ObtainCertificate()
+			ticker := time.NewTicker(c.ACME.CheckInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				ObtainCertificate()
+			}
+			return nil
+		},
+	},
+	{
+		Name:  "cert-manager-webhook",
+		Short: "Serve the cert-manager DNS-01 webhook solver",
+		Flags: flags(webhookFlags, []string{"group_name", "duckdns_rate_*"}),
+		Run: func(args []string) error {
+			c.Init()
+			ServeCertManagerWebhook()
+			return nil
+		},
+	},
+	{
+		Name:  "external-dns-webhook",
+		Short: "Serve the ExternalDNS webhook provider",
+		Flags: flags(providerFlags, webhookFlags),
+		Run: func(args []string) error {
+			c.Init()
+			if err := setup(); err != nil {
+				return err
+			}
+			if err := needDuckDNS("external-dns-webhook"); err != nil {
+				return err
+			}
+			serve(externaldns.NewProvider(client))
+			return nil
+		},
+	},
+	{
+		Name:  "controller",
+		Short: "Run the Kubernetes controller of the DuckDNSRecord resources",
+		Flags: []string{"controller_namespace", "controller_resync", "duckdns_rate_*"},
+		Run: func(args []string) error {
+			c.Init()
+			RunController()
+			return nil
+		},
+	},
+	{
+		Name:  "serve",
+		Short: "Run a self-hosted DuckDNS compatible service for the domains",
+		Flags: []string{"duckdns_token", "duckdns_domains", "serve_*"},
+		Run: func(args []string) error {
+			c.Init()
+			Serve()
+			return nil
+		},
+	},
+}
+
+// update is the one-shot update of the update command and of daemon -once
+func update(r *Result, args []string) error {
+	c.Init()
+	if err := validateIPs(); err != nil {
+		return err
+	}
+	if err := setup(); err != nil {
+		return err
+	}
+	return UpdateIPOnce(r)
+}
+
+// recordArg returns the record given as argument or with -record
+func recordArg(command string, args []string) (string, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	if c.Record == "" {
+		return "", cli.Usagef("%v needs the TXT record, as an argument or with -record", command)
+	}
+	return c.Record, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/config"
+	"github.com/ebrianne/duckdns-go/duckdnstest"
+	"github.com/ebrianne/duckdns-go/redact"
+)
+
+// runJSON runs the command line args with -output json and decodes the printed result
+func runJSON(t *testing.T, args ...string) (map[string]interface{}, error) {
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+	// the command registers its token, it would mask the values of the next tests
+	defer redact.Reset()
+
+	err := newApp("duckdns-go").Run(append(args, "-output", "json"))
+	got := map[string]interface{}{}
+	if jsonErr := json.Unmarshal(out.Bytes(), &got); jsonErr != nil {
+		t.Fatalf("%v expected a JSON result, got %q: %v", args, out.String(), jsonErr)
+	}
+	return got, err
+}
+
+// captureLogs returns the buffer receiving the logs until the end of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	fs.Set("logtostderr", "false")
+	logs := &bytes.Buffer{}
+	klog.SetOutput(logs)
+	t.Cleanup(func() {
+		klog.Flush()
+		klog.SetOutput(os.Stderr)
+		fs.Set("logtostderr", "true")
+	})
+	return logs
+}
+
+func TestDaemonOnce(t *testing.T) {
+	s := duckdnstest.NewServer("token", "example")
+	defer s.Close()
+	args := []string{"daemon", "-once", "-duckdns_url", s.URL, "-duckdns_domains", "example", "-ipv4", "192.0.2.1"}
+
+	got, err := runJSON(t, append(args, "-duckdns_token", "token")...)
+	if err != nil {
+		t.Fatalf("daemon -once returned error: %v", err)
+	}
+	if got["status"] != "OK" || got["ipv4"] != "192.0.2.1" || got["changed"] != true {
+		t.Errorf("Expected the IP to be updated, got %v", got)
+	}
+	if ipv4 := s.Record("example").IPv4; ipv4 != "192.0.2.1" {
+		t.Errorf("Expected the IP to be published, got %v", ipv4)
+	}
+
+	got, err = runJSON(t, append(args, "-duckdns_token", "token")...)
+	if err != nil || got["changed"] != false {
+		t.Errorf("Expected the IP to be unchanged, got %v, %v", got, err)
+	}
+
+	got, err = runJSON(t, append(args, "-duckdns_token", "wrong")...)
+	if exitCode(err) != exitRejected || got["status"] != "KO" || got["exit_code"] != 1.0 {
+		t.Errorf("Expected the update to be rejected, got %v, %v", got, err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	s := duckdnstest.NewServer("token", "example")
+	defer s.Close()
+	common := []string{"-dry-run", "-duckdns_url", s.URL, "-duckdns_token", "token", "-duckdns_domains", "example"}
+	logs := captureLogs(t)
+
+	got, err := runJSON(t, append([]string{"update", "-ipv4", "192.0.2.1"}, common...)...)
+	if err != nil {
+		t.Fatalf("update -dry-run returned error: %v", err)
+	}
+	want := s.URL + "/update?domains=example&token=*********&ip=192.0.2.1&verbose=true"
+	if requests, _ := got["requests"].([]interface{}); len(requests) != 1 || requests[0] != want {
+		t.Errorf("Expected the request %v, got %v", want, got["requests"])
+	}
+	if got["dry_run"] != true || got["ipv4"] != "192.0.2.1" || got["changed"] != nil {
+		t.Errorf("Expected the dry run result with the IP to publish, got %v", got)
+	}
+
+	got, err = runJSON(t, append([]string{"txt", "set", "value"}, common...)...)
+	if err != nil || got["txt"] != "value" || got["dry_run"] != true {
+		t.Errorf("Expected the dry run result with the TXT record, got %v, %v", got, err)
+	}
+
+	if _, err := runJSON(t, append([]string{"update", "-ipv4", "not-an-ip"}, common...)...); exitCode(err) != exitConfig {
+		t.Errorf("Expected an invalid IP to be rejected, got %v", err)
+	}
+	if requests := s.Requests(); len(requests) != 0 {
+		t.Errorf("No request expected in dry run, got %v", requests)
+	}
+	klog.Flush()
+	if strings.Contains(logs.String(), "has been") || !strings.Contains(logs.String(), "Dry run, the TXT Record has not been updated") {
+		t.Errorf("Expected the logs to tell nothing was sent, got %q", logs.String())
+	}
+}
+
+func TestDaemonSchedule(t *testing.T) {
+	common := []string{"daemon", "-duckdns_token", "token", "-duckdns_domains", "example", "-ipv4", "192.0.2.1"}
+	tests := [][]string{
+		{"-update_schedule", "61 * * * *"},
+		{"-update_quiet", "23:00"},
+		{"-detect_interval", "1m"},
+	}
+	for _, test := range tests {
+		if err := newApp("duckdns-go").Run(append(common, test...)); exitCode(err) != exitConfig {
+			t.Errorf("%v expected to be a configuration error, got %v", test, err)
+		}
+	}
+}
+
+func TestTokenRedacted(t *testing.T) {
+	const token = "1b0a6754-49b1-4db5-8540-d2c12664b289"
+	s := duckdnstest.NewServer(token, "example")
+	s.Close()
+	defer redact.Reset()
+
+	logs := captureLogs(t)
+	klog.SetLogFilter(redact.Filter{})
+	defer klog.SetLogFilter(nil)
+
+	got, err := runJSON(t, "daemon", "-once", "-duckdns_url", s.URL, "-duckdns_token", token, "-duckdns_domains", "example", "-ipv4", "192.0.2.1")
+	klog.Flush()
+	if exitCode(err) != exitNetwork || got["error"] == nil {
+		t.Errorf("Expected the update to fail, got %v, %v", got, err)
+	}
+	if strings.Contains(err.Error(), token) || strings.Contains(got["error"].(string), token) {
+		t.Errorf("Expected the token masked in the error, got %v", got["error"])
+	}
+	if strings.Contains(logs.String(), token) || !strings.Contains(logs.String(), redact.Mask) {
+		t.Errorf("Expected the token masked in the logs, got %q", logs.String())
+	}
+}
+
+func TestLegacyEnv(t *testing.T) {
+	s := duckdnstest.NewServer("token", "example")
+	defer s.Close()
+	s.SetRecord("example", duckdnstest.Record{IPv4: "192.0.2.1"})
+	os.Setenv("CLEAR_IP", "true")
+	defer os.Unsetenv("CLEAR_IP")
+	os.Setenv("DUCKDNS_TOKEN", "token")
+	defer os.Unsetenv("DUCKDNS_TOKEN")
+
+	got, err := runJSON(t, "-duckdns_url", s.URL, "-duckdns_domains", "example")
+	if err != nil || got["action"] != "clear" || got["status"] != "OK" {
+		t.Errorf("Expected CLEAR_IP to run the clear command, got %v, %v", got, err)
+	}
+	if ipv4 := s.Record("example").IPv4; ipv4 != "" {
+		t.Errorf("Expected the IP to be cleared, got %v", ipv4)
+	}
+}
+
+func TestCertificateCheckInterval(t *testing.T) {
+	for _, interval := range []string{"0", "-1h"} {
+		err := newApp("duckdns-go").Run([]string{"certificate", "-duckdns_token", "token", "-duckdns_domains", "example", "-certificate_check_interval", interval})
+		if exitCode(err) != exitConfig {
+			t.Errorf("-certificate_check_interval %v expected to be a configuration error, got %v", interval, err)
+		}
+	}
+}
+
+func TestNewScheduleJitterQuiet(t *testing.T) {
+	c = config.New(flag.NewFlagSet("test", flag.ContinueOnError))
+	defer func() { c = nil }()
+	c.Schedule.Cron = "55 22 * * *"
+	c.Schedule.Jitter = 10 * time.Minute
+	c.Schedule.Quiet = []string{"23:00-06:00"}
+
+	updates, err := newSchedule()
+	if err != nil {
+		t.Fatalf("newSchedule() returned error: %v", err)
+	}
+	from := time.Date(2021, 1, 13, 12, 0, 0, 0, time.Local)
+	runs := make(map[time.Time]bool)
+	for i := 0; i < 100; i++ {
+		next := updates.Next(from)
+		if h := next.Hour(); h == 23 || h < 6 {
+			t.Fatalf("Expected no update in the quiet window, got %v", next)
+		}
+		if h, m := next.Hour(), next.Minute(); h != 22 && (h != 6 || m >= 10) {
+			t.Fatalf("Expected the update within the jitter after the quiet window, got %v", next)
+		}
+		if next.Hour() == 6 {
+			runs[next] = true
+		}
+	}
+	// the postponed updates are spread by the jitter, not all at 06:00
+	if len(runs) < 10 {
+		t.Errorf("Expected the postponed updates to be spread, got %d distinct runs", len(runs))
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"net"
 	"reflect"
@@ -13,91 +14,329 @@ import (
 
 	"github.com/heetch/confita"
 	"github.com/heetch/confita/backend/env"
-	"github.com/heetch/confita/backend/flags"
+
+	"github.com/ebrianne/duckdns-go/redact"
 )
 
 // Config is the exporter CLI configuration.
 type ClientConfig struct {
-	Token       string        `config:"duckdns_token,description=DuckDNS Token (mandatory)"`
+	Token       string        `config:"duckdns_token,description=DuckDNS Token (mandatory)" secret:"true"`
 	DomainNames []string      `config:"duckdns_domains,description=List of duckdns domains to update, needs to be comma separated (mandatory)"`
-	Record      string        `config:"record,description=TXT record (mandatory with -update-record/-clear-record flags)"`
+	Record      string        `config:"record,description=TXT record of txt set and txt clear, instead of the argument"`
 	IPv4        string        `config:"ipv4,description=IPv4 address (optional)"`
 	IPv6        string        `config:"ipv6,description=IPv6 address (optional)"`
 	Interval    time.Duration `config:"update_interval,description=Interval between IP updates (min 10 mins)"`
+	DryRun      bool          `config:"dry-run,description=Show the requests of the command and the values to publish without sending them"`
+	Once        bool          `config:"once,description=Update the IP a single time and exit instead of on the schedule"`
+	BaseURL     string        `config:"duckdns_url,description=Base URL of the DuckDNS API, to use a self-hosted service"`
+	RateLimit   time.Duration `config:"duckdns_rate_limit,description=Interval between two requests with the same token once duckdns_rate_burst requests were sent, 0 disables the limit"`
+	RateBurst   int           `config:"duckdns_rate_burst,description=Number of requests with the same token sent at once before duckdns_rate_limit applies"`
 
 	Verbose      bool `config:"verbose,description=Verbose flag for duckdns response"`
 	AutoIP       bool `config:"auto-ip,description=Get device ipv4 and ipv6"`
 	IPv4Only     bool `config:"ipv4-only,description=Get device ipv4"`
-	UpdateIP     bool `config:"update-ip,description=Update IP routine"`
-	ClearIP      bool `config:"clear-ip,description=Clear ip in duckdns with clear=true`
-	UpdateRecord bool `config:"update-record,description=Update TXT record routine"`
-	GetRecord    bool `config:"get-record,description=Get txt record"`
-	ClearRecord  bool `config:"clear-record,description=Clear txt record in duckdns with clear=true"`
+	UpdateIP     bool `config:"update-ip,description=Update the IP every update_interval, as the daemon command"`
+	ClearIP      bool `config:"clear-ip,description=Clear the IP, as the clear command"`
+	UpdateRecord bool `config:"update-record,description=Update the TXT record, as the txt set command"`
+	GetRecord    bool `config:"get-record,description=Get the TXT record, as the txt get command"`
+	ClearRecord  bool `config:"clear-record,description=Clear the TXT record, as the txt clear command"`
+	Certificate  bool `config:"certificate,description=Obtain and renew a certificate, as the certificate command"`
+	CertManager  bool `config:"cert-manager-webhook,description=Serve the cert-manager webhook, as the cert-manager-webhook command"`
+	ExternalDNS  bool `config:"external-dns-webhook,description=Serve the ExternalDNS webhook, as the external-dns-webhook command"`
+	Controller   bool `config:"controller,description=Run the Kubernetes controller, as the controller command"`
+	Serve        bool `config:"serve,description=Run the self-hosted DuckDNS service, as the serve command"`
+
+	ControllerNamespace string        `config:"controller_namespace,description=Namespace watched by the controller, empty for every namespace"`
+	ControllerResync    time.Duration `config:"controller_resync,description=Interval between two syncs of every DuckDNSRecord (min 10 mins)"`
+
+	Resolver        string        `config:"resolver,description=Resolver for the record lookups: system, authoritative, udp://host:port or tcp://host:port"`
+	ResolverTimeout time.Duration `config:"resolver_timeout,description=Timeout of the DNS lookups, 0 disables it (optional)"`
+	ResolverCache   time.Duration `config:"resolver_cache,description=How long DNS answers are cached, 0 disables the cache (optional)"`
+
+	Wait          bool          `config:"wait,description=Wait for the TXT record to be visible after txt set"`
+	WaitTimeout   time.Duration `config:"wait_timeout,description=Maximum time to wait for the TXT record"`
+	WaitResolvers []string      `config:"wait_resolvers,description=Resolvers that must return the TXT record, needs to be comma separated (default authoritative)"`
+
+	Output string `config:"output,description=Format of the result of the one-shot commands: text or json"`
+
+	MetricsAddr string `config:"metrics_addr,description=Address to serve the metrics on /debug/vars (optional)"`
+
+	Provider string `config:"provider,description=Dynamic DNS service of the updates: duckdns, dyndns2, rfc2136 or cloudflare"`
+
+	Schedule   ScheduleConfig
+	Breaker    BreakerConfig
+	Notify     NotifyConfig
+	Verify     VerifyConfig
+	ACME       ACMEConfig
+	Webhook    WebhookConfig
+	DynDNS2    DynDNS2Config
+	RFC2136    RFC2136Config
+	Cloudflare CloudflareConfig
+	Server     ServerConfig
+}
+
+// ServerConfig is the configuration of the self-hosted service, its token and domains are duckdns_token and duckdns_domains.
+type ServerConfig struct {
+	Addr       string        `config:"serve_addr,description=Address of the /update endpoint"`
+	DNSAddr    string        `config:"serve_dns_addr,description=Address of the authoritative DNS server, on UDP and TCP"`
+	Zone       string        `config:"serve_zone,description=Zone of the domains"`
+	Nameserver string        `config:"serve_nameserver,description=Name of the nameserver in the NS and SOA records (default ns1.<zone>)"`
+	Store      string        `config:"serve_store,description=JSON file keeping the records across restarts"`
+	TTL        time.Duration `config:"serve_ttl,description=TTL of the served records"`
+}
+
+// CloudflareConfig is the configuration of the Cloudflare provider.
+type CloudflareConfig struct {
+	Token  string   `config:"cloudflare_token,description=API token with the DNS edit permission" secret:"true"`
+	APIURL string   `config:"cloudflare_api_url,description=Base URL of the API"`
+	Names  []string `config:"cloudflare_names,description=Fully qualified names to update, needs to be comma separated"`
+	Create bool     `config:"cloudflare_create,description=Create the missing records"`
+	TTL    int      `config:"cloudflare_ttl,description=TTL of the created records in seconds, 1 for automatic"`
+}
+
+// RFC2136Config is the configuration of the RFC 2136 provider.
+type RFC2136Config struct {
+	Server        string        `config:"rfc2136_server,description=Primary DNS server host:port receiving the updates"`
+	Network       string        `config:"rfc2136_network,description=Network of the updates: udp or tcp"`
+	Zone          string        `config:"rfc2136_zone,description=Zone of the updated names"`
+	Names         []string      `config:"rfc2136_names,description=Names to update, relative to the zone or fully qualified, needs to be comma separated"`
+	TTL           time.Duration `config:"rfc2136_ttl,description=TTL of the published records"`
+	TSIGKey       string        `config:"rfc2136_tsig_key,description=Name of the TSIG key (optional)"`
+	TSIGSecret    string        `config:"rfc2136_tsig_secret,description=Base64 secret of the TSIG key (optional)" secret:"true"`
+	TSIGAlgorithm string        `config:"rfc2136_tsig_algorithm,description=Algorithm of the TSIG key"`
+}
+
+// DynDNS2Config is the configuration of the dyndns2 provider.
+type DynDNS2Config struct {
+	Server    string   `config:"dyndns2_server,description=Base URL of the dyndns2 service, for instance https://dynupdate.no-ip.com"`
+	Username  string   `config:"dyndns2_username,description=Username of the dyndns2 service"`
+	Password  string   `config:"dyndns2_password,description=Password of the dyndns2 service" secret:"true"`
+	Hostnames []string `config:"dyndns2_hostnames,description=Hostnames to update, needs to be comma separated"`
+}
+
+// WebhookConfig is the configuration of the webhook servers.
+type WebhookConfig struct {
+	Addr      string `config:"webhook_addr,description=Address of the webhook server"`
+	TLSCert   string `config:"webhook_tls_cert,description=TLS certificate of the webhook server (optional)"`
+	TLSKey    string `config:"webhook_tls_key,description=TLS key of the webhook server (optional)"`
+	GroupName string `config:"group_name,description=API group of the cert-manager webhook, as in the Issuer groupName"`
+}
+
+// ACMEConfig is the certificate configuration.
+type ACMEConfig struct {
+	DirectoryURL  string        `config:"acme_directory,description=ACME directory URL"`
+	Email         string        `config:"acme_email,description=Contact email of the ACME account (optional)"`
+	Dir           string        `config:"certificate_dir,description=Directory of the account key, privkey.pem and fullchain.pem"`
+	Wildcard      bool          `config:"certificate_wildcard,description=Also request *.<domain> for every domain"`
+	RenewBefore   time.Duration `config:"certificate_renew_before,description=Renew the certificate when it expires within this duration"`
+	CheckInterval time.Duration `config:"certificate_check_interval,description=Interval between certificate expiry checks"`
+	ReloadCommand string        `config:"certificate_reload_command,description=Command run after each new certificate (optional)"`
+}
+
+// ScheduleConfig is the schedule of the IP updates of the daemon.
+type ScheduleConfig struct {
+	Cron           string        `config:"update_schedule,description=Cron expression of the IP updates such as 0 */6 * * * or @every 2h, instead of update_interval (optional)"`
+	Jitter         time.Duration `config:"update_jitter,description=Maximum random delay added to each scheduled update, so that many clients do not update together (optional)"`
+	OnStart        bool          `config:"update_on_start,description=Update the IP on start instead of waiting for the first scheduled update"`
+	Quiet          []string      `config:"update_quiet,description=Daily windows such as 23:00-06:00 without scheduled updates, postponed to the end of the window, needs to be comma separated (optional)"`
+	DetectInterval time.Duration `config:"detect_interval,description=Interval between detections of the device IP with -auto-ip or -ipv4-only, updating as soon as it changes (optional)"`
+}
+
+// BreakerConfig is the circuit breaker pausing the updates of the daemon.
+type BreakerConfig struct {
+	Threshold  int           `config:"breaker_threshold,description=Number of updates in a row rejected or throttled by the service before pausing the updates, 0 disables the circuit breaker"`
+	Backoff    time.Duration `config:"breaker_backoff,description=Pause of the updates, doubled every time the update after the pause fails"`
+	MaxBackoff time.Duration `config:"breaker_max_backoff,description=Maximum pause of the updates"`
+}
+
+// VerifyConfig is the DNS verification configuration.
+type VerifyConfig struct {
+	Enabled   bool          `config:"verify,description=Verify the published A/AAAA records after each IP update"`
+	Resolvers []string      `config:"verify_resolvers,description=Resolvers used for the verification: system, authoritative or host:port, needs to be comma separated"`
+	Interval  time.Duration `config:"verify_interval,description=Interval between verifications on top of the ones after each update (optional)"`
+}
+
+// NotifyConfig is the notifications configuration, every notifier is enabled by setting its URL or address.
+type NotifyConfig struct {
+	SlackURL    string `config:"notify_slack_url,description=Slack incoming webhook URL (optional)" secret:"true"`
+	DiscordURL  string `config:"notify_discord_url,description=Discord webhook URL (optional)" secret:"true"`
+	MatrixURL   string `config:"notify_matrix_url,description=Matrix (hookshot) incoming webhook URL (optional)" secret:"true"`
+	NtfyURL     string `config:"notify_ntfy_url,description=ntfy topic URL (optional)"`
+	NtfyToken   string `config:"notify_ntfy_token,description=ntfy access token (optional)" secret:"true"`
+	GotifyURL   string `config:"notify_gotify_url,description=Gotify server URL (optional)"`
+	GotifyToken string `config:"notify_gotify_token,description=Gotify application token (optional)" secret:"true"`
+
+	SMTPAddr     string   `config:"notify_smtp_addr,description=SMTP server host:port (optional)"`
+	SMTPUsername string   `config:"notify_smtp_username,description=SMTP username (optional)"`
+	SMTPPassword string   `config:"notify_smtp_password,description=SMTP password (optional)" secret:"true"`
+	SMTPFrom     string   `config:"notify_smtp_from,description=Sender of the notification emails"`
+	SMTPTo       []string `config:"notify_smtp_to,description=Recipients of the notification emails, needs to be comma separated"`
+
+	ChangeTemplate   string        `config:"notify_change_template,description=Template of the IP change message (optional)"`
+	FailureTemplate  string        `config:"notify_failure_template,description=Template of the failure message (optional)"`
+	RecoveryTemplate string        `config:"notify_recovery_template,description=Template of the recovery message (optional)"`
+	FailureThreshold int           `config:"notify_failure_threshold,description=Number of failed updates in a row before notifying"`
+	MinInterval      time.Duration `config:"notify_min_interval,description=Minimum interval between two notifications of the same kind"`
 }
 
 func getDefaultConfig() *ClientConfig {
 	return &ClientConfig{
-		Token:        "",
-		DomainNames:  nil,
-		Record:       "",
-		IPv4:         "",
-		IPv6:         "",
-		Interval:     60 * time.Minute,
-		Verbose:      false,
-		AutoIP:       false,
-		UpdateIP:     false,
-		ClearIP:      false,
-		UpdateRecord: false,
-		GetRecord:    false,
-		ClearRecord:  false,
+		Token:       "",
+		DomainNames: nil,
+		Record:      "",
+		IPv4:        "",
+		IPv6:        "",
+		Interval:    60 * time.Minute,
+		BaseURL:     "https://www.duckdns.org",
+		RateLimit:   time.Minute,
+		RateBurst:   5,
+		Resolver:    "system",
+		Provider:    "duckdns",
+		Output:      "text",
+		WaitTimeout: 5 * time.Minute,
+
+		ControllerResync: 60 * time.Minute,
+		Verbose:          false,
+		AutoIP:           false,
+		UpdateIP:         false,
+		ClearIP:          false,
+		UpdateRecord:     false,
+		GetRecord:        false,
+		ClearRecord:      false,
+		Schedule: ScheduleConfig{
+			OnStart: true,
+		},
+		Breaker: BreakerConfig{
+			Threshold:  5,
+			Backoff:    30 * time.Minute,
+			MaxBackoff: 24 * time.Hour,
+		},
+		Notify: NotifyConfig{
+			FailureThreshold: 3,
+			MinInterval:      30 * time.Minute,
+		},
+		Verify: VerifyConfig{
+			Resolvers: []string{"authoritative"},
+		},
+		ACME: ACMEConfig{
+			DirectoryURL:  "https://acme-v02.api.letsencrypt.org/directory",
+			Dir:           "certificates",
+			RenewBefore:   30 * 24 * time.Hour,
+			CheckInterval: 12 * time.Hour,
+		},
+		Webhook: WebhookConfig{
+			Addr: ":8443",
+		},
+		Cloudflare: CloudflareConfig{
+			APIURL: "https://api.cloudflare.com/client/v4",
+			TTL:    1,
+		},
+		Server: ServerConfig{
+			Addr:    ":8080",
+			DNSAddr: ":53",
+			Zone:    "duckdns.org",
+			Store:   "duckdns-records.json",
+			TTL:     time.Minute,
+		},
+		RFC2136: RFC2136Config{
+			Network:       "udp",
+			TTL:           time.Minute,
+			TSIGAlgorithm: "hmac-sha256",
+		},
 	}
 }
 
-// Load method loads the configuration by using both flag or environment variables.
-func Load() *ClientConfig {
+// New returns the default configuration and defines its flags on fs, a flag overrides the
+// value of its setting when fs is parsed.
+func New(fs *flag.FlagSet) *ClientConfig {
 	cfg := getDefaultConfig()
+	define(fs, reflect.ValueOf(cfg).Elem())
+	return cfg
+}
 
-	loader := confita.NewLoader(env.NewBackend(), flags.NewBackend())
-	err := loader.Load(context.Background(), cfg)
-	if err != nil {
-		klog.Fatal("Could not load the configuration...")
-	}
-
-	if cfg.AutoIP {
-		// cfg.getPublicIPv4()
-		// cfg.getPublicIPv6()
-		cfg.getDeviceIPv4()
-		cfg.getDeviceIPv6()
+// LoadEnv loads the settings set by environment variables, the flags parsed afterwards
+// override them.
+func (c *ClientConfig) LoadEnv() error {
+	if err := confita.NewLoader(env.NewBackend()).Load(context.Background(), c); err != nil {
+		return fmt.Errorf("Could not load the configuration from the environment, %v", err)
 	}
+	return nil
+}
 
-	if cfg.IPv4Only {
-		cfg.getDeviceIPv4()
+// Init registers the secrets to scrub from the logs, detects the device IPs when asked,
+// clamps the update interval and shows the configuration.
+func (c *ClientConfig) Init() {
+	redact.Add(c.Secrets()...)
+	if c.AutoIP || c.IPv4Only {
+		c.DetectIP()
 	}
 
-	if cfg.Interval < 10*time.Minute {
+	if c.Interval < 10*time.Minute {
 		klog.Infof("A time interval below 10 mins is not recommanded. Setting it to 10 mins.")
-		cfg.Interval = 10 * time.Minute
+		c.Interval = 10 * time.Minute
 	}
 
-	cfg.show()
+	c.show()
+}
 
-	return cfg
+// DetectIP sets the IPv4 and, unless IPv4Only is set, the IPv6 to the addresses of the device.
+func (c *ClientConfig) DetectIP() {
+	// c.getPublicIPv4()
+	// c.getPublicIPv6()
+	c.getDeviceIPv4()
+	if !c.IPv4Only {
+		c.getDeviceIPv6()
+	}
 }
 
 func (c *ClientConfig) show() {
-	val := reflect.ValueOf(c).Elem()
 	klog.Info("---------------------------------------")
 	klog.Info("- DuckDNS client configuration -")
 	klog.Info("---------------------------------------")
-	for i := 0; i < val.NumField(); i++ {
-		valueField := val.Field(i)
-		typeField := val.Type().Field(i)
+	for _, line := range c.lines() {
+		klog.Info(line)
+	}
+	klog.Info("---------------------------------------")
+}
 
-		if valueField.Interface() != false {
-			klog.Info(fmt.Sprintf("%s : %v", typeField.Name, valueField.Interface()))
+// lines returns the settings shown by show, the secrets are masked
+func (c *ClientConfig) lines() []string {
+	var lines []string
+	walk(reflect.ValueOf(c).Elem(), "", func(name string, field reflect.Value, secret bool) {
+		switch {
+		case field.Interface() == false:
+		case secret && !field.IsZero():
+			lines = append(lines, fmt.Sprintf("%s : %s", name, redact.Mask))
+		default:
+			lines = append(lines, fmt.Sprintf("%s : %v", name, field.Interface()))
 		}
+	})
+	return lines
+}
+
+// Secrets returns the values of the settings tagged secret, to scrub them from the logs and
+// the errors.
+func (c *ClientConfig) Secrets() []string {
+	var secrets []string
+	walk(reflect.ValueOf(c).Elem(), "", func(name string, field reflect.Value, secret bool) {
+		if secret && field.String() != "" {
+			secrets = append(secrets, field.String())
+		}
+	})
+	return secrets
+}
+
+// walk calls fn with every field of val, in the nested structs too, prefixed with the name
+// of their struct
+func walk(val reflect.Value, prefix string, fn func(name string, field reflect.Value, secret bool)) {
+	for i := 0; i < val.NumField(); i++ {
+		field, typ := val.Field(i), val.Type().Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			walk(field, prefix+typ.Name+".", fn)
+			continue
+		}
+		fn(prefix+typ.Name, field, typ.Tag.Get("secret") == "true")
 	}
-	klog.Info("---------------------------------------")
 }
 
 // func (c *ClientConfig) getPublicIPv4() {
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines_Secrets(t *testing.T) {
+	c := New(flag.NewFlagSet("test", flag.ContinueOnError))
+	c.Token = "duckdns-secret"
+	c.Cloudflare.Token = "cloudflare-secret"
+	c.Notify.SMTPPassword = "smtp-secret"
+	c.DomainNames = []string{"example"}
+
+	lines := strings.Join(c.lines(), "\n")
+	if strings.Contains(lines, "secret") {
+		t.Errorf("Expected the secrets to be masked, got\n%v", lines)
+	}
+	for _, want := range []string{"Token : *********", "Cloudflare.Token : *********", "Notify.SMTPPassword : *********", "DomainNames : [example]"} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("Expected the line %q, got\n%v", want, lines)
+		}
+	}
+	if !strings.Contains(lines, "DynDNS2.Password : \n") {
+		t.Errorf("Expected the empty secrets to be shown empty, got\n%v", lines)
+	}
+
+	want := []string{"duckdns-secret", "smtp-secret", "cloudflare-secret"}
+	if got := c.Secrets(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Secrets() expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// value is a flag setting a field of the configuration, with the conversions of the
+// environment variables
+type value struct {
+	field reflect.Value
+}
+
+func (v *value) String() string {
+	if v == nil || !v.field.IsValid() {
+		return ""
+	}
+	if v.field.Kind() == reflect.Slice {
+		return strings.Join(v.field.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.field.Interface())
+}
+
+func (v *value) Set(s string) error {
+	switch {
+	case v.field.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.field.SetInt(int64(d))
+	case v.field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.field.SetBool(b)
+	case v.field.Kind() == reflect.Int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.field.SetInt(int64(i))
+	case v.field.Kind() == reflect.Slice:
+		v.field.Set(reflect.ValueOf(strings.Split(s, ",")))
+	default:
+		v.field.SetString(s)
+	}
+	return nil
+}
+
+func (v *value) IsBoolFlag() bool {
+	return v.field.Kind() == reflect.Bool
+}
+
+// Type names the value in the help of the flags
+func (v *value) Type() string {
+	switch {
+	case v.field.Type() == durationType:
+		return "duration"
+	case v.field.Kind() == reflect.Slice:
+		return "list"
+	}
+	return v.field.Kind().String()
+}
+
+// define defines a flag on fs for every field of val with a config tag, in the nested structs too
+func define(fs *flag.FlagSet, val reflect.Value) {
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			define(fs, field)
+			continue
+		}
+
+		tag := val.Type().Field(i).Tag.Get("config")
+		if tag == "" {
+			continue
+		}
+		name, description := tag, ""
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name = tag[:idx]
+			description = strings.TrimPrefix(tag[idx+1:], "description=")
+		}
+		fs.Var(&value{field: field}, name, description)
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlags(t *testing.T) {
+	os.Setenv("duckdns_token", "env-token")
+	os.Setenv("provider", "dyndns2")
+	defer os.Unsetenv("duckdns_token")
+	defer os.Unsetenv("provider")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c := New(fs)
+	if err := c.LoadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-provider", "cloudflare", "-duckdns_domains", "a,b", "-wait", "-update_interval", "15m", "-cloudflare_ttl", "120", "value"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Token != "env-token" || c.Provider != "cloudflare" {
+		t.Errorf("Expected the token from the environment and the provider from the flags, got %v %v", c.Token, c.Provider)
+	}
+	if !reflect.DeepEqual(c.DomainNames, []string{"a", "b"}) || !c.Wait || c.Interval != 15*time.Minute || c.Cloudflare.TTL != 120 {
+		t.Errorf("Flags not applied: %v %v %v %v", c.DomainNames, c.Wait, c.Interval, c.Cloudflare.TTL)
+	}
+	if c.Resolver != "system" || c.RFC2136.TSIGAlgorithm != "hmac-sha256" {
+		t.Errorf("Expected the defaults of the flags not set, got %v %v", c.Resolver, c.RFC2136.TSIGAlgorithm)
+	}
+	if fs.Arg(0) != "value" {
+		t.Errorf("Expected the argument to be kept, got %v", fs.Args())
+	}
+	if f := fs.Lookup("duckdns_token"); f.DefValue != "" || f.Usage != "DuckDNS Token (mandatory)" {
+		t.Errorf("Expected the default value in the flag definition, got %q %q", f.DefValue, f.Usage)
+	}
+}
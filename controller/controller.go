@@ -0,0 +1,286 @@
+// Package controller reconciles DuckDNSRecord custom resources with duckdns.
+//
+// The controller lists and watches the records, publishes each one through duckdns.Client
+// when its spec changes and on every resync, and reports the result in its status.
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/kube"
+	"github.com/ebrianne/duckdns-go/redact"
+)
+
+const (
+	defaultResyncInterval = 10 * time.Minute
+	retryInterval         = 5 * time.Second
+)
+
+// Controller syncs the DuckDNSRecord resources of a namespace, or of every namespace.
+type Controller struct {
+	API *kube.Client
+	// Namespace to watch, empty for every namespace
+	Namespace string
+	// ResyncInterval is how often every record is published again
+	ResyncInterval time.Duration
+	// BaseURL overrides the duckdns API URL (optional)
+	BaseURL string
+	// Limiter rate limits the requests of the tokens (optional)
+	Limiter *duckdns.Limiter
+
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// New returns a controller using api to access the resources and httpClient to reach duckdns.
+func New(httpClient *http.Client, api *kube.Client, namespace string) *Controller {
+	return &Controller{
+		API:            api,
+		Namespace:      namespace,
+		ResyncInterval: defaultResyncInterval,
+		httpClient:     httpClient,
+		now:            time.Now,
+	}
+}
+
+// Run lists, reconciles and watches the records until ctx is done.
+func (c *Controller) Run(ctx context.Context) error {
+	resync := time.NewTicker(c.ResyncInterval)
+	defer resync.Stop()
+
+	for {
+		resourceVersion, err := c.SyncAll(ctx)
+		if err != nil {
+			klog.Errorf("Could not list the records: %v", err)
+		} else {
+			err = c.watch(ctx, resourceVersion, resync.C)
+			if err != nil {
+				klog.Errorf("Watch stopped: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// SyncAll reconciles every record and returns the resource version of the list.
+func (c *Controller) SyncAll(ctx context.Context) (string, error) {
+	list := &DuckDNSRecordList{}
+	if err := c.API.Do(ctx, http.MethodGet, c.path(""), "", nil, list); err != nil {
+		return "", err
+	}
+
+	for i := range list.Items {
+		c.sync(ctx, &list.Items[i])
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch handles the events until the stream ends or the resync ticks
+func (c *Controller) watch(ctx context.Context, resourceVersion string, resync <-chan time.Time) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	query := url.Values{"watch": {"1"}, "resourceVersion": {resourceVersion}}
+	body, err := c.API.Stream(ctx, c.path("")+"?"+query.Encode())
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	events := make(chan WatchEvent)
+	done := make(chan error, 1)
+	go func() {
+		decoder := json.NewDecoder(body)
+		for {
+			var event WatchEvent
+			if err := decoder.Decode(&event); err != nil {
+				done <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				done <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-resync:
+			return nil
+		case err := <-done:
+			if errors.Is(err, context.Canceled) || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case event := <-events:
+			if err := c.handle(ctx, event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *Controller) handle(ctx context.Context, event WatchEvent) error {
+	switch event.Type {
+	case "ADDED", "MODIFIED":
+		record := &DuckDNSRecord{}
+		if err := json.Unmarshal(event.Object, record); err != nil {
+			return err
+		}
+		// status updates do not change the generation, only spec changes are synced here
+		if record.Metadata.Generation != record.Status.ObservedGeneration {
+			c.sync(ctx, record)
+		}
+	case "ERROR":
+		return fmt.Errorf("watch error: %s", event.Object)
+	}
+	return nil
+}
+
+// sync reconciles the record and writes its status
+func (c *Controller) sync(ctx context.Context, record *DuckDNSRecord) {
+	key := record.Metadata.Namespace + "/" + record.Metadata.Name
+	status := c.Reconcile(ctx, record)
+	if err := c.patchStatus(ctx, record, status); err != nil {
+		klog.Errorf("Could not update the status of %v: %v", key, err)
+		return
+	}
+	klog.Infof("Synced %v", key)
+}
+
+// Reconcile publishes the record and returns its new status.
+func (c *Controller) Reconcile(ctx context.Context, record *DuckDNSRecord) DuckDNSRecordStatus {
+	status := record.Status
+	status.ObservedGeneration = record.Metadata.Generation
+
+	result, err := c.publish(ctx, record)
+	condition := Condition{Type: ConditionReady, Status: "True", Reason: "Synced"}
+	if err != nil {
+		condition.Status, condition.Reason, condition.Message = "False", "SyncFailed", err.Error()
+	} else {
+		now := c.now().UTC()
+		status.LastSyncTime = &now
+		status.IPv4, status.IPv6, status.TXT = result.IPv4, result.IPv6, record.Spec.TXT
+	}
+	status.Conditions = setCondition(status.Conditions, condition, c.now().UTC())
+	return status
+}
+
+func (c *Controller) publish(ctx context.Context, record *DuckDNSRecord) (*duckdns.Result, error) {
+	spec := record.Spec
+	if spec.Domain == "" {
+		return nil, errors.New("spec.domain is empty")
+	}
+	ref := spec.TokenSecretRef
+	if ref.Name == "" {
+		return nil, errors.New("spec.tokenSecretRef.name is empty")
+	}
+	if ref.Key == "" {
+		ref.Key = "token"
+	}
+
+	token, err := c.API.SecretKey(ctx, record.Metadata.Namespace, ref.Name, ref.Key)
+	if err != nil {
+		return nil, err
+	}
+	redact.Add(token)
+	config := &duckdns.Config{Token: token, DomainNames: []string{spec.Domain}, Verbose: true}
+	if !config.Valid() {
+		return nil, errors.New("duckdns token is empty")
+	}
+	client := duckdns.NewClient(c.httpClient, config)
+	if c.BaseURL != "" {
+		client.BaseURL = c.BaseURL
+	}
+	client.Limiter = c.Limiter
+
+	var resp *duckdns.Response
+	switch spec.IPSource {
+	case "", IPSourceAuto:
+		resp, err = client.UpdateIP(ctx)
+	case IPSourceStatic:
+		if spec.IPv4 == "" && spec.IPv6 == "" {
+			return nil, errors.New("spec.ipv4 or spec.ipv6 is needed with the static ipSource")
+		}
+		if spec.IPv4 == "" {
+			// an empty ip makes duckdns publish the address of the controller
+			resp, err = client.UpdateIPv6(ctx, spec.IPv6, false)
+		} else {
+			resp, err = client.UpdateIPWithValues(ctx, spec.IPv4, spec.IPv6)
+		}
+	default:
+		return nil, fmt.Errorf("unknown ipSource %q", spec.IPSource)
+	}
+	result, err := duckdns.Check(resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.TXT != "" {
+		if _, err := duckdns.Check(client.UpdateRecord(ctx, spec.TXT)); err != nil {
+			return nil, fmt.Errorf("Unable to update the TXT record, %w", err)
+		}
+	} else if record.Status.TXT != "" {
+		if _, err := duckdns.Check(client.ClearRecord(ctx, record.Status.TXT)); err != nil {
+			return nil, fmt.Errorf("Unable to clear the TXT record, %w", err)
+		}
+	}
+	return result, nil
+}
+
+func (c *Controller) patchStatus(ctx context.Context, record *DuckDNSRecord, status DuckDNSRecordStatus) error {
+	patch := map[string]interface{}{"status": status}
+	path := c.pathIn(record.Metadata.Namespace, record.Metadata.Name) + "/status"
+	return c.API.Do(ctx, http.MethodPatch, path, "application/merge-patch+json", patch, nil)
+}
+
+func (c *Controller) path(name string) string {
+	return c.pathIn(c.Namespace, name)
+}
+
+func (c *Controller) pathIn(namespace, name string) string {
+	path := "/apis/" + Group + "/" + Version
+	if namespace != "" {
+		path += "/namespaces/" + namespace
+	}
+	path += "/" + Resource
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// setCondition replaces the condition of the same type, keeping its transition time when its status is unchanged
+func setCondition(conditions []Condition, condition Condition, now time.Time) []Condition {
+	condition.LastTransitionTime = now
+	conditions = append([]Condition(nil), conditions...)
+	for i, existing := range conditions {
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		conditions[i] = condition
+		return conditions
+	}
+	return append(conditions, condition)
+}
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ebrianne/duckdns-go/kube"
+	"github.com/ebrianne/duckdns-go/redact"
+)
+
+// fakeAPI is an in-memory API server holding DuckDNSRecords of the default namespace
+type fakeAPI struct {
+	mu       sync.Mutex
+	records  map[string]*DuckDNSRecord
+	patches  chan *DuckDNSRecord
+	events   chan WatchEvent
+	watching chan struct{}
+}
+
+func newFakeAPI(t *testing.T, records ...*DuckDNSRecord) (*fakeAPI, *kube.Client) {
+	f := &fakeAPI{
+		records:  make(map[string]*DuckDNSRecord),
+		patches:  make(chan *DuckDNSRecord, 10),
+		events:   make(chan WatchEvent),
+		watching: make(chan struct{}, 10),
+	}
+	for _, r := range records {
+		f.records[r.Metadata.Name] = r
+	}
+
+	prefix := "/apis/duckdns-go.io/v1alpha1/namespaces/default/duckdnsrecords"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/default/secrets/duckdns":
+			fmt.Fprint(w, `{"data":{"token":"ZXhhbXBsZS10b2tlbg=="}}`)
+		case r.URL.Path == prefix && r.URL.Query().Get("watch") == "1":
+			w.(http.Flusher).Flush()
+			f.watching <- struct{}{}
+			for {
+				select {
+				case event := <-f.events:
+					json.NewEncoder(w).Encode(event)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		case r.URL.Path == prefix:
+			f.mu.Lock()
+			list := DuckDNSRecordList{}
+			list.Metadata.ResourceVersion = "1"
+			for _, record := range f.records {
+				list.Items = append(list.Items, *record)
+			}
+			f.mu.Unlock()
+			json.NewEncoder(w).Encode(list)
+		case strings.HasPrefix(r.URL.Path, prefix+"/") && strings.HasSuffix(r.URL.Path, "/status") && r.Method == http.MethodPatch:
+			if got := r.Header.Get("Content-Type"); got != "application/merge-patch+json" {
+				t.Errorf("Status patch Content-Type expected to be merge patch, got %v", got)
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix+"/"), "/status")
+			patch := &DuckDNSRecord{}
+			json.NewDecoder(r.Body).Decode(patch)
+			f.mu.Lock()
+			record := *f.records[name]
+			record.Status = patch.Status
+			f.records[name] = &record
+			f.mu.Unlock()
+			f.patches <- &record
+			fmt.Fprint(w, "{}")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"not found"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return f, kube.NewClient(server.Client(), server.URL, "")
+}
+
+type fakeDuckDNS struct {
+	mu      sync.Mutex
+	queries []url.Values
+	url     string
+}
+
+func newFakeDuckDNS(t *testing.T) *fakeDuckDNS {
+	f := &fakeDuckDNS{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f.mu.Lock()
+		f.queries = append(f.queries, q)
+		f.mu.Unlock()
+		if q.Get("token") != "example-token" {
+			fmt.Fprint(w, "KO")
+			return
+		}
+		ip := q.Get("ip")
+		if _, ok := q["ip"]; ok && ip == "" {
+			// an empty ip publishes the address of the caller
+			ip = "203.0.113.7"
+		}
+		fmt.Fprintf(w, "OK\n%s\n%s\nUPDATED", ip, q.Get("ipv6"))
+	}))
+	t.Cleanup(server.Close)
+	f.url = server.URL
+	return f
+}
+
+func testRecord(name string, spec DuckDNSRecordSpec) *DuckDNSRecord {
+	spec.TokenSecretRef = SecretKeySelector{Name: "duckdns"}
+	return &DuckDNSRecord{
+		Metadata: ObjectMeta{Name: name, Namespace: "default", Generation: 1},
+		Spec:     spec,
+	}
+}
+
+func newTestController(t *testing.T, records ...*DuckDNSRecord) (*Controller, *fakeAPI, *fakeDuckDNS) {
+	api, client := newFakeAPI(t, records...)
+	duckdns := newFakeDuckDNS(t)
+	c := New(http.DefaultClient, client, "default")
+	c.BaseURL = duckdns.url
+	c.now = func() time.Time { return time.Date(2021, 1, 13, 11, 0, 0, 0, time.UTC) }
+	return c, api, duckdns
+}
+
+func TestReconcileAuto(t *testing.T) {
+	record := testRecord("home", DuckDNSRecordSpec{Domain: "example"})
+	c, _, duckdns := newTestController(t, record)
+	defer redact.Reset()
+
+	status := c.Reconcile(context.Background(), record)
+	if status.IPv4 != "203.0.113.7" || status.ObservedGeneration != 1 || status.LastSyncTime == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	// the token of the Secret is scrubbed from the logs
+	if got := redact.String("example-token"); got != redact.Mask {
+		t.Errorf("Expected the token to be registered for redaction, got %v", got)
+	}
+	if len(status.Conditions) != 1 || status.Conditions[0].Status != "True" {
+		t.Errorf("Ready condition expected to be true, got %+v", status.Conditions)
+	}
+	if q := duckdns.queries[0]; q.Get("domains") != "example" || q.Get("ip") != "" || q.Get("verbose") != "true" {
+		t.Errorf("Unexpected duckdns request %v", q)
+	}
+}
+
+func TestReconcileStaticAndTXT(t *testing.T) {
+	record := testRecord("office", DuckDNSRecordSpec{Domain: "example", IPSource: IPSourceStatic, IPv4: "10.10.10.253", TXT: "hello"})
+	c, _, duckdns := newTestController(t, record)
+
+	status := c.Reconcile(context.Background(), record)
+	if status.IPv4 != "10.10.10.253" || status.TXT != "hello" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if len(duckdns.queries) != 2 || duckdns.queries[0].Get("ip") != "10.10.10.253" || duckdns.queries[1].Get("txt") != "hello" {
+		t.Errorf("Unexpected duckdns requests %v", duckdns.queries)
+	}
+
+	// removing the TXT from the spec clears it
+	record.Status = status
+	record.Spec.TXT = ""
+	status = c.Reconcile(context.Background(), record)
+	if q := duckdns.queries[3]; q.Get("txt") != "hello" || q.Get("clear") != "true" {
+		t.Errorf("Expected the TXT record to be cleared, got %v", q)
+	}
+	if status.TXT != "" {
+		t.Errorf("Status TXT expected to be empty, got %v", status.TXT)
+	}
+}
+
+func TestReconcileStaticIPv6(t *testing.T) {
+	record := testRecord("office", DuckDNSRecordSpec{Domain: "example", IPSource: IPSourceStatic, IPv6: "2001:db8::1"})
+	c, _, duckdns := newTestController(t, record)
+
+	status := c.Reconcile(context.Background(), record)
+	if status.IPv4 != "" || status.IPv6 != "2001:db8::1" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if len(duckdns.queries) != 2 || duckdns.queries[0].Get("clear") != "true" ||
+		duckdns.queries[1]["ip"] != nil || duckdns.queries[1].Get("ipv6") != "2001:db8::1" {
+		t.Errorf("Expected a clear of the IPs then an update of the IPv6 alone, got %v", duckdns.queries)
+	}
+}
+
+func TestReconcileFailure(t *testing.T) {
+	record := testRecord("broken", DuckDNSRecordSpec{Domain: "example"})
+	record.Spec.TokenSecretRef.Name = "missing"
+	c, _, _ := newTestController(t, record)
+
+	status := c.Reconcile(context.Background(), record)
+	ready := status.Conditions[0]
+	if ready.Status != "False" || ready.Reason != "SyncFailed" || !strings.Contains(ready.Message, "not found") {
+		t.Errorf("Unexpected condition %+v", ready)
+	}
+	if status.LastSyncTime != nil {
+		t.Errorf("LastSyncTime expected to be unset after a failure")
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	before := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := before.Add(time.Hour)
+	conditions := []Condition{{Type: ConditionReady, Status: "True", LastTransitionTime: before}}
+
+	got := setCondition(conditions, Condition{Type: ConditionReady, Status: "True", Reason: "Synced"}, now)
+	if !got[0].LastTransitionTime.Equal(before) {
+		t.Errorf("Transition time expected to be kept when the status is unchanged")
+	}
+	got = setCondition(conditions, Condition{Type: ConditionReady, Status: "False"}, now)
+	if !got[0].LastTransitionTime.Equal(now) {
+		t.Errorf("Transition time expected to change with the status")
+	}
+}
+
+func TestRun(t *testing.T) {
+	record := testRecord("home", DuckDNSRecordSpec{Domain: "example"})
+	c, api, _ := newTestController(t, record)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	// the initial list syncs the record
+	synced := <-api.patches
+	if synced.Status.ObservedGeneration != 1 {
+		t.Fatalf("Initial sync expected to observe generation 1, got %+v", synced.Status)
+	}
+	<-api.watching
+
+	// a status only change is ignored, a spec change is synced
+	unchanged, _ := json.Marshal(synced)
+	api.events <- WatchEvent{Type: "MODIFIED", Object: unchanged}
+
+	changed := *synced
+	changed.Metadata.Generation = 2
+	changed.Spec.IPSource, changed.Spec.IPv4 = IPSourceStatic, "10.10.10.253"
+	object, _ := json.Marshal(changed)
+	api.events <- WatchEvent{Type: "MODIFIED", Object: object}
+
+	select {
+	case synced = <-api.patches:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Spec change expected to be synced")
+	}
+	if synced.Status.ObservedGeneration != 2 || synced.Status.IPv4 != "10.10.10.253" {
+		t.Errorf("Unexpected status after the spec change %+v", synced.Status)
+	}
+	select {
+	case extra := <-api.patches:
+		t.Errorf("Unexpected extra sync %+v", extra.Status)
+	default:
+	}
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// Group of the DuckDNSRecord resource
+	Group = "duckdns-go.io"
+	// Version of the DuckDNSRecord resource
+	Version = "v1alpha1"
+	// Resource is the plural name of DuckDNSRecord
+	Resource = "duckdnsrecords"
+
+	// IPSourceAuto lets duckdns publish the address the request comes from
+	IPSourceAuto = "auto"
+	// IPSourceStatic publishes spec.ipv4 and spec.ipv6
+	IPSourceStatic = "static"
+
+	// ConditionReady is true when the last sync succeeded
+	ConditionReady = "Ready"
+)
+
+// ObjectMeta is the subset of the Kubernetes metadata used by the controller.
+type ObjectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Generation      int64  `json:"generation,omitempty"`
+}
+
+// SecretKeySelector references a key of a secret in the namespace of the record.
+type SecretKeySelector struct {
+	Name string `json:"name"`
+	Key  string `json:"key,omitempty"`
+}
+
+// DuckDNSRecord declares the records of a duckdns domain.
+type DuckDNSRecord struct {
+	APIVersion string              `json:"apiVersion,omitempty"`
+	Kind       string              `json:"kind,omitempty"`
+	Metadata   ObjectMeta          `json:"metadata"`
+	Spec       DuckDNSRecordSpec   `json:"spec"`
+	Status     DuckDNSRecordStatus `json:"status,omitempty"`
+}
+
+// DuckDNSRecordSpec is the desired state of a domain.
+type DuckDNSRecordSpec struct {
+	Domain         string            `json:"domain"`
+	IPSource       string            `json:"ipSource,omitempty"`
+	IPv4           string            `json:"ipv4,omitempty"`
+	IPv6           string            `json:"ipv6,omitempty"`
+	TXT            string            `json:"txt,omitempty"`
+	TokenSecretRef SecretKeySelector `json:"tokenSecretRef"`
+}
+
+// DuckDNSRecordStatus is the published state of a domain.
+type DuckDNSRecordStatus struct {
+	IPv4               string      `json:"ipv4,omitempty"`
+	IPv6               string      `json:"ipv6,omitempty"`
+	TXT                string      `json:"txt,omitempty"`
+	LastSyncTime       *time.Time  `json:"lastSyncTime,omitempty"`
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	Conditions         []Condition `json:"conditions,omitempty"`
+}
+
+// Condition is a Kubernetes status condition.
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// DuckDNSRecordList is the answer of a list request.
+type DuckDNSRecordList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []DuckDNSRecord `json:"items"`
+}
+
+// WatchEvent is a line of a watch stream.
+type WatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
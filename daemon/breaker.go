@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/metrics"
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+// State of a circuit breaker
+type State string
+
+const (
+	// Closed lets the updates through
+	Closed State = "closed"
+	// Open skips the updates until the backoff elapsed
+	Open State = "open"
+	// HalfOpen lets a single update through, its outcome closes or opens the breaker again
+	HalfOpen State = "half-open"
+)
+
+// ErrBreakerOpen is returned by the updates skipped while the circuit breaker is open.
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// Breaker stops the updates after Threshold updates in a row were rejected or throttled by
+// the service, so that a misconfiguration or an outage does not get the token blocked. It
+// stays open for Backoff, doubled every time it opens again without closing, up to
+// MaxBackoff.
+type Breaker struct {
+	Threshold  int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	state     State
+	failures  int
+	backoff   time.Duration
+	openUntil time.Time
+}
+
+// NewBreaker returns a closed breaker.
+func NewBreaker(threshold int, backoff, maxBackoff time.Duration) *Breaker {
+	b := &Breaker{Threshold: threshold, Backoff: backoff, MaxBackoff: maxBackoff}
+	b.set(Closed)
+	return b
+}
+
+// State returns the state of the breaker.
+func (b *Breaker) State() State {
+	if b.state == "" {
+		return Closed
+	}
+	return b.state
+}
+
+// Allow returns an error wrapping ErrBreakerOpen when the update at now needs to be skipped.
+func (b *Breaker) Allow(now time.Time) error {
+	switch b.State() {
+	case Closed:
+		return nil
+	case HalfOpen:
+		return fmt.Errorf("%w, waiting for the outcome of the update let through", ErrBreakerOpen)
+	}
+	if now.Before(b.openUntil) {
+		return fmt.Errorf("%w until %v, skipping the update", ErrBreakerOpen, b.openUntil.Format(time.RFC3339))
+	}
+	klog.Info("Circuit breaker half-open, trying an update")
+	b.set(HalfOpen)
+	return nil
+}
+
+// Record counts the outcome of an update sent at now.
+func (b *Breaker) Record(now time.Time, err error) {
+	if err == nil {
+		b.succeeded()
+		return
+	}
+	if b.State() == HalfOpen {
+		// any failure of the single update let through opens the breaker again, so that
+		// the next updates wait for the backoff
+		b.backoff *= 2
+		if b.MaxBackoff > 0 && b.backoff > b.MaxBackoff {
+			b.backoff = b.MaxBackoff
+		}
+		b.open(now, err)
+		return
+	}
+
+	var rejected *provider.Error
+	if !errors.As(err, &rejected) {
+		// the network errors did not reach the service
+		return
+	}
+	b.failures++
+	if b.State() == Closed && b.failures >= b.Threshold {
+		b.backoff = b.Backoff
+		b.open(now, err)
+	}
+}
+
+func (b *Breaker) open(now time.Time, err error) {
+	b.openUntil = now.Add(b.backoff)
+	klog.Warningf("Circuit breaker open after %v rejected or throttled updates in a row, pausing the updates for %v: %v", b.failures, b.backoff, err)
+	metrics.BreakerOpens.Add(1)
+	b.set(Open)
+}
+
+func (b *Breaker) succeeded() {
+	if b.State() != Closed {
+		klog.Info("Circuit breaker closed, the updates succeed again")
+	}
+	b.failures = 0
+	b.set(Closed)
+}
+
+func (b *Breaker) set(state State) {
+	b.state = state
+	metrics.BreakerState.Set(string(state))
+}
@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+func TestBreaker(t *testing.T) {
+	ko := &provider.Error{Provider: "fake", Code: "KO"}
+	throttled := &provider.Error{Provider: "fake", Code: "429", Temporary: true}
+	b := NewBreaker(2, 10*time.Minute, 30*time.Minute)
+	now := time.Date(2021, 1, 13, 11, 0, 0, 0, time.UTC)
+
+	b.Record(now, ko)
+	b.Record(now, errors.New("connection refused"))
+	if b.State() != Closed {
+		t.Fatalf("Expected the breaker to stay closed below the threshold, got %v", b.State())
+	}
+	b.Record(now, throttled)
+	if b.State() != Open {
+		t.Fatalf("Expected the breaker to open at the threshold, got %v", b.State())
+	}
+
+	// every failure while half-open doubles the backoff, up to the maximum
+	for _, backoff := range []time.Duration{10 * time.Minute, 20 * time.Minute, 30 * time.Minute} {
+		if err := b.Allow(now.Add(backoff - time.Second)); !errors.Is(err, ErrBreakerOpen) {
+			t.Fatalf("Allow() expected ErrBreakerOpen before %v, got %v", backoff, err)
+		}
+		now = now.Add(backoff)
+		if err := b.Allow(now); err != nil || b.State() != HalfOpen {
+			t.Fatalf("Allow() expected a half-open breaker after %v, got %v, %v", backoff, b.State(), err)
+		}
+		if err := b.Allow(now); !errors.Is(err, ErrBreakerOpen) {
+			t.Fatalf("Allow() expected a single update while half-open, got %v", err)
+		}
+		b.Record(now, ko)
+	}
+	if err := b.Allow(now.Add(30*time.Minute - time.Second)); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("Allow() expected the backoff to be capped, got %v", err)
+	}
+
+	// a network error of the update let through opens the breaker again
+	now = now.Add(30 * time.Minute)
+	b.Allow(now)
+	b.Record(now, errors.New("connection refused"))
+	if err := b.Allow(now.Add(time.Second)); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("Allow() expected a single update while half-open, got %v, %v", b.State(), err)
+	}
+
+	b.Allow(now.Add(30 * time.Minute))
+	b.Record(now.Add(30*time.Minute), nil)
+	if b.State() != Closed {
+		t.Errorf("Expected the breaker to close after a success, got %v", b.State())
+	}
+}
+
+func TestUpdate_Breaker(t *testing.T) {
+	ko := &provider.Error{Provider: "fake", Code: "KO"}
+	p := &fakeProvider{caps: provider.Capabilities{IPv4: true, DetectIP: true}, errs: []error{ko, ko, ko}}
+	d := New(p)
+	d.Breaker = NewBreaker(2, time.Hour, 0)
+
+	for i := 0; i < 3; i++ {
+		d.Update(context.Background())
+	}
+	if len(p.updates) != 2 {
+		t.Errorf("Expected the updates to stop once the breaker opened, got %v", p.updates)
+	}
+	if _, err := d.Update(context.Background()); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("Update() expected ErrBreakerOpen, got %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+// Package daemon publishes the IPs of the domains periodically with any provider.
+//
+// The updates follow a schedule and, when the IPs can be detected locally, also run as
+// soon as a detection finds other IPs.
+// Each update is counted in the metrics, can be followed by a DNS verification and
+// feeds the change, failure and recovery notifications.
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/metrics"
+	"github.com/ebrianne/duckdns-go/notify"
+	"github.com/ebrianne/duckdns-go/provider"
+	"github.com/ebrianne/duckdns-go/schedule"
+	"github.com/ebrianne/duckdns-go/verify"
+)
+
+// Daemon updates the IPs of a provider on its schedule.
+type Daemon struct {
+	Provider provider.Provider
+	// Notifier and Verifier are optional
+	Notifier *notify.Dispatcher
+	Verifier *verify.Verifier
+
+	// IPv4 and IPv6 to publish, both empty let the provider detect the address
+	IPv4 string
+	IPv6 string
+
+	Interval time.Duration
+	// Schedule of the updates, every Interval when nil
+	Schedule schedule.Schedule
+	// DelayStart waits for the first scheduled update instead of updating when Run starts
+	DelayStart bool
+	// VerifyInterval adds verifications between the updates, zero disables them
+	VerifyInterval time.Duration
+
+	// Detect returns the current IPs, it is called every DetectInterval to update the IPs as
+	// soon as they change. Both are optional.
+	Detect         func() (ipv4, ipv6 string)
+	DetectInterval time.Duration
+
+	// Breaker pauses the updates after repeated rejections, optional
+	Breaker *Breaker
+	// DryRun tells that the provider sends nothing, for the logs
+	DryRun bool
+
+	// Clock is schedule.System when nil
+	Clock schedule.Clock
+
+	failures      int
+	publishedIPv4 string
+	publishedIPv6 string
+}
+
+// New returns a daemon updating the domains of p.
+func New(p provider.Provider) *Daemon {
+	return &Daemon{Provider: p}
+}
+
+// Run updates the IPs now, unless DelayStart is set, and then on the schedule until ctx is
+// done.
+func (d *Daemon) Run(ctx context.Context) {
+	clock := d.clock()
+	updates := d.Schedule
+	if updates == nil {
+		updates = schedule.Every(d.Interval)
+	}
+
+	if !d.DelayStart {
+		d.Update(ctx)
+	}
+	now := clock.Now()
+	nextUpdate := updates.Next(now)
+	klog.Infof("Next IP update at %v", nextUpdate)
+	var nextVerify, nextDetect time.Time
+	if d.Verifier != nil && d.VerifyInterval > 0 {
+		nextVerify = now.Add(d.VerifyInterval)
+	}
+	if d.Detect != nil && d.DetectInterval > 0 {
+		nextDetect = now.Add(d.DetectInterval)
+	}
+
+	for {
+		next := earliest(nextUpdate, nextVerify, nextDetect)
+		if next.IsZero() {
+			<-ctx.Done()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(next.Sub(clock.Now())):
+		}
+
+		now = clock.Now()
+		if !nextDetect.IsZero() && !now.Before(nextDetect) {
+			d.detect(ctx)
+			nextDetect = now.Add(d.DetectInterval)
+		}
+		if !nextUpdate.IsZero() && !now.Before(nextUpdate) {
+			d.Update(ctx)
+			nextUpdate = updates.Next(clock.Now())
+			klog.Infof("Next IP update at %v", nextUpdate)
+		}
+		if !nextVerify.IsZero() && !now.Before(nextVerify) {
+			d.Verify(ctx)
+			nextVerify = now.Add(d.VerifyInterval)
+		}
+	}
+}
+
+func (d *Daemon) clock() schedule.Clock {
+	if d.Clock == nil {
+		return schedule.System
+	}
+	return d.Clock
+}
+
+// earliest returns the earliest of the times that are not zero
+func earliest(times ...time.Time) time.Time {
+	var min time.Time
+	for _, t := range times {
+		if !t.IsZero() && (min.IsZero() || t.Before(min)) {
+			min = t
+		}
+	}
+	return min
+}
+
+// detect updates the IPs when Detect returns other IPs than the ones to publish
+func (d *Daemon) detect(ctx context.Context) {
+	ipv4, ipv6 := d.Detect()
+	if ipv4 == "" && ipv6 == "" {
+		klog.Warning("No IP detected, keeping the IPs to publish")
+		return
+	}
+	if ipv4 == d.IPv4 && ipv6 == d.IPv6 {
+		return
+	}
+	klog.Infof("IP changed from %v %v to %v %v", d.IPv4, d.IPv6, ipv4, ipv6)
+	d.IPv4, d.IPv6 = ipv4, ipv6
+	d.Update(ctx)
+}
+
+// Update publishes the IPs and verifies them when a verifier is set, it returns the result
+// of the provider or why the update failed.
+func (d *Daemon) Update(ctx context.Context) (*provider.Result, error) {
+	result, err := d.push(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d.Verifier != nil {
+		d.Verify(ctx)
+	}
+	return result, nil
+}
+
+// Published returns the IPs of the last successful update.
+func (d *Daemon) Published() (ipv4, ipv6 string) {
+	return d.publishedIPv4, d.publishedIPv6
+}
+
+// Verify compares the published records with the last published IPs and pushes the IPs
+// again when they drifted.
+func (d *Daemon) Verify(ctx context.Context) {
+	if d.publishedIPv4 == "" && d.publishedIPv6 == "" {
+		klog.Info("No published IP known yet, skipping the verification")
+		return
+	}
+
+	metrics.Verifications.Add(1)
+	drifts, err := d.Verifier.Check(ctx, d.Provider.Domains(), d.publishedIPv4, d.publishedIPv6)
+	if err != nil {
+		klog.Error(err)
+	}
+	if len(drifts) == 0 {
+		klog.Infof("Published records match %v %v", d.publishedIPv4, d.publishedIPv6)
+		return
+	}
+
+	for _, drift := range drifts {
+		klog.Warningf("Drift detected: %v", drift)
+		metrics.Drifts.Add(drift.Domain, 1)
+	}
+	klog.Info("Pushing the IP again")
+	d.push(ctx)
+}
+
+func (d *Daemon) push(ctx context.Context) (*provider.Result, error) {
+	if err := d.check(); err != nil {
+		klog.Error(err)
+		d.failed(ctx, err)
+		return nil, err
+	}
+
+	if d.Breaker != nil {
+		if err := d.Breaker.Allow(d.clock().Now()); err != nil {
+			klog.Warning(err)
+			return nil, err
+		}
+	}
+
+	result, err := d.Provider.UpdateIP(ctx, d.IPv4, d.IPv6)
+	metrics.Updates.Add(1)
+	if d.Breaker != nil {
+		d.Breaker.Record(d.clock().Now(), err)
+	}
+	if err != nil {
+		klog.Errorf("Unable to update the IP with %v, will try again on the next update: %v", d.Provider.Name(), err)
+		d.failed(ctx, err)
+		return nil, err
+	}
+
+	if d.DryRun {
+		klog.Info("Dry run, the IP has not been updated")
+	} else {
+		klog.Infof("IP has been updated at %v", time.Now())
+	}
+	d.succeeded(ctx, result)
+
+	d.publishedIPv4, d.publishedIPv6 = d.IPv4, d.IPv6
+	if result.IPv4 != "" || result.IPv6 != "" {
+		d.publishedIPv4, d.publishedIPv6 = result.IPv4, result.IPv6
+	}
+	return result, nil
+}
+
+// check returns an error wrapping provider.ErrUnsupported when the IPs to publish need a
+// capability the provider does not have
+func (d *Daemon) check() error {
+	caps := d.Provider.Capabilities()
+	switch {
+	case d.IPv4 == "" && d.IPv6 == "" && !caps.DetectIP:
+		return fmt.Errorf("%w: %v cannot detect the IP, it needs to be provided with -ipv4/-ipv6 or -auto-ip", provider.ErrUnsupported, d.Provider.Name())
+	case d.IPv4 != "" && !caps.IPv4:
+		return fmt.Errorf("%w: %v cannot publish an IPv4 address", provider.ErrUnsupported, d.Provider.Name())
+	case d.IPv6 != "" && !caps.IPv6:
+		return fmt.Errorf("%w: %v cannot publish an IPv6 address", provider.ErrUnsupported, d.Provider.Name())
+	}
+	return nil
+}
+
+func (d *Daemon) failed(ctx context.Context, err error) {
+	metrics.UpdateFailures.Add(1)
+	d.failures++
+	if !d.Notifier.Enabled() || d.failures != d.Notifier.FailureThreshold {
+		return
+	}
+	d.notify(ctx, &notify.Message{Event: notify.EventFailure, Error: err.Error(), Failures: d.failures})
+}
+
+func (d *Daemon) succeeded(ctx context.Context, result *provider.Result) {
+	if d.Notifier.Enabled() && d.failures >= d.Notifier.FailureThreshold {
+		d.notify(ctx, &notify.Message{Event: notify.EventRecovery, Failures: d.failures})
+	}
+	d.failures = 0
+
+	if result.Changed {
+		d.notify(ctx, &notify.Message{Event: notify.EventChange, IPv4: result.IPv4, IPv6: result.IPv6})
+	}
+}
+
+func (d *Daemon) notify(ctx context.Context, msg *notify.Message) {
+	msg.Domains = strings.Join(d.Provider.Domains(), ",")
+	if err := d.Notifier.Send(ctx, msg); err != nil {
+		klog.Error(err)
+	}
+}
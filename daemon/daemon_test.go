@@ -0,0 +1,234 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/notify"
+	"github.com/ebrianne/duckdns-go/provider"
+	"github.com/ebrianne/duckdns-go/schedule"
+	"github.com/ebrianne/duckdns-go/verify"
+)
+
+// fakeProvider answers the updates with the queued results and errors
+type fakeProvider struct {
+	caps    provider.Capabilities
+	results []*provider.Result
+	errs    []error
+	updates [][2]string
+}
+
+func (p *fakeProvider) Name() string                                 { return "fake" }
+func (p *fakeProvider) Domains() []string                            { return []string{"home.example.com"} }
+func (p *fakeProvider) Capabilities() provider.Capabilities          { return p.caps }
+func (p *fakeProvider) ClearIP(ctx context.Context) error            { return provider.ErrUnsupported }
+func (p *fakeProvider) SetTXT(ctx context.Context, v string) error   { return provider.ErrUnsupported }
+func (p *fakeProvider) ClearTXT(ctx context.Context, v string) error { return provider.ErrUnsupported }
+
+func (p *fakeProvider) UpdateIP(ctx context.Context, ipv4, ipv6 string) (*provider.Result, error) {
+	p.updates = append(p.updates, [2]string{ipv4, ipv6})
+	i := len(p.updates) - 1
+	if i < len(p.errs) && p.errs[i] != nil {
+		return nil, p.errs[i]
+	}
+	if i < len(p.results) && p.results[i] != nil {
+		return p.results[i], nil
+	}
+	return &provider.Result{}, nil
+}
+
+// recorder keeps the sent notifications
+type recorder struct {
+	texts []string
+}
+
+func (r *recorder) Name() string { return "recorder" }
+
+func (r *recorder) Notify(ctx context.Context, title, text string) error {
+	r.texts = append(r.texts, title)
+	return nil
+}
+
+func newNotifier(t *testing.T, r *recorder) *notify.Dispatcher {
+	d, err := notify.New(&notify.Config{FailureThreshold: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Notifiers = []notify.Notifier{r}
+	return d
+}
+
+func TestUpdate_Notifications(t *testing.T) {
+	ko := &provider.Error{Provider: "fake", Code: "KO"}
+	p := &fakeProvider{
+		caps:    provider.Capabilities{IPv4: true, DetectIP: true},
+		errs:    []error{ko, ko, ko, nil},
+		results: []*provider.Result{nil, nil, nil, {IPv4: "10.10.10.253", Changed: true}},
+	}
+	r := &recorder{}
+	d := New(p)
+	d.Notifier = newNotifier(t, r)
+
+	for i := 0; i < 4; i++ {
+		d.Update(context.Background())
+	}
+
+	want := []string{"duckdns-go: failure", "duckdns-go: recovery", "duckdns-go: change"}
+	if !reflect.DeepEqual(want, r.texts) {
+		t.Errorf("Notifications expected %v, got %v", want, r.texts)
+	}
+	if ipv4, _ := d.Published(); ipv4 != "10.10.10.253" {
+		t.Errorf("Published IPv4 expected 10.10.10.253, got %v", ipv4)
+	}
+}
+
+func TestUpdate_Capabilities(t *testing.T) {
+	p := &fakeProvider{caps: provider.Capabilities{IPv4: true}}
+	d := New(p)
+
+	if _, err := d.Update(context.Background()); !errors.Is(err, provider.ErrUnsupported) {
+		t.Errorf("Update() expected to fail when the provider cannot detect the IP, got %v", err)
+	}
+	d.IPv6 = "::1"
+	if _, err := d.Update(context.Background()); !errors.Is(err, provider.ErrUnsupported) {
+		t.Errorf("Update() expected to fail when the provider cannot publish IPv6, got %v", err)
+	}
+	if len(p.updates) != 0 {
+		t.Errorf("No update expected, got %v", p.updates)
+	}
+
+	d.IPv4, d.IPv6 = "10.10.10.253", ""
+	if _, err := d.Update(context.Background()); err != nil {
+		t.Errorf("Update() expected to succeed, got %v", err)
+	}
+	if ipv4, _ := d.Published(); ipv4 != "10.10.10.253" {
+		t.Errorf("Published IPv4 expected to default to the requested one, got %v", ipv4)
+	}
+}
+
+// staticResolver answers the A lookups with ip
+type staticResolver string
+
+func (r staticResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return nil, nil
+}
+
+func (r staticResolver) LookupIP(ctx context.Context, network, domain string) ([]string, error) {
+	if network != "ip4" {
+		return nil, errors.New("unexpected lookup")
+	}
+	return []string{string(r)}, nil
+}
+
+func (r staticResolver) String() string {
+	return "static"
+}
+
+func TestUpdate_Verify(t *testing.T) {
+	p := &fakeProvider{caps: provider.Capabilities{IPv4: true}}
+	d := New(p)
+	d.IPv4 = "10.10.10.253"
+	d.Verifier = &verify.Verifier{Resolvers: []duckdns.Resolver{staticResolver("10.10.10.1")}}
+
+	d.Update(context.Background())
+	// the drift pushes the IP again
+	if len(p.updates) != 2 {
+		t.Errorf("Expected the IP to be pushed again after the drift, got %v", p.updates)
+	}
+
+	d.Verifier = &verify.Verifier{Resolvers: []duckdns.Resolver{staticResolver("10.10.10.253")}}
+	d.Update(context.Background())
+	if len(p.updates) != 3 {
+		t.Errorf("Expected a single update without drift, got %v", p.updates)
+	}
+}
+
+// run starts d on a fake clock, it returns the clock and stops d at the end of the test
+func run(t *testing.T, d *Daemon) *schedule.FakeClock {
+	clock := schedule.NewFakeClock(time.Date(2021, 1, 13, 11, 0, 0, 0, time.UTC))
+	d.Clock = clock
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	clock.BlockUntil(1)
+	return clock
+}
+
+// advance moves the clock by dur and waits for the daemon to wait again
+func advance(clock *schedule.FakeClock, dur time.Duration) {
+	clock.Advance(dur)
+	clock.BlockUntil(1)
+}
+
+func TestRun_Schedule(t *testing.T) {
+	p := &fakeProvider{caps: provider.Capabilities{IPv4: true, DetectIP: true}}
+	d := New(p)
+	d.Schedule, _ = schedule.Parse("0 * * * *")
+	clock := run(t, d)
+
+	if len(p.updates) != 1 {
+		t.Fatalf("Expected an update on start, got %v", p.updates)
+	}
+	advance(clock, 30*time.Minute)
+	if len(p.updates) != 1 {
+		t.Errorf("Expected no update before the schedule, got %v", p.updates)
+	}
+	advance(clock, 30*time.Minute)
+	if len(p.updates) != 2 {
+		t.Errorf("Expected a scheduled update, got %v", p.updates)
+	}
+}
+
+func TestRun_DelayStart(t *testing.T) {
+	p := &fakeProvider{caps: provider.Capabilities{IPv4: true, DetectIP: true}}
+	d := New(p)
+	d.Interval = time.Hour
+	d.DelayStart = true
+	clock := run(t, d)
+
+	if len(p.updates) != 0 {
+		t.Fatalf("Expected no update on start, got %v", p.updates)
+	}
+	advance(clock, time.Hour)
+	if len(p.updates) != 1 {
+		t.Errorf("Expected an update after the interval, got %v", p.updates)
+	}
+}
+
+func TestRun_Detect(t *testing.T) {
+	p := &fakeProvider{caps: provider.Capabilities{IPv4: true}}
+	d := New(p)
+	d.IPv4 = "10.10.10.1"
+	d.Interval = 24 * time.Hour
+	detected := []string{"10.10.10.1", "", "10.10.10.2"}
+	d.Detect = func() (string, string) {
+		ipv4 := detected[0]
+		detected = detected[1:]
+		return ipv4, ""
+	}
+	d.DetectInterval = time.Minute
+	clock := run(t, d)
+
+	for i := 0; i < 2; i++ {
+		advance(clock, time.Minute)
+	}
+	if len(p.updates) != 1 {
+		t.Errorf("Expected no update while the IP is the same, got %v", p.updates)
+	}
+	advance(clock, time.Minute)
+	want := [][2]string{{"10.10.10.1", ""}, {"10.10.10.2", ""}}
+	if !reflect.DeepEqual(want, p.updates) {
+		t.Errorf("Updates expected %v, got %v", want, p.updates)
+	}
+}
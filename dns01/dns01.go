@@ -0,0 +1,267 @@
+// Package dns01 solves ACME DNS-01 challenges with the duckdns TXT record.
+//
+// Solver implements the Present/CleanUp contract used by ACME clients such as lego.
+// DuckDNS holds a single TXT value per domain, so the challenges of a domain, for
+// instance example.duckdns.org and *.example.duckdns.org, are solved one at a time:
+// Present blocks until the previous challenge of the same domain was cleaned up, or fails
+// at once with NoWait. Presenting the same challenge again does nothing.
+package dns01
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+)
+
+const (
+	defaultPropagationTimeout = 5 * time.Minute
+	defaultPollInterval       = 5 * time.Second
+	defaultLockTimeout        = 10 * time.Minute
+)
+
+// Solver sets and clears the TXT record of the challenged domains.
+type Solver struct {
+	Token string
+	// BaseURL overrides the duckdns API URL (optional)
+	BaseURL string
+	// Limiter rate limits the requests of the token (optional)
+	Limiter *duckdns.Limiter
+	// Resolvers must all return the TXT value before Present returns, the duckdns.org nameservers by default
+	Resolvers          []duckdns.Resolver
+	PropagationTimeout time.Duration
+	PollInterval       time.Duration
+	// NoWait skips the propagation check, when the caller does its own, and fails Present at
+	// once when another challenge of the domain is presented, for the caller to retry
+	NoWait bool
+	// LockTimeout releases the domain of a challenge never cleaned up, 10 minutes by default
+	LockTimeout time.Duration
+
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	locks map[string]*lock
+}
+
+// lock is held by the challenge presented on a domain
+type lock struct {
+	// value is the TXT value of the challenge holding the lock
+	value string
+	since time.Time
+	// released is closed when the challenge was cleaned up
+	released chan struct{}
+}
+
+// NewSolver returns a solver for the domains of the duckdns account owning token.
+func NewSolver(httpClient *http.Client, token string) *Solver {
+	return &Solver{
+		Token:              token,
+		PropagationTimeout: defaultPropagationTimeout,
+		PollInterval:       defaultPollInterval,
+		httpClient:         httpClient,
+		locks:              make(map[string]*lock),
+	}
+}
+
+// ChallengeValue returns the TXT value of a key authorization, the unpadded base64url SHA-256 digest.
+func ChallengeValue(keyAuth string) string {
+	digest := sha256.Sum256([]byte(keyAuth))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// Domain returns the duckdns domain holding the TXT record of an ACME identifier,
+// for instance example for *.example.duckdns.org or _acme-challenge.www.example.duckdns.org.
+func Domain(identifier string) (string, error) {
+	return duckdns.Subdomain(identifier)
+}
+
+// Present sets the TXT record of the domain and waits until it is visible.
+func (s *Solver) Present(domain, token, keyAuth string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+	defer cancel()
+	return s.PresentContext(ctx, domain, keyAuth)
+}
+
+// PresentContext is Present with a context bounding the wait for the domain and the propagation.
+func (s *Solver) PresentContext(ctx context.Context, domain, keyAuth string) error {
+	return s.PresentValue(ctx, domain, ChallengeValue(keyAuth))
+}
+
+// PresentValue sets value, the already computed challenge digest, as TXT record of the domain.
+func (s *Solver) PresentValue(ctx context.Context, domain, value string) error {
+	name, err := Domain(domain)
+	if err != nil {
+		return err
+	}
+	client, err := s.client(name)
+	if err != nil {
+		return err
+	}
+
+	acquired, err := s.lock(ctx, name, value)
+	if err != nil {
+		return fmt.Errorf("Unable to present the challenge of %v, %v", domain, err)
+	}
+
+	if acquired {
+		klog.Infof("Presenting the DNS-01 challenge of %v", domain)
+		if _, err := duckdns.Check(client.UpdateRecord(ctx, value)); err != nil {
+			s.unlock(name, value)
+			return fmt.Errorf("Unable to set the TXT record of %v, %w", domain, err)
+		}
+	} else {
+		klog.Infof("The DNS-01 challenge of %v is already presented", domain)
+	}
+	if s.NoWait {
+		return nil
+	}
+
+	err = client.WaitForRecord(ctx, value, &duckdns.WaitOptions{Interval: s.PollInterval, Resolvers: s.Resolvers})
+	if err != nil {
+		if acquired {
+			s.unlock(name, value)
+		}
+		return err
+	}
+	return nil
+}
+
+// CleanUp clears the TXT record of the domain and lets the next challenge of the domain proceed.
+func (s *Solver) CleanUp(domain, token, keyAuth string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+	defer cancel()
+	return s.CleanUpContext(ctx, domain, keyAuth)
+}
+
+// CleanUpContext is CleanUp with a context.
+func (s *Solver) CleanUpContext(ctx context.Context, domain, keyAuth string) error {
+	return s.CleanUpValue(ctx, domain, ChallengeValue(keyAuth))
+}
+
+// CleanUpValue clears value, the already computed challenge digest, from the domain.
+func (s *Solver) CleanUpValue(ctx context.Context, domain, value string) error {
+	name, err := Domain(domain)
+	if err != nil {
+		return err
+	}
+	client, err := s.client(name)
+	if err != nil {
+		return err
+	}
+	if s.heldByOther(name, value) {
+		// the single TXT record holds the value of the other challenge
+		klog.Infof("Skipping the clean up of the DNS-01 challenge of %v, another challenge is presented", domain)
+		return nil
+	}
+	defer s.unlock(name, value)
+
+	klog.Infof("Cleaning up the DNS-01 challenge of %v", domain)
+	if _, err := duckdns.Check(client.ClearRecord(ctx, value)); err != nil {
+		return fmt.Errorf("Unable to clear the TXT record of %v, %w", domain, err)
+	}
+	return nil
+}
+
+// Timeout returns the propagation timeout and the poll interval, as expected by lego.
+func (s *Solver) Timeout() (time.Duration, time.Duration) {
+	return s.timeout(), s.PollInterval
+}
+
+// Sequential tells lego to solve the challenges one after the other.
+func (s *Solver) Sequential() time.Duration {
+	return s.PollInterval
+}
+
+func (s *Solver) timeout() time.Duration {
+	if s.PropagationTimeout <= 0 {
+		return defaultPropagationTimeout
+	}
+	return s.PropagationTimeout
+}
+
+func (s *Solver) lockTimeout() time.Duration {
+	if s.LockTimeout <= 0 {
+		return defaultLockTimeout
+	}
+	return s.LockTimeout
+}
+
+func (s *Solver) client(name string) (*duckdns.Client, error) {
+	config := &duckdns.Config{Token: s.Token, DomainNames: []string{name}}
+	if !config.Valid() {
+		return nil, errors.New("duckdns token is empty")
+	}
+
+	client := duckdns.NewClient(s.httpClient, config)
+	if s.BaseURL != "" {
+		client.BaseURL = s.BaseURL
+	}
+	client.Limiter = s.Limiter
+	return client, nil
+}
+
+// lock waits until no other challenge of the domain is presented and takes the domain for
+// the challenge of value, it returns false when the challenge already holds the domain. The
+// lock of a challenge never cleaned up expires after the lock timeout.
+func (s *Solver) lock(ctx context.Context, name, value string) (bool, error) {
+	for {
+		s.mu.Lock()
+		l := s.locks[name]
+		if l != nil && l.value != value && time.Since(l.since) >= s.lockTimeout() {
+			klog.Warningf("Releasing %v, its DNS-01 challenge was not cleaned up within %v", name, s.lockTimeout())
+			delete(s.locks, name)
+			close(l.released)
+			l = nil
+		}
+		switch {
+		case l == nil:
+			s.locks[name] = &lock{value: value, since: time.Now(), released: make(chan struct{})}
+			s.mu.Unlock()
+			return true, nil
+		case l.value == value:
+			s.mu.Unlock()
+			return false, nil
+		}
+		s.mu.Unlock()
+
+		if s.NoWait {
+			return false, errors.New("another challenge of the domain is presented, try again once it is cleaned up")
+		}
+		expired := time.NewTimer(s.lockTimeout() - time.Since(l.since))
+		select {
+		case <-l.released:
+		case <-expired.C:
+		case <-ctx.Done():
+			expired.Stop()
+			return false, ctx.Err()
+		}
+		expired.Stop()
+	}
+}
+
+// heldByOther returns whether a challenge other than the one of value holds the domain
+func (s *Solver) heldByOther(name, value string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.locks[name]
+	return l != nil && l.value != value
+}
+
+// unlock releases the domain when the challenge of value holds it, the challenges that
+// never took the domain leave it to its holder
+func (s *Solver) unlock(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l := s.locks[name]; l != nil && l.value == value {
+		delete(s.locks, name)
+		close(l.released)
+	}
+}
@@ -0,0 +1,249 @@
+package dns01
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+// fakeDuckDNS stores the TXT record set through /update and serves it over DNS
+type fakeDuckDNS struct {
+	mu     sync.Mutex
+	txt    map[string]string
+	active int
+	max    int
+
+	api *httptest.Server
+	dns string
+}
+
+func newFakeDuckDNS(t *testing.T) *fakeDuckDNS {
+	f := &fakeDuckDNS{txt: make(map[string]string)}
+
+	f.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("token") != "example-token" {
+			fmt.Fprint(w, "KO")
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		domain := q.Get("domains")
+		if q.Get("clear") == "true" {
+			delete(f.txt, domain)
+			f.active--
+		} else {
+			f.txt[domain] = q.Get("txt")
+			f.active++
+			if f.active > f.max {
+				f.max = f.active
+			}
+		}
+		fmt.Fprint(w, "OK")
+	}))
+	t.Cleanup(f.api.Close)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		name := r.Question[0].Name
+		domain, _ := Domain(name)
+		f.mu.Lock()
+		if value, ok := f.txt[domain]; ok {
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+				Txt: []string{value},
+			})
+		}
+		f.mu.Unlock()
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	f.dns = pc.LocalAddr().String()
+
+	return f
+}
+
+func (f *fakeDuckDNS) record(domain string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.txt[domain]
+	return value, ok
+}
+
+func (f *fakeDuckDNS) solver(token string) *Solver {
+	s := NewSolver(f.api.Client(), token)
+	s.BaseURL = f.api.URL
+	s.Resolvers = []duckdns.Resolver{&duckdns.DNSResolver{Servers: []string{f.dns}}}
+	s.PollInterval = 10 * time.Millisecond
+	s.PropagationTimeout = 5 * time.Second
+	return s
+}
+
+func TestChallengeValue(t *testing.T) {
+	// echo -n token.thumbprint | openssl dgst -sha256 -binary | base64 | tr '+/' '-_' | tr -d '='
+	if want, got := "61rBZ_4knHblO0MNoxFsXZ_eTFUHum0B6IVRbhvUn5I", ChallengeValue("token.thumbprint"); want != got {
+		t.Errorf("ChallengeValue() expected %v, got %v", want, got)
+	}
+}
+
+func TestDomain(t *testing.T) {
+	for identifier, want := range map[string]string{
+		"example.duckdns.org":                      "example",
+		"*.example.duckdns.org":                    "example",
+		"_acme-challenge.www.example.duckdns.org.": "example",
+		"EXAMPLE.duckdns.org":                      "example",
+	} {
+		if got, err := Domain(identifier); err != nil || got != want {
+			t.Errorf("Domain(%v) expected %v, got %v, %v", identifier, want, got, err)
+		}
+	}
+
+	if _, err := Domain("example.com"); err == nil {
+		t.Errorf("Domain() expected an error for a domain outside duckdns.org")
+	}
+}
+
+func TestPresentCleanUp(t *testing.T) {
+	f := newFakeDuckDNS(t)
+	s := f.solver("example-token")
+
+	if err := s.Present("example.duckdns.org", "token", "token.thumbprint"); err != nil {
+		t.Fatalf("Present() returned error: %v", err)
+	}
+	if value, _ := f.record("example"); value != ChallengeValue("token.thumbprint") {
+		t.Errorf("Present() expected TXT %v, got %v", ChallengeValue("token.thumbprint"), value)
+	}
+
+	if err := s.CleanUp("example.duckdns.org", "token", "token.thumbprint"); err != nil {
+		t.Fatalf("CleanUp() returned error: %v", err)
+	}
+	if _, ok := f.record("example"); ok {
+		t.Errorf("CleanUp() expected the TXT record to be cleared")
+	}
+}
+
+func TestPresentKO(t *testing.T) {
+	f := newFakeDuckDNS(t)
+	s := f.solver("wrong-token")
+
+	var rejected *provider.Error
+	if err := s.Present("example.duckdns.org", "token", "token.thumbprint"); !errors.As(err, &rejected) || rejected.Code != "KO" {
+		t.Errorf("Present() expected to return a KO provider error, got %v", err)
+	}
+
+	// the failed challenge must not hold the domain
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := s.lock(ctx, "example", "other"); err != nil {
+		t.Errorf("Present() expected to release the domain on error, got %v", err)
+	}
+}
+
+func TestCleanUpOtherChallenge(t *testing.T) {
+	f := newFakeDuckDNS(t)
+	s := f.solver("example-token")
+
+	if err := s.Present("example.duckdns.org", "token", "token1.thumbprint"); err != nil {
+		t.Fatalf("Present() returned error: %v", err)
+	}
+	// the clean up of a challenge that never presented its value, after a failed Present
+	if err := s.CleanUp("*.example.duckdns.org", "token", "token2.thumbprint"); err != nil {
+		t.Fatalf("CleanUp() returned error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.lock(ctx, "example", "other"); err == nil {
+		t.Errorf("CleanUp() of another challenge expected to keep the domain held")
+	}
+	if value, _ := f.record("example"); value != ChallengeValue("token1.thumbprint") {
+		t.Errorf("CleanUp() of another challenge expected to keep the TXT record, got %q", value)
+	}
+
+	if err := s.CleanUp("example.duckdns.org", "token", "token1.thumbprint"); err != nil {
+		t.Fatalf("CleanUp() returned error: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.locks) != 0 {
+		t.Errorf("Expected the released domains to be forgotten, got %v", s.locks)
+	}
+}
+
+func TestPresentNoWait(t *testing.T) {
+	f := newFakeDuckDNS(t)
+	s := f.solver("example-token")
+	s.NoWait = true
+	s.LockTimeout = 100 * time.Millisecond
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := s.PresentValue(ctx, "example.duckdns.org", "value1"); err != nil {
+			t.Fatalf("PresentValue() %d returned error: %v", i, err)
+		}
+	}
+	f.mu.Lock()
+	if f.max != 1 {
+		t.Errorf("Presenting the same challenge again expected to do nothing, %v updates were sent", f.max)
+	}
+	f.mu.Unlock()
+
+	start := time.Now()
+	if err := s.PresentValue(ctx, "*.example.duckdns.org", "value2"); err == nil || time.Since(start) > time.Second {
+		t.Errorf("PresentValue() of another challenge expected to fail at once, got %v after %v", err, time.Since(start))
+	}
+
+	// the first challenge is never cleaned up
+	time.Sleep(s.LockTimeout)
+	if err := s.PresentValue(ctx, "*.example.duckdns.org", "value2"); err != nil {
+		t.Errorf("PresentValue() expected to take over the expired challenge, got %v", err)
+	}
+	if value, _ := f.record("example"); value != "value2" {
+		t.Errorf("Expected the TXT record of the second challenge, got %q", value)
+	}
+}
+
+func TestConcurrentChallengesAreSerialized(t *testing.T) {
+	f := newFakeDuckDNS(t)
+	s := f.solver("example-token")
+
+	var wg sync.WaitGroup
+	for i, domain := range []string{"example.duckdns.org", "*.example.duckdns.org", "www.example.duckdns.org"} {
+		wg.Add(1)
+		go func(domain, keyAuth string) {
+			defer wg.Done()
+			if err := s.Present(domain, "token", keyAuth); err != nil {
+				t.Errorf("Present(%v) returned error: %v", domain, err)
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+			if err := s.CleanUp(domain, "token", keyAuth); err != nil {
+				t.Errorf("CleanUp(%v) returned error: %v", domain, err)
+			}
+		}(domain, fmt.Sprintf("token%d.thumbprint", i))
+	}
+	wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.max != 1 {
+		t.Errorf("Challenges of the same domain expected to be serialized, %v were presented at once", f.max)
+	}
+}
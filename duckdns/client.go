@@ -6,10 +6,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"k8s.io/klog/v2"
-	"net"
 	"net/http"
-	"strconv"
+	"net/url"
 	"strings"
+	"sync"
 )
 
 const (
@@ -17,13 +17,8 @@ const (
 	Version = "1.0.3"
 
 	defaultBaseURL = "https://www.duckdns.org"
-	domainStub     = "/update?domains="
-	tokenStub      = "&token="
-	ip4Stub        = "&ip="
-	ip6Stub        = "&ipv6="
-	txtStub        = "&txt="
-	verboseStub    = "&verbose="
-	clearStub      = "&clear="
+	updatePath     = "/update"
+	maskedToken    = "*********"
 
 	defaultUserAgent = "duckdns-go/" + Version
 )
@@ -34,6 +29,27 @@ type Response struct {
 	Data         string
 }
 
+//Result structure containing the parsed data of a duckdns response
+type Result struct {
+	OK      bool
+	IPv4    string
+	IPv6    string
+	Changed bool
+}
+
+//ParseResult function to parse the body of a duckdns response, the IPs and the
+//change flag are only filled for verbose responses
+func ParseResult(data string) *Result {
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	result := &Result{OK: lines[0] == "OK"}
+	if len(lines) >= 4 {
+		result.IPv4 = lines[1]
+		result.IPv6 = lines[2]
+		result.Changed = lines[3] == "UPDATED"
+	}
+	return result
+}
+
 //Config structure containing the client configuration
 type Config struct {
 	DomainNames []string
@@ -56,6 +72,11 @@ type Client struct {
 	httpClient *http.Client
 	BaseURL    string
 	UserAgent  string
+	Resolver   Resolver
+	//DryRun records the requests instead of sending them when set
+	DryRun *DryRun
+	//Limiter rate limits the requests of the token when set
+	Limiter *Limiter
 
 	Config *Config
 }
@@ -69,42 +90,103 @@ func NewClient(httpClient *http.Client, config *Config) *Client {
 	c := &Client{httpClient: httpClient,
 		BaseURL:   defaultBaseURL,
 		UserAgent: defaultUserAgent,
+		Resolver:  &SystemResolver{},
 		Config:    config}
 	return c
 }
 
+//DryRun structure recording the requests of a client instead of sending them, every
+//request is answered OK
+type DryRun struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (d *DryRun) add(url string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.urls = append(d.urls, url)
+}
+
+//Requests function returning the URLs of the requests not sent, with the token masked
+func (d *DryRun) Requests() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.urls...)
+}
+
+//WithDomains function to return a copy of the client updating the given domains only
+func (c *Client) WithDomains(domains ...string) *Client {
+	config := *c.Config
+	config.DomainNames = domains
+
+	client := *c
+	client.Config = &config
+	return &client
+}
+
 //SetUserAgent function to set a custom header for the UserAgent
 func (c *Client) SetUserAgent(ua string) {
 	c.UserAgent = ua
 }
 
+//SetResolver function to set the resolver used for the DNS lookups
+func (c *Client) SetResolver(r Resolver) {
+	c.Resolver = r
+}
+
 //SetVerbose function to set the response of the client request to verbose=true
 func (c *Config) SetVerbose(verbose bool) {
 	c.Verbose = verbose
 }
 
-func (c *Client) makeGetRequest(ctx context.Context, path, pathObf string, response *Response) (*http.Response, error) {
+//makeGetRequest function sending the request of kind, "IP update" or "TXT update"
+func (c *Client) makeGetRequest(ctx context.Context, kind, path, pathObf string, response *Response) (*http.Response, error) {
+	if c.DryRun != nil {
+		c.DryRun.add(c.BaseURL + pathObf)
+		klog.Infof("Dry run, not sending the request to %v", c.BaseURL+pathObf)
+		if response != nil {
+			response.Data = "OK"
+		}
+		return nil, nil
+	}
+
+	if c.Limiter != nil {
+		kind = fmt.Sprintf("%v of %v", kind, strings.Join(c.Config.DomainNames, ","))
+		if err := c.Limiter.Wait(ctx, c.Config.Token, kind); err != nil {
+			return nil, err
+		}
+	}
 
 	req, err := c.newRequest(http.MethodGet, path, pathObf)
 	if err != nil {
-		return nil, err
+		return nil, c.maskURL(err, pathObf)
 	}
 
 	resp, err := c.request(ctx, req, response)
 	if err != nil {
-		return nil, err
+		return nil, c.maskURL(err, pathObf)
 	}
 
 	return resp, nil
 }
 
+//maskURL function replacing the URL of a *url.Error, which has the token, with the masked one
+func (c *Client) maskURL(err error, pathObf string) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = c.BaseURL + pathObf
+	}
+	return err
+}
+
 func (c *Client) newRequest(method, path, pathObf string) (*http.Request, error) {
-	url := c.BaseURL + path
+	reqURL := c.BaseURL + path
 	urlObf := c.BaseURL + pathObf
 
 	klog.Infof("Sending request to %v", urlObf)
 
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequest(method, reqURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -128,6 +210,7 @@ func (c *Client) request(ctx context.Context, req *http.Request, response *Respo
 	defer resp.Body.Close()
 
 	if response != nil {
+		response.HTTPResponse = resp
 		bytes, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return resp, err
@@ -138,19 +221,37 @@ func (c *Client) request(ctx context.Context, req *http.Request, response *Respo
 	return resp, err
 }
 
-//UpdateIP function to update IPv4 and/or without IP address
-func (c *Client) UpdateIP(ctx context.Context) (*Response, error) {
-	subdomains := strings.Join(c.Config.DomainNames, ",")
-	url := fmt.Sprintf("%s%s%s%s%s", domainStub, subdomains, tokenStub, c.Config.Token, ip4Stub)
-	urlObf := fmt.Sprintf("%s%s%s%s%s", domainStub, subdomains, tokenStub, "*********", ip4Stub)
+//param structure of a query parameter
+type param struct {
+	key, value string
+}
 
+//updatePaths function building the path of an update of the client domains with params,
+//and the same path with the token masked for the logs. The values are query escaped and
+//kept in their order, after the domains and the token.
+func (c *Client) updatePaths(params ...param) (string, string) {
+	domains := make([]string, len(c.Config.DomainNames))
+	for i, domain := range c.Config.DomainNames {
+		domains[i] = url.QueryEscape(domain)
+	}
 	if c.Config.Verbose {
-		url = fmt.Sprintf("%s%s%s", url, verboseStub, strconv.FormatBool(c.Config.Verbose))
-		urlObf = fmt.Sprintf("%s%s%s", urlObf, verboseStub, strconv.FormatBool(c.Config.Verbose))
+		params = append(params, param{"verbose", "true"})
+	}
+
+	var query strings.Builder
+	for _, p := range params {
+		query.WriteString("&" + url.QueryEscape(p.key) + "=" + url.QueryEscape(p.value))
 	}
+	prefix := updatePath + "?domains=" + strings.Join(domains, ",") + "&token="
+	return prefix + url.QueryEscape(c.Config.Token) + query.String(), prefix + maskedToken + query.String()
+}
+
+//UpdateIP function to update IPv4 and/or without IP address
+func (c *Client) UpdateIP(ctx context.Context) (*Response, error) {
+	path, pathObf := c.updatePaths(param{"ip", ""})
 
 	response := &Response{}
-	resp, err := c.makeGetRequest(ctx, url, urlObf, response)
+	resp, err := c.makeGetRequest(ctx, "IP update", path, pathObf, response)
 
 	if err != nil {
 		return response, err
@@ -162,89 +263,75 @@ func (c *Client) UpdateIP(ctx context.Context) (*Response, error) {
 
 //UpdateIPWithValues to update IPv4 and/or with IP address
 func (c *Client) UpdateIPWithValues(ctx context.Context, ipv4, ipv6 string) (*Response, error) {
-	subdomains := strings.Join(c.Config.DomainNames, ",")
-	url := fmt.Sprintf("%s%s%s%s%s", domainStub, subdomains, tokenStub, c.Config.Token, ip4Stub)
-	urlObf := fmt.Sprintf("%s%s%s%s%s", domainStub, subdomains, tokenStub, "*********", ip4Stub)
-
-	if ipv6 == "" {
-		url = fmt.Sprintf("%s%s", url, ipv4)
-		urlObf = fmt.Sprintf("%s%s", urlObf, ipv4)
-	} else {
-		url = fmt.Sprintf("%s%s%s%s", url, ipv4, ip6Stub, ipv6)
-		urlObf = fmt.Sprintf("%s%s%s%s", urlObf, ipv4, ip6Stub, ipv6)
-	}
-
-	if c.Config.Verbose {
-		url = fmt.Sprintf("%s%s%s", url, verboseStub, strconv.FormatBool(c.Config.Verbose))
-		urlObf = fmt.Sprintf("%s%s%s", urlObf, verboseStub, strconv.FormatBool(c.Config.Verbose))
+	params := []param{{"ip", ipv4}}
+	if ipv6 != "" {
+		params = append(params, param{"ipv6", ipv6})
 	}
+	path, pathObf := c.updatePaths(params...)
 
 	resp := &Response{}
-	_, err := c.makeGetRequest(ctx, url, urlObf, resp)
+	_, err := c.makeGetRequest(ctx, "IP update", path, pathObf, resp)
 
 	return resp, err
 }
 
 //ClearIP function that clears the IP from duckdns system
 func (c *Client) ClearIP(ctx context.Context) (*Response, error) {
-	subdomains := strings.Join(c.Config.DomainNames, ",")
-	url := fmt.Sprintf("%s%s%s%s%s%s", domainStub, subdomains, tokenStub, c.Config.Token, clearStub, "true")
-	urlObf := fmt.Sprintf("%s%s%s%s%s%s", domainStub, subdomains, tokenStub, "*********", clearStub, "true")
+	path, pathObf := c.updatePaths(param{"clear", "true"})
 
-	if c.Config.Verbose {
-		url = fmt.Sprintf("%s%s%s", url, verboseStub, strconv.FormatBool(c.Config.Verbose))
-		urlObf = fmt.Sprintf("%s%s%s", urlObf, verboseStub, strconv.FormatBool(c.Config.Verbose))
+	resp := &Response{}
+	_, err := c.makeGetRequest(ctx, "IP update", path, pathObf, resp)
+
+	return resp, err
+}
+
+//UpdateIPv6 function publishing the IPv6 of the domains without publishing the IPv4 of the
+//caller, which duckdns does when ip is empty: with keepIPv4 the current IPv4 of the first
+//domain is sent along, else or when it has none the IPs are cleared and ipv6 is sent alone
+func (c *Client) UpdateIPv6(ctx context.Context, ipv6 string, keepIPv4 bool) (*Response, error) {
+	if keepIPv4 {
+		current, err := c.Resolver.LookupIP(ctx, "ip4", c.Config.DomainNames[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(current) > 0 {
+			return c.UpdateIPWithValues(ctx, current[0], ipv6)
+		}
+	}
+	if _, err := Check(c.ClearIP(ctx)); err != nil {
+		return nil, err
 	}
+	path, pathObf := c.updatePaths(param{"ipv6", ipv6})
 
 	resp := &Response{}
-	_, err := c.makeGetRequest(ctx, url, urlObf, resp)
+	_, err := c.makeGetRequest(ctx, "IP update", path, pathObf, resp)
 
 	return resp, err
 }
 
 //UpdateRecord function to update TXT record
 func (c *Client) UpdateRecord(ctx context.Context, record string) (*Response, error) {
-	subdomains := strings.Join(c.Config.DomainNames, ",")
-	url := fmt.Sprintf("%s%s%s%s%s%s", domainStub, subdomains, tokenStub, c.Config.Token, txtStub, record)
-	urlObf := fmt.Sprintf("%s%s%s%s%s%s", domainStub, subdomains, tokenStub, "*********", txtStub, record)
-
-	if c.Config.Verbose {
-		url = fmt.Sprintf("%s%s%s", url, verboseStub, strconv.FormatBool(c.Config.Verbose))
-		urlObf = fmt.Sprintf("%s%s%s", urlObf, verboseStub, strconv.FormatBool(c.Config.Verbose))
-	}
+	path, pathObf := c.updatePaths(param{"txt", record})
 
 	resp := &Response{}
-	_, err := c.makeGetRequest(ctx, url, urlObf, resp)
+	_, err := c.makeGetRequest(ctx, "TXT update", path, pathObf, resp)
 
 	return resp, err
 }
 
 //ClearRecord function to clear TXT record
 func (c *Client) ClearRecord(ctx context.Context, record string) (*Response, error) {
-	subdomains := strings.Join(c.Config.DomainNames, ",")
-	url := fmt.Sprintf("%s%s%s%s%s%s%s%s", domainStub, subdomains, tokenStub, c.Config.Token, txtStub, record, clearStub, "true")
-	urlObf := fmt.Sprintf("%s%s%s%s%s%s%s%s", domainStub, subdomains, tokenStub, "*********", txtStub, record, clearStub, "true")
-
-	if c.Config.Verbose {
-		url = fmt.Sprintf("%s%s%s", url, verboseStub, strconv.FormatBool(c.Config.Verbose))
-		urlObf = fmt.Sprintf("%s%s%s", urlObf, verboseStub, strconv.FormatBool(c.Config.Verbose))
-	}
+	path, pathObf := c.updatePaths(param{"txt", record}, param{"clear", "true"})
 
 	resp := &Response{}
-	_, err := c.makeGetRequest(ctx, url, urlObf, resp)
+	_, err := c.makeGetRequest(ctx, "TXT update", path, pathObf, resp)
 
 	return resp, err
 }
 
 //GetRecord function to get TXT record like dig+ <domain> TXT
-func (c *Client) GetRecord() (string, error) {
-	var subdomains string
-	if strings.Contains(c.Config.DomainNames[0], "duckdns.org") {
-		subdomains = c.Config.DomainNames[0]
-	} else {
-		subdomains = c.Config.DomainNames[0] + ".duckdns.org"
-	}
-	txt, err := net.LookupTXT(subdomains)
+func (c *Client) GetRecord(ctx context.Context) (string, error) {
+	txt, err := c.Resolver.LookupTXT(ctx, c.Config.DomainNames[0])
 	if err != nil {
 		return "", fmt.Errorf("Unable to get txt record, %v", err)
 	}
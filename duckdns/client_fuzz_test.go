@@ -0,0 +1,44 @@
+//go:build go1.18
+// +build go1.18
+
+package duckdns
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// FuzzUpdatePaths checks that any record and list of domains, given one per line, is sent
+// unchanged and that the token never appears in the masked path.
+func FuzzUpdatePaths(f *testing.F) {
+	f.Add("docusign=1b0a6754-49b1-4db5-8540-d2c12664b289", "example")
+	f.Add("a&clear=true", "example\nother")
+	f.Add("1+1=2 100%", "café")
+	f.Add("#?\x00\xff", "")
+
+	f.Fuzz(func(t *testing.T, record, domains string) {
+		names := strings.Split(domains, "\n")
+		for _, name := range names {
+			// the commas separate the domains
+			if strings.Contains(name, ",") {
+				t.Skip()
+			}
+		}
+		c := &Client{Config: &Config{DomainNames: names, Token: "secret-token"}}
+
+		path, pathObf := c.updatePaths(param{"txt", record}, param{"clear", "true"})
+		u, err := url.Parse(defaultBaseURL + path)
+		if err != nil {
+			t.Fatalf("Unable to parse %q: %v", path, err)
+		}
+		want := url.Values{"domains": {strings.Join(names, ",")}, "token": {"secret-token"}, "txt": {record}, "clear": {"true"}}
+		if got := u.Query(); !reflect.DeepEqual(want, got) {
+			t.Errorf("Expected the query %v, got %v", want, got)
+		}
+		if strings.Contains(pathObf, "secret-token") {
+			t.Errorf("Expected the token to be masked, got %q", pathObf)
+		}
+	})
+}
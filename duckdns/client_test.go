@@ -3,6 +3,8 @@ package duckdns
 import (
 	"bufio"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -11,6 +13,8 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/miekg/dns"
 )
 
 var (
@@ -249,6 +253,51 @@ func TestClearIP(t *testing.T) {
 	}
 }
 
+type ipResolver struct {
+	SystemResolver
+	ipv4 []string
+}
+
+func (r *ipResolver) LookupIP(ctx context.Context, network, domain string) ([]string, error) {
+	return r.ipv4, nil
+}
+
+func TestUpdateIPv6(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		ipv4     []string
+		keepIPv4 bool
+		want     []string
+	}{
+		{"current IPv4 kept", []string{"10.10.10.253"}, true, []string{"ip=10.10.10.253&ipv6=%3A%3A1"}},
+		{"no current IPv4", nil, true, []string{"clear=true", "ipv6=%3A%3A1"}},
+		{"IPv4 not kept", []string{"10.10.10.253"}, false, []string{"clear=true", "ipv6=%3A%3A1"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			setupMockServer()
+			defer teardownMockServer()
+
+			var queries []string
+			mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				queries = append(queries, strings.TrimPrefix(r.URL.RawQuery, "domains=example&token=example-token&"))
+				fmt.Fprint(w, "OK")
+			})
+			client.SetResolver(&ipResolver{ipv4: test.ipv4})
+
+			resp, err := client.UpdateIPv6(context.Background(), "::1", test.keepIPv4)
+			if err != nil {
+				t.Fatalf("UpdateIPv6() returned error: %v", err)
+			}
+			if want, got := "OK", resp.Data; want != got {
+				t.Errorf("UpdateIPv6() expected to return %v, got %v", want, got)
+			}
+			if want, got := strings.Join(test.want, " "), strings.Join(queries, " "); want != got {
+				t.Errorf("UpdateIPv6() expected to send %v, got %v", want, got)
+			}
+		})
+	}
+}
+
 func TestUpdateRecord(t *testing.T) {
 	setupMockServer()
 	defer teardownMockServer()
@@ -309,3 +358,131 @@ func TestClearRecord(t *testing.T) {
 		t.Errorf("UpdateRecord() expected to return %v, got %v", want, got)
 	}
 }
+
+func TestUpdateRecord_Escaping(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	var got url.Values
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		fmt.Fprint(w, "OK")
+	})
+
+	records := []string{
+		"a&clear=true",
+		"1+1=2",
+		"hello world",
+		"caf\u00e9 \u2603",
+		"100% #1?",
+		"Zm9vYmFy-_w",
+		"",
+	}
+	for _, record := range records {
+		if _, err := client.ClearRecord(context.Background(), record); err != nil {
+			t.Fatalf("ClearRecord(%q) returned error: %v", record, err)
+		}
+		want := url.Values{"domains": {"example"}, "token": {"example-token"}, "txt": {record}, "clear": {"true"}}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("ClearRecord(%q) expected the query %v, got %v", record, want, got)
+		}
+	}
+
+	c := client.WithDomains("example", "other")
+	c.Config.Token = "a+b&c"
+	if _, err := c.UpdateIPWithValues(context.Background(), "10.10.10.253", "2001:db8::1"); err != nil {
+		t.Fatalf("UpdateIPWithValues() returned error: %v", err)
+	}
+	want := url.Values{"domains": {"example,other"}, "token": {"a+b&c"}, "ip": {"10.10.10.253"}, "ipv6": {"2001:db8::1"}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("UpdateIPWithValues() expected the query %v, got %v", want, got)
+	}
+}
+
+func TestClient_ErrorMasksToken(t *testing.T) {
+	setupMockServer()
+	teardownMockServer()
+
+	for _, call := range []func() (*Response, error){
+		func() (*Response, error) { return client.UpdateIP(context.Background()) },
+		func() (*Response, error) { return client.UpdateRecord(context.Background(), "value") },
+	} {
+		_, err := call()
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			t.Fatalf("Expected a *url.Error once the server is closed, got %v", err)
+		}
+		if strings.Contains(err.Error(), "example-token") || !strings.Contains(err.Error(), "token="+maskedToken) {
+			t.Errorf("Expected the token masked in the error, got %v", err)
+		}
+	}
+
+	client.BaseURL = "http://%zz"
+	if _, err := client.UpdateIP(context.Background()); err == nil || strings.Contains(err.Error(), "example-token") {
+		t.Errorf("Expected an error without the token for an invalid URL, got %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("No request expected in dry run, got %v", r.URL)
+	})
+	client.DryRun = &DryRun{}
+
+	resp, err := client.UpdateIPWithValues(context.Background(), "10.10.10.253", "")
+	if err != nil {
+		t.Fatalf("UpdateIPWithValues() returned error: %v", err)
+	}
+	if !ParseResult(resp.Data).OK {
+		t.Errorf("UpdateIPWithValues() expected to answer OK in dry run, got %v", resp.Data)
+	}
+	client.UpdateRecord(context.Background(), "value")
+
+	want := []string{
+		server.URL + "/update?domains=example&token=*********&ip=10.10.10.253",
+		server.URL + "/update?domains=example&token=*********&txt=value",
+	}
+	if got := client.DryRun.Requests(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Requests() expected %v, got %v", want, got)
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	result := ParseResult("OK\n10.10.10.253\n0:0:0:0:0:ffff:a0a:afd\nNOCHANGE")
+	if !result.OK || result.IPv4 != "10.10.10.253" || result.IPv6 != "0:0:0:0:0:ffff:a0a:afd" || result.Changed {
+		t.Errorf("ParseResult() returned unexpected result %+v", result)
+	}
+
+	result = ParseResult("OK\n1.2.3.4\n\nUPDATED")
+	if !result.OK || result.IPv4 != "1.2.3.4" || !result.Changed {
+		t.Errorf("ParseResult() returned unexpected result %+v", result)
+	}
+
+	if result := ParseResult("KO"); result.OK {
+		t.Errorf("ParseResult() expected KO, got %+v", result)
+	}
+}
+
+func TestGetRecord(t *testing.T) {
+	addr := startDNSServer(t, "udp", func(r *dns.Msg) *dns.Msg {
+		return txtReply(r, "docusign=1b0a6754-49b1-4db5-8540-d2c12664b289")
+	})
+
+	config := &Config{}
+	config.Token = "example-token"
+	config.DomainNames = []string{"example"}
+	c := NewClient(http.DefaultClient, config)
+	c.SetResolver(&DNSResolver{Servers: []string{addr}})
+
+	record, err := c.GetRecord(context.Background())
+	if err != nil {
+		t.Fatalf("GetRecord() returned error: %v", err)
+	}
+
+	if want, got := "docusign=1b0a6754-49b1-4db5-8540-d2c12664b289", record; want != got {
+		t.Errorf("GetRecord() expected to return %v, got %v", want, got)
+	}
+}
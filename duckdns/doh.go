@@ -0,0 +1,195 @@
+package duckdns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	dohWireType = "application/dns-message"
+	dohJSONType = "application/dns-json"
+)
+
+//DoHResolver structure querying a DNS-over-HTTPS endpoint (RFC 8484) with the wire or the JSON format
+type DoHResolver struct {
+	URL     string
+	JSON    bool
+	Timeout time.Duration
+
+	httpClient *http.Client
+}
+
+type dohJSONResponse struct {
+	Status int
+	Answer []struct {
+		Name string `json:"name"`
+		Type uint16 `json:"type"`
+		TTL  uint32 `json:"TTL"`
+		Data string `json:"data"`
+	}
+}
+
+//NewDoHResolver function to return a DNS-over-HTTPS resolver using the given http client
+func NewDoHResolver(httpClient *http.Client, url string, jsonFormat bool) *DoHResolver {
+	return &DoHResolver{URL: url, JSON: jsonFormat, httpClient: httpClient}
+}
+
+//String function returning the name of the resolver
+func (r *DoHResolver) String() string {
+	if r.JSON {
+		return "https+json://" + strings.TrimPrefix(r.URL, "https://")
+	}
+	return r.URL
+}
+
+//LookupTXT function to get the TXT records from the DNS-over-HTTPS endpoint
+func (r *DoHResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	answers, err := r.lookup(ctx, domain, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	return txtValues(answers), nil
+}
+
+//LookupIP function to get the A or AAAA records from the DNS-over-HTTPS endpoint
+func (r *DoHResolver) LookupIP(ctx context.Context, network, domain string) ([]string, error) {
+	answers, err := r.lookup(ctx, domain, ipType(network))
+	if err != nil {
+		return nil, err
+	}
+	return ipValues(answers), nil
+}
+
+func (r *DoHResolver) lookup(ctx context.Context, domain string, qtype uint16) ([]dns.RR, error) {
+	ctx, cancel := withTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	var answers []dns.RR
+	var err error
+	if r.JSON {
+		answers, err = r.lookupJSON(ctx, domain, qtype)
+	} else {
+		answers, err = r.lookupWire(ctx, domain, qtype)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to lookup %v %v, %v", FQDN(domain), dns.TypeToString[qtype], err)
+	}
+	return answers, nil
+}
+
+func (r *DoHResolver) lookupWire(ctx context.Context, domain string, qtype uint16) ([]dns.RR, error) {
+	m := newQuery(domain, qtype, true)
+	//RFC 8484 4.1, the ID should be 0 to be cache friendly
+	m.Id = 0
+	packed, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.URL, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohWireType)
+	req.Header.Set("Accept", dohWireType)
+
+	body, err := r.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(body); err != nil {
+		return nil, err
+	}
+	return answersOf(resp, r.URL)
+}
+
+func (r *DoHResolver) lookupJSON(ctx context.Context, domain string, qtype uint16) ([]dns.RR, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("name", dns.Fqdn(FQDN(domain)))
+	q.Set("type", dns.TypeToString[qtype])
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dohJSONType)
+
+	body, err := r.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp dohJSONResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != dns.RcodeSuccess {
+		return answersOf(&dns.Msg{MsgHdr: dns.MsgHdr{Rcode: resp.Status}}, r.URL)
+	}
+
+	var answers []dns.RR
+	for _, a := range resp.Answer {
+		data := a.Data
+		if a.Type == dns.TypeTXT && !strings.HasPrefix(data, `"`) {
+			data = strconv.Quote(data)
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(a.Name), a.TTL, dns.TypeToString[a.Type], data))
+		if err != nil {
+			return nil, err
+		}
+		if rr != nil {
+			answers = append(answers, rr)
+		}
+	}
+	return answers, nil
+}
+
+func (r *DoHResolver) do(ctx context.Context, req *http.Request) ([]byte, error) {
+	httpClient := r.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v answered %v", r.URL, resp.Status)
+	}
+	return body, nil
+}
+
+func dohClient(tlsConfig *tls.Config) *http.Client {
+	if tlsConfig == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}}
+}
@@ -0,0 +1,134 @@
+package duckdns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDoHResolver_Wire(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		testHeader(t, r, "Content-Type", dohWireType)
+
+		body, _ := ioutil.ReadAll(r.Body)
+		m := new(dns.Msg)
+		if err := m.Unpack(body); err != nil {
+			t.Fatalf("Unable to unpack the DoH query: %v", err)
+		}
+		if m.Id != 0 {
+			t.Errorf("DoH query ID expected to be 0, got %v", m.Id)
+		}
+
+		packed, _ := txtReply(m, "hello").Pack()
+		w.Header().Set("Content-Type", dohWireType)
+		w.Write(packed)
+	}))
+	defer server.Close()
+
+	r := NewDoHResolver(server.Client(), server.URL+"/dns-query", false)
+	txt, err := r.LookupTXT(context.Background(), "example")
+	if err != nil {
+		t.Fatalf("LookupTXT() returned error: %v", err)
+	}
+	if len(txt) != 1 || txt[0] != "hello" {
+		t.Errorf("LookupTXT() expected [hello], got %v", txt)
+	}
+}
+
+func TestDoHResolver_JSON(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		testHeader(t, r, "Accept", dohJSONType)
+
+		name, qtype := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+		if name != "example.duckdns.org." {
+			t.Errorf("DoH JSON name expected to be example.duckdns.org., got %v", name)
+		}
+
+		answer := map[string]interface{}{"name": name, "TTL": 60}
+		switch qtype {
+		case "TXT":
+			answer["type"], answer["data"] = dns.TypeTXT, `"hello world"`
+		case "A":
+			answer["type"], answer["data"] = dns.TypeA, "10.10.10.253"
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"Status": dns.RcodeNameError})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Status": 0, "Answer": []interface{}{answer}})
+	}))
+	defer server.Close()
+
+	r := NewDoHResolver(server.Client(), server.URL+"/resolve", true)
+	txt, err := r.LookupTXT(context.Background(), "example")
+	if err != nil || len(txt) != 1 || txt[0] != "hello world" {
+		t.Errorf("LookupTXT() expected [hello world], got %v, %v", txt, err)
+	}
+
+	ips, err := r.LookupIP(context.Background(), "ip4", "example")
+	if err != nil || len(ips) != 1 || ips[0] != "10.10.10.253" {
+		t.Errorf("LookupIP() expected [10.10.10.253], got %v, %v", ips, err)
+	}
+
+	ips, err = r.LookupIP(context.Background(), "ip6", "example")
+	if err != nil || len(ips) != 0 {
+		t.Errorf("LookupIP() expected no record, got %v, %v", ips, err)
+	}
+}
+
+func TestDoHResolver_UntrustedCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	r, err := NewResolver(server.URL+"/dns-query", ResolverOptions{})
+	if err != nil {
+		t.Fatalf("NewResolver() returned error: %v", err)
+	}
+	if _, err := r.LookupTXT(context.Background(), "example"); err == nil {
+		t.Errorf("LookupTXT() expected to reject the self signed certificate")
+	}
+}
+
+func TestDNSResolver_TLS(t *testing.T) {
+	// borrow the certificate of httptest, it is valid for 127.0.0.1
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+	tlsConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: ts.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	server := &dns.Server{Listener: l, Net: "tcp-tls", Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(txtReply(r, "hello"))
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	r, err := NewResolver("tls://127.0.0.1:"+port, ResolverOptions{TLSConfig: tlsConfig})
+	if err != nil {
+		t.Fatalf("NewResolver() returned error: %v", err)
+	}
+	if want, got := "tls://127.0.0.1:"+port, r.String(); want != got {
+		t.Errorf("String() expected %v, got %v", want, got)
+	}
+
+	txt, err := r.LookupTXT(context.Background(), "example")
+	if err != nil || len(txt) != 1 || txt[0] != "hello" {
+		t.Errorf("LookupTXT() over TLS expected [hello], got %v, %v", txt, err)
+	}
+
+	untrusted, _ := NewResolver("tls://127.0.0.1:"+port, ResolverOptions{})
+	if _, err := untrusted.LookupTXT(context.Background(), "example"); err == nil {
+		t.Errorf("LookupTXT() over TLS expected to reject the self signed certificate")
+	}
+}
@@ -0,0 +1,135 @@
+package duckdns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/schedule"
+)
+
+//ErrSuperseded is returned by a request waiting for the rate limit when a newer request of
+//the same kind replaced it, only the latest state is sent
+var ErrSuperseded = errors.New("request superseded by a newer one before the rate limit allowed it")
+
+//Limit structure of the requests of a token, Burst requests at once and then one every Every
+type Limit struct {
+	Every time.Duration
+	Burst int
+}
+
+//Limiter structure rate limiting the requests with a token bucket per token, it can be
+//shared by the clients of several tokens
+type Limiter struct {
+	mu      sync.Mutex
+	limit   Limit
+	limits  map[string]Limit
+	buckets map[string]*bucket
+	clock   schedule.Clock
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	//pending requests waiting for a token, by kind, closed when superseded
+	pending map[string]chan struct{}
+}
+
+//NewLimiter function to return a limiter applying limit to every token
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		limits:  make(map[string]Limit),
+		buckets: make(map[string]*bucket),
+		clock:   schedule.System,
+	}
+}
+
+//SetLimit function to set the limit of a token, instead of the one of the limiter
+func (l *Limiter) SetLimit(token string, limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[token] = limit
+}
+
+func (l *Limiter) limitOf(token string) Limit {
+	if limit, ok := l.limits[token]; ok {
+		return limit
+	}
+	return l.limit
+}
+
+//refill function adding the tokens earned since the last refill, it returns the limit of the token
+func (l *Limiter) refill(token string) (*bucket, Limit) {
+	limit := l.limitOf(token)
+	now := l.clock.Now()
+	b, ok := l.buckets[token]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now, pending: make(map[string]chan struct{})}
+		l.buckets[token] = b
+	}
+	if limit.Every > 0 {
+		b.tokens += float64(now.Sub(b.last)) / float64(limit.Every)
+	}
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.last = now
+	return b, limit
+}
+
+//Wait function blocking until a request of kind, such as "IP update of example", is allowed
+//for token. A request already waiting with the same kind is superseded and returns ErrSuperseded.
+func (l *Limiter) Wait(ctx context.Context, token, kind string) error {
+	l.mu.Lock()
+	b, limit := l.refill(token)
+	if limit.Every <= 0 || limit.Burst <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	if b.tokens >= 1 && len(b.pending) == 0 {
+		b.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+
+	if previous, ok := b.pending[kind]; ok {
+		klog.Infof("Rate limit of the token reached, the waiting %v is replaced by a newer one", kind)
+		close(previous)
+	}
+	superseded := make(chan struct{})
+	b.pending[kind] = superseded
+	defer func() {
+		if b.pending[kind] == superseded {
+			delete(b.pending, kind)
+		}
+		l.mu.Unlock()
+	}()
+
+	for {
+		delay := time.Duration((1 - b.tokens) * float64(limit.Every))
+		klog.Warningf("Rate limit of the token reached, delaying the %v by %v", kind, delay)
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			return ctx.Err()
+		case <-superseded:
+			l.mu.Lock()
+			return ErrSuperseded
+		case <-l.clock.After(delay):
+		}
+		l.mu.Lock()
+		if b.pending[kind] != superseded {
+			return ErrSuperseded
+		}
+		b, limit = l.refill(token)
+		if b.tokens >= 1 {
+			b.tokens--
+			return nil
+		}
+	}
+}
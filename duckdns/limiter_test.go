@@ -0,0 +1,96 @@
+package duckdns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ebrianne/duckdns-go/schedule"
+)
+
+func newTestLimiter(limit Limit) (*Limiter, *schedule.FakeClock) {
+	clock := schedule.NewFakeClock(time.Date(2021, 1, 13, 11, 0, 0, 0, time.UTC))
+	l := NewLimiter(limit)
+	l.clock = clock
+	return l, clock
+}
+
+// wait runs Wait in the background and returns its error on the channel
+func wait(l *Limiter, token, kind string) chan error {
+	done := make(chan error, 1)
+	go func() { done <- l.Wait(context.Background(), token, kind) }()
+	return done
+}
+
+func TestLimiter_Burst(t *testing.T) {
+	l, clock := newTestLimiter(Limit{Every: time.Minute, Burst: 2})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx, "token", "IP update"); err != nil {
+			t.Fatalf("Wait() expected to be allowed by the burst, got %v", err)
+		}
+	}
+	// the other tokens have their own bucket
+	if err := l.Wait(ctx, "other", "IP update"); err != nil {
+		t.Fatalf("Wait() expected to be allowed for another token, got %v", err)
+	}
+
+	done := wait(l, "token", "IP update")
+	clock.BlockUntil(1)
+	clock.Advance(30 * time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("Wait() expected to wait for the rate, returned %v", err)
+	default:
+	}
+	clock.Advance(30 * time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("Wait() expected to be allowed after a minute, got %v", err)
+	}
+}
+
+func TestLimiter_Coalesce(t *testing.T) {
+	l, clock := newTestLimiter(Limit{Every: time.Minute, Burst: 1})
+	l.Wait(context.Background(), "token", "IP update")
+
+	first := wait(l, "token", "IP update")
+	clock.BlockUntil(1)
+	txt := wait(l, "token", "TXT update")
+	clock.BlockUntil(2)
+	latest := wait(l, "token", "IP update")
+	if err := <-first; !errors.Is(err, ErrSuperseded) {
+		t.Errorf("Wait() expected to be superseded by the newer update, got %v", err)
+	}
+	clock.BlockUntil(3)
+
+	// a single token for both waiting kinds, the other one waits for the next
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	if err := <-latest; err != nil {
+		t.Errorf("Wait() expected to send the latest update, got %v", err)
+	}
+	if err := <-txt; err != nil {
+		t.Errorf("Wait() expected to send the TXT update, got %v", err)
+	}
+}
+
+func TestLimiter_SetLimit(t *testing.T) {
+	l, _ := newTestLimiter(Limit{Every: time.Minute, Burst: 1})
+	l.SetLimit("token", Limit{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx, "token", "IP update"); err != nil {
+			t.Fatalf("Wait() expected no limit for the token, got %v", err)
+		}
+	}
+
+	l.Wait(ctx, "other", "IP update")
+	cancel()
+	if err := l.Wait(ctx, "other", "IP update"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() expected to return when the context is done, got %v", err)
+	}
+}
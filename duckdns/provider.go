@@ -0,0 +1,90 @@
+package duckdns
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+//Provider structure adapting the client to the provider interface of the daemon
+type Provider struct {
+	Client *Client
+}
+
+//NewProvider function to return the provider of the client domains
+func NewProvider(client *Client) *Provider {
+	return &Provider{Client: client}
+}
+
+//Name function returning the name of the service
+func (p *Provider) Name() string {
+	return "duckdns"
+}
+
+//Domains function returning the full names of the client domains
+func (p *Provider) Domains() []string {
+	domains := make([]string, 0, len(p.Client.Config.DomainNames))
+	for _, domain := range p.Client.Config.DomainNames {
+		domains = append(domains, FQDN(domain))
+	}
+	return domains
+}
+
+//Capabilities function returning what duckdns supports, everything
+func (p *Provider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{IPv4: true, IPv6: true, TXT: true, Clear: true, DetectIP: true}
+}
+
+//UpdateIP function publishing the IPs, duckdns detects the IPv4 when both are empty
+func (p *Provider) UpdateIP(ctx context.Context, ipv4, ipv6 string) (*provider.Result, error) {
+	var resp *Response
+	var err error
+	if ipv4 == "" && ipv6 == "" {
+		resp, err = p.Client.UpdateIP(ctx)
+	} else {
+		resp, err = p.Client.UpdateIPWithValues(ctx, ipv4, ipv6)
+	}
+	result, err := Check(resp, err)
+	if err != nil {
+		return nil, err
+	}
+	return &provider.Result{IPv4: result.IPv4, IPv6: result.IPv6, Changed: result.Changed}, nil
+}
+
+//ClearIP function clearing the IPs of the domains
+func (p *Provider) ClearIP(ctx context.Context) error {
+	_, err := Check(p.Client.ClearIP(ctx))
+	return err
+}
+
+//SetTXT function setting the TXT record of the domains
+func (p *Provider) SetTXT(ctx context.Context, value string) error {
+	_, err := Check(p.Client.UpdateRecord(ctx, value))
+	return err
+}
+
+//ClearTXT function clearing the TXT record of the domains
+func (p *Provider) ClearTXT(ctx context.Context, value string) error {
+	_, err := Check(p.Client.ClearRecord(ctx, value))
+	return err
+}
+
+//Check function turning a KO answer into a provider error, the throttled requests and the
+//server errors are temporary errors
+func Check(resp *Response, err error) (*Result, error) {
+	if err != nil {
+		return nil, err
+	}
+	if resp.HTTPResponse != nil {
+		if code := resp.HTTPResponse.StatusCode; code == http.StatusTooManyRequests || code >= http.StatusInternalServerError {
+			return nil, &provider.Error{Provider: "duckdns", Code: strconv.Itoa(code), Message: http.StatusText(code), Temporary: true}
+		}
+	}
+	result := ParseResult(resp.Data)
+	if !result.OK {
+		return nil, &provider.Error{Provider: "duckdns", Code: "KO", Message: "verify the token and the domains"}
+	}
+	return result, nil
+}
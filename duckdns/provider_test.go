@@ -0,0 +1,89 @@
+package duckdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+func TestProvider_UpdateIP(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ip") == "10.10.10.253" {
+			fmt.Fprint(w, "OK\n10.10.10.253\n\nUPDATED")
+			return
+		}
+		fmt.Fprint(w, "KO")
+	})
+
+	p := NewProvider(client)
+	result, err := p.UpdateIP(context.Background(), "10.10.10.253", "")
+	if err != nil {
+		t.Fatalf("UpdateIP() returned error: %v", err)
+	}
+	if want := (&provider.Result{IPv4: "10.10.10.253", Changed: true}); !reflect.DeepEqual(want, result) {
+		t.Errorf("UpdateIP() expected %+v, got %+v", want, result)
+	}
+
+	_, err = p.UpdateIP(context.Background(), "", "")
+	var providerErr *provider.Error
+	if !errors.As(err, &providerErr) || providerErr.Code != "KO" {
+		t.Errorf("UpdateIP() expected a KO error, got %v", err)
+	}
+	if provider.IsTemporary(err) {
+		t.Errorf("UpdateIP() KO expected to be permanent")
+	}
+}
+
+func TestProvider_TXT(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	var queries []string
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("txt")+" "+r.URL.Query().Get("clear"))
+		fmt.Fprint(w, "OK")
+	})
+
+	p := NewProvider(client)
+	if err := p.SetTXT(context.Background(), "hello"); err != nil {
+		t.Fatalf("SetTXT() returned error: %v", err)
+	}
+	if err := p.ClearTXT(context.Background(), "hello"); err != nil {
+		t.Fatalf("ClearTXT() returned error: %v", err)
+	}
+	if want := []string{"hello ", "hello true"}; !reflect.DeepEqual(want, queries) {
+		t.Errorf("Queries expected %q, got %q", want, queries)
+	}
+	if want, got := []string{"example.duckdns.org"}, p.Domains(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Domains() expected %v, got %v", want, got)
+	}
+}
+
+func TestProvider_Throttled(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	codes := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(codes[0])
+		codes = codes[1:]
+		fmt.Fprint(w, "KO")
+	})
+
+	p := NewProvider(client)
+	for _, code := range []string{"429", "503"} {
+		_, err := p.UpdateIP(context.Background(), "10.10.10.253", "")
+		var providerErr *provider.Error
+		if !errors.As(err, &providerErr) || providerErr.Code != code || !provider.IsTemporary(err) {
+			t.Errorf("UpdateIP() expected a temporary %v error, got %v", code, err)
+		}
+	}
+}
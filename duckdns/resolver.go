@@ -0,0 +1,364 @@
+package duckdns
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	zone = "duckdns.org"
+)
+
+//AuthoritativeNameservers of the duckdns.org zone
+var AuthoritativeNameservers = []string{"ns1.duckdns.org:53", "ns2.duckdns.org:53", "ns3.duckdns.org:53"}
+
+//Resolver interface used by the client and the verification for every DNS lookup
+type Resolver interface {
+	//LookupTXT returns the TXT records of the domain, a domain without records returns an empty list
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+	//LookupIP returns the A (network "ip4") or AAAA (network "ip6") records of the domain
+	LookupIP(ctx context.Context, network, domain string) ([]string, error)
+	String() string
+}
+
+//ResolverOptions structure containing the options shared by the resolvers
+type ResolverOptions struct {
+	//Timeout of a lookup, zero only relies on the context
+	Timeout time.Duration
+	//CacheTTL is how long answers are kept, zero disables the cache
+	CacheTTL time.Duration
+	//TLSConfig of the DNS-over-TLS and DNS-over-HTTPS resolvers, nil uses the system roots
+	TLSConfig *tls.Config
+}
+
+//SystemResolver structure using the resolver of the host
+type SystemResolver struct {
+	Timeout time.Duration
+}
+
+//String function returning the name of the resolver
+func (r *SystemResolver) String() string {
+	return "system"
+}
+
+//LookupTXT function to get the TXT records through the system resolver
+func (r *SystemResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	txt, err := net.DefaultResolver.LookupTXT(ctx, FQDN(domain)+".")
+	if isNotFound(err) {
+		return nil, nil
+	}
+	return txt, err
+}
+
+//LookupIP function to get the A or AAAA records through the system resolver
+func (r *SystemResolver) LookupIP(ctx context.Context, network, domain string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, FQDN(domain)+".")
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		result = append(result, ip.String())
+	}
+	return result, nil
+}
+
+//DNSResolver structure querying DNS servers directly, the servers are tried in order until one answers
+type DNSResolver struct {
+	//Servers are host:port addresses
+	Servers []string
+	//Network is udp (default), tcp or tcp-tls for DNS-over-TLS
+	Network string
+	//Recursion sets the recursion desired flag, it should be off when querying authoritative servers
+	Recursion bool
+	Timeout   time.Duration
+	TLSConfig *tls.Config
+}
+
+//String function returning the name of the resolver
+func (r *DNSResolver) String() string {
+	network := r.Network
+	switch network {
+	case "":
+		network = "udp"
+	case "tcp-tls":
+		network = "tls"
+	}
+	return network + "://" + strings.Join(r.Servers, ",")
+}
+
+//LookupTXT function to get the TXT records from the DNS servers
+func (r *DNSResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	answers, err := r.lookup(ctx, domain, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	return txtValues(answers), nil
+}
+
+//LookupIP function to get the A or AAAA records from the DNS servers
+func (r *DNSResolver) LookupIP(ctx context.Context, network, domain string) ([]string, error) {
+	answers, err := r.lookup(ctx, domain, ipType(network))
+	if err != nil {
+		return nil, err
+	}
+	return ipValues(answers), nil
+}
+
+func (r *DNSResolver) lookup(ctx context.Context, domain string, qtype uint16) ([]dns.RR, error) {
+	if len(r.Servers) == 0 {
+		return nil, errors.New("no DNS server configured")
+	}
+	ctx, cancel := withTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	m := newQuery(domain, qtype, r.Recursion)
+
+	var errs []string
+	for _, server := range r.Servers {
+		resp, err := r.exchange(ctx, m, server)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		answers, err := answersOf(resp, server)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		return answers, nil
+	}
+	return nil, fmt.Errorf("Unable to lookup %v %v, %v", FQDN(domain), dns.TypeToString[qtype], strings.Join(errs, "; "))
+}
+
+func (r *DNSResolver) exchange(ctx context.Context, m *dns.Msg, server string) (*dns.Msg, error) {
+	c := &dns.Client{Net: r.Network, TLSConfig: r.TLSConfig}
+	resp, _, err := c.ExchangeContext(ctx, m, server)
+	if err == nil && resp.Truncated && (r.Network == "" || r.Network == "udp") {
+		c.Net = "tcp"
+		resp, _, err = c.ExchangeContext(ctx, m, server)
+	}
+	return resp, err
+}
+
+func newQuery(domain string, qtype uint16, recursion bool) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(FQDN(domain)), qtype)
+	m.RecursionDesired = recursion
+	return m
+}
+
+func answersOf(resp *dns.Msg, server string) ([]dns.RR, error) {
+	switch resp.Rcode {
+	case dns.RcodeSuccess:
+		return resp.Answer, nil
+	case dns.RcodeNameError:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%v answered %v", server, dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func ipType(network string) uint16 {
+	if network == "ip6" {
+		return dns.TypeAAAA
+	}
+	return dns.TypeA
+}
+
+func txtValues(answers []dns.RR) []string {
+	var txt []string
+	for _, rr := range answers {
+		if t, ok := rr.(*dns.TXT); ok {
+			txt = append(txt, strings.Join(t.Txt, ""))
+		}
+	}
+	return txt
+}
+
+func ipValues(answers []dns.RR) []string {
+	var ips []string
+	for _, rr := range answers {
+		switch rr := rr.(type) {
+		case *dns.A:
+			ips = append(ips, rr.A.String())
+		case *dns.AAAA:
+			ips = append(ips, rr.AAAA.String())
+		}
+	}
+	return ips
+}
+
+//CachingResolver structure keeping the answers of another resolver for TTL
+type CachingResolver struct {
+	Resolver Resolver
+	TTL      time.Duration
+
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	values  []string
+	expires time.Time
+}
+
+//NewCachingResolver function to return a resolver caching the answers of r
+func NewCachingResolver(r Resolver, ttl time.Duration) *CachingResolver {
+	return &CachingResolver{Resolver: r, TTL: ttl, now: time.Now, entries: make(map[string]cacheEntry)}
+}
+
+//String function returning the name of the resolver
+func (r *CachingResolver) String() string {
+	return r.Resolver.String()
+}
+
+//LookupTXT function to get the TXT records from the cache or the resolver
+func (r *CachingResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return r.cached("TXT "+FQDN(domain), func() ([]string, error) {
+		return r.Resolver.LookupTXT(ctx, domain)
+	})
+}
+
+//LookupIP function to get the A or AAAA records from the cache or the resolver
+func (r *CachingResolver) LookupIP(ctx context.Context, network, domain string) ([]string, error) {
+	return r.cached(network+" "+FQDN(domain), func() ([]string, error) {
+		return r.Resolver.LookupIP(ctx, network, domain)
+	})
+}
+
+func (r *CachingResolver) cached(key string, lookup func() ([]string, error)) ([]string, error) {
+	r.mu.Lock()
+	entry, ok := r.entries[key]
+	r.mu.Unlock()
+	if ok && r.now().Before(entry.expires) {
+		return entry.values, nil
+	}
+
+	values, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.entries[key] = cacheEntry{values: values, expires: r.now().Add(r.TTL)}
+	r.mu.Unlock()
+	return values, nil
+}
+
+//NewResolver function to build a resolver from its name: "system" (default), "authoritative" for the
+//duckdns.org nameservers without recursion, "udp://host:port", "tcp://host:port", "host:port",
+//"tls://host:port" for DNS-over-TLS, "https://host/path" for DNS-over-HTTPS with the wire format
+//or "https+json://host/path" for DNS-over-HTTPS with the JSON format
+func NewResolver(name string, opts ResolverOptions) (Resolver, error) {
+	var r Resolver
+
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "" || name == "system":
+		r = &SystemResolver{Timeout: opts.Timeout}
+	case name == "authoritative":
+		r = &DNSResolver{Servers: AuthoritativeNameservers, Timeout: opts.Timeout}
+	case strings.HasPrefix(name, "https://"):
+		r = &DoHResolver{URL: name, Timeout: opts.Timeout, httpClient: dohClient(opts.TLSConfig)}
+	case strings.HasPrefix(name, "https+json://"):
+		r = &DoHResolver{URL: "https://" + strings.TrimPrefix(name, "https+json://"), JSON: true, Timeout: opts.Timeout, httpClient: dohClient(opts.TLSConfig)}
+	default:
+		network, port := "udp", "53"
+		if i := strings.Index(name, "://"); i != -1 {
+			network, name = name[:i], name[i+3:]
+		}
+		switch network {
+		case "udp", "tcp":
+		case "tls":
+			network, port = "tcp-tls", "853"
+		default:
+			return nil, fmt.Errorf("Unknown resolver network %q", network)
+		}
+		if name == "" {
+			return nil, errors.New("Resolver address is empty")
+		}
+		if _, _, err := net.SplitHostPort(name); err != nil {
+			name = net.JoinHostPort(name, port)
+		}
+		r = &DNSResolver{Servers: []string{name}, Network: network, Recursion: true, Timeout: opts.Timeout, TLSConfig: opts.TLSConfig}
+	}
+
+	if opts.CacheTTL > 0 {
+		r = NewCachingResolver(r, opts.CacheTTL)
+	}
+	return r, nil
+}
+
+//NewResolvers function to build one resolver per name, "authoritative" expands to one resolver per
+//duckdns.org nameserver so that each of them is checked
+func NewResolvers(names []string, opts ResolverOptions) ([]Resolver, error) {
+	var resolvers []Resolver
+	for _, name := range names {
+		if strings.TrimSpace(name) == "authoritative" {
+			for _, ns := range AuthoritativeNameservers {
+				resolvers = append(resolvers, &DNSResolver{Servers: []string{ns}, Timeout: opts.Timeout})
+			}
+			continue
+		}
+		r, err := NewResolver(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, r)
+	}
+	return resolvers, nil
+}
+
+//FQDN function returning the full duckdns.org name of a domain, names with a dot such as
+//home.example.com are already fully qualified
+func FQDN(domain string) string {
+	if strings.Contains(domain, ".") {
+		return strings.TrimSuffix(domain, ".")
+	}
+	return domain + "." + zone
+}
+
+//Subdomain function returning the duckdns domain serving a name, for instance example for
+//example.duckdns.org, *.example.duckdns.org or _acme-challenge.www.example.duckdns.org
+func Subdomain(name string) (string, error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	name = strings.TrimPrefix(name, "*.")
+	if !strings.HasSuffix(name, "."+zone) {
+		return "", fmt.Errorf("%v is not a %v domain", name, zone)
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."+zone), ".")
+	return labels[len(labels)-1], nil
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,208 @@
+package duckdns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startDNSServer starts a local DNS stand-in on the given network, every query is passed to handler
+func startDNSServer(t *testing.T, network string, handler func(r *dns.Msg) *dns.Msg) string {
+	server := &dns.Server{Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		w.WriteMsg(handler(r))
+	})}
+
+	var addr string
+	if network == "tcp" {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Unable to listen: %v", err)
+		}
+		server.Listener = l
+		addr = l.Addr().String()
+	} else {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Unable to listen: %v", err)
+		}
+		server.PacketConn = pc
+		addr = pc.LocalAddr().String()
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return addr
+}
+
+func txtReply(r *dns.Msg, values ...string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	for _, v := range values {
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{v},
+		})
+	}
+	return m
+}
+
+func TestDNSResolver_LookupTXT(t *testing.T) {
+	for _, network := range []string{"udp", "tcp"} {
+		addr := startDNSServer(t, network, func(r *dns.Msg) *dns.Msg {
+			if want, got := "example.duckdns.org.", r.Question[0].Name; want != got {
+				t.Errorf("Question name expected to be %v, got %v", want, got)
+			}
+			return txtReply(r, "hello")
+		})
+
+		r, err := NewResolver(network+"://"+addr, ResolverOptions{})
+		if err != nil {
+			t.Fatalf("NewResolver() returned error: %v", err)
+		}
+		txt, err := r.LookupTXT(context.Background(), "example")
+		if err != nil {
+			t.Fatalf("LookupTXT() over %v returned error: %v", network, err)
+		}
+		if len(txt) != 1 || txt[0] != "hello" {
+			t.Errorf("LookupTXT() over %v expected [hello], got %v", network, txt)
+		}
+	}
+}
+
+func TestDNSResolver_RecursionDesired(t *testing.T) {
+	recursion := make(chan bool, 2)
+	addr := startDNSServer(t, "udp", func(r *dns.Msg) *dns.Msg {
+		recursion <- r.RecursionDesired
+		return txtReply(r)
+	})
+
+	authoritative := &DNSResolver{Servers: []string{addr}}
+	authoritative.LookupTXT(context.Background(), "example")
+	if <-recursion {
+		t.Errorf("Authoritative lookups expected to have the recursion desired flag off")
+	}
+
+	recursive, _ := NewResolver(addr, ResolverOptions{})
+	recursive.LookupTXT(context.Background(), "example")
+	if !<-recursion {
+		t.Errorf("Server lookups expected to have the recursion desired flag on")
+	}
+}
+
+func TestDNSResolver_Failover(t *testing.T) {
+	failing := startDNSServer(t, "udp", func(r *dns.Msg) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		return m
+	})
+	working := startDNSServer(t, "udp", func(r *dns.Msg) *dns.Msg {
+		return txtReply(r, "hello")
+	})
+
+	r := &DNSResolver{Servers: []string{failing, working}}
+	txt, err := r.LookupTXT(context.Background(), "example")
+	if err != nil || len(txt) != 1 {
+		t.Errorf("LookupTXT() expected to fail over, got %v, %v", txt, err)
+	}
+
+	r = &DNSResolver{Servers: []string{failing}}
+	if _, err := r.LookupTXT(context.Background(), "example"); err == nil {
+		t.Errorf("LookupTXT() expected to return an error on SERVFAIL")
+	}
+}
+
+func TestDNSResolver_NameError(t *testing.T) {
+	addr := startDNSServer(t, "udp", func(r *dns.Msg) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		return m
+	})
+
+	r := &DNSResolver{Servers: []string{addr}}
+	ips, err := r.LookupIP(context.Background(), "ip4", "missing")
+	if err != nil || len(ips) != 0 {
+		t.Errorf("LookupIP() expected no record and no error, got %v, %v", ips, err)
+	}
+}
+
+func TestDNSResolver_Timeout(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer pc.Close()
+
+	r := &DNSResolver{Servers: []string{pc.LocalAddr().String()}, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if _, err := r.LookupTXT(context.Background(), "example"); err == nil {
+		t.Errorf("LookupTXT() expected to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("LookupTXT() expected to give up after the timeout, took %v", elapsed)
+	}
+}
+
+type countingResolver struct {
+	SystemResolver
+	lookups int
+}
+
+func (r *countingResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	r.lookups++
+	return []string{"hello"}, nil
+}
+
+func TestCachingResolver(t *testing.T) {
+	counting := &countingResolver{}
+	r := NewCachingResolver(counting, time.Minute)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	r.LookupTXT(context.Background(), "example")
+	r.LookupTXT(context.Background(), "example.duckdns.org")
+	if counting.lookups != 1 {
+		t.Errorf("CachingResolver expected to do 1 lookup, did %v", counting.lookups)
+	}
+
+	now = now.Add(2 * time.Minute)
+	r.LookupTXT(context.Background(), "example")
+	if counting.lookups != 2 {
+		t.Errorf("CachingResolver expected to do 2 lookups after expiry, did %v", counting.lookups)
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	if r, _ := NewResolver("", ResolverOptions{}); r.String() != "system" {
+		t.Errorf("NewResolver() default expected to be system, got %v", r)
+	}
+	if r, _ := NewResolver("10.0.0.1", ResolverOptions{}); r.String() != "udp://10.0.0.1:53" {
+		t.Errorf("NewResolver() expected udp://10.0.0.1:53, got %v", r)
+	}
+	if r, _ := NewResolver("authoritative", ResolverOptions{}); r.(*DNSResolver).Recursion {
+		t.Errorf("NewResolver() authoritative expected to have recursion off")
+	}
+	if _, err := NewResolver("quic://10.0.0.1", ResolverOptions{}); err == nil {
+		t.Errorf("NewResolver() expected an error for an unknown network")
+	}
+
+	resolvers, _ := NewResolvers([]string{"authoritative", "system"}, ResolverOptions{})
+	if want, got := len(AuthoritativeNameservers)+1, len(resolvers); want != got {
+		t.Errorf("NewResolvers() expected %v resolvers, got %v", want, got)
+	}
+}
+
+func TestFQDN(t *testing.T) {
+	for name, want := range map[string]string{
+		"example":             "example.duckdns.org",
+		"example.duckdns.org": "example.duckdns.org",
+		"home.example.com.":   "home.example.com",
+	} {
+		if got := FQDN(name); got != want {
+			t.Errorf("FQDN(%v) expected %v, got %v", name, want, got)
+		}
+	}
+}
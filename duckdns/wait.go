@@ -0,0 +1,78 @@
+package duckdns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultWaitInterval = 5 * time.Second
+)
+
+//WaitOptions structure containing the options of WaitForRecord
+type WaitOptions struct {
+	//Interval between two polls, 5s by default
+	Interval time.Duration
+	//Resolvers that must all return the value, the duckdns.org nameservers by default
+	Resolvers []Resolver
+}
+
+//WaitForRecord function to poll the resolvers until every one of them returns value as TXT record
+//of every domain, or the context is done
+func (c *Client) WaitForRecord(ctx context.Context, value string, opts *WaitOptions) error {
+	interval := defaultWaitInterval
+	var resolvers []Resolver
+	if opts != nil {
+		if opts.Interval > 0 {
+			interval = opts.Interval
+		}
+		resolvers = opts.Resolvers
+	}
+	if len(resolvers) == 0 {
+		var err error
+		resolvers, err = NewResolvers([]string{"authoritative"}, ResolverOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var missing []string
+		for _, domain := range c.Config.DomainNames {
+			for _, r := range resolvers {
+				txt, err := r.LookupTXT(ctx, domain)
+				if err != nil {
+					klog.V(2).Infof("Waiting for %v on %v: %v", FQDN(domain), r, err)
+				}
+				if !contains(txt, value) {
+					missing = append(missing, FQDN(domain)+" on "+r.String())
+				}
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("TXT record not visible for %v, %v", strings.Join(missing, ", "), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
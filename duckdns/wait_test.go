@@ -0,0 +1,64 @@
+package duckdns
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestWaitForRecord(t *testing.T) {
+	var queries int32
+	slow := startDNSServer(t, "udp", func(r *dns.Msg) *dns.Msg {
+		if atomic.AddInt32(&queries, 1) < 3 {
+			return txtReply(r, "previous")
+		}
+		return txtReply(r, "expected")
+	})
+	fast := startDNSServer(t, "udp", func(r *dns.Msg) *dns.Msg {
+		return txtReply(r, "expected")
+	})
+
+	config := &Config{}
+	config.Token = "example-token"
+	config.DomainNames = []string{"example"}
+	c := NewClient(http.DefaultClient, config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := c.WaitForRecord(ctx, "expected", &WaitOptions{
+		Interval:  10 * time.Millisecond,
+		Resolvers: []Resolver{&DNSResolver{Servers: []string{slow}}, &DNSResolver{Servers: []string{fast}}},
+	})
+	if err != nil {
+		t.Fatalf("WaitForRecord() returned error: %v", err)
+	}
+	if got := atomic.LoadInt32(&queries); got != 3 {
+		t.Errorf("WaitForRecord() expected to poll 3 times, polled %v", got)
+	}
+}
+
+func TestWaitForRecord_Deadline(t *testing.T) {
+	addr := startDNSServer(t, "udp", func(r *dns.Msg) *dns.Msg {
+		return txtReply(r, "previous")
+	})
+
+	config := &Config{}
+	config.Token = "example-token"
+	config.DomainNames = []string{"example"}
+	c := NewClient(http.DefaultClient, config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.WaitForRecord(ctx, "expected", &WaitOptions{
+		Interval:  10 * time.Millisecond,
+		Resolvers: []Resolver{&DNSResolver{Servers: []string{addr}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "example.duckdns.org on udp://"+addr) {
+		t.Errorf("WaitForRecord() expected to report the missing record, got %v", err)
+	}
+}
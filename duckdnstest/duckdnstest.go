@@ -0,0 +1,222 @@
+// Package duckdnstest provides an in-process fake of DuckDNS for tests.
+//
+// Server answers the /update endpoint like www.duckdns.org, keeps the IPv4, IPv6 and TXT
+// record of every domain and serves them over a companion DNS responder, so that clients
+// can be tested end to end without the network:
+//
+//	s := duckdnstest.NewServer("token", "example")
+//	defer s.Close()
+//	client := s.Client()
+//
+// Faults can be injected in the next requests to test the error handling.
+package duckdnstest
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/server"
+)
+
+// Fault injected in the answer of a request
+type Fault int
+
+const (
+	// FaultNone answers normally
+	FaultNone Fault = iota
+	// FaultKO answers KO without changing the records
+	FaultKO
+	// FaultServerError answers 500
+	FaultServerError
+	// FaultSlow answers normally after Server.Delay
+	FaultSlow
+	// FaultDrop closes the connection without answering
+	FaultDrop
+)
+
+// Record holds the records of a domain
+type Record struct {
+	IPv4 string
+	IPv6 string
+	TXT  string
+}
+
+// Server is a fake DuckDNS update endpoint and DNS responder, backed by a server.Server
+// of the duckdns.org zone keeping the records in memory.
+type Server struct {
+	// URL of the update endpoint, to use as the client BaseURL
+	URL string
+	// DNSAddr is the host:port of the DNS responder, on both UDP and TCP
+	DNSAddr string
+	// Delay of the FaultSlow answers
+	Delay time.Duration
+
+	token   string
+	service *server.Server
+	http    *httptest.Server
+	udp     *dns.Server
+	tcp     *dns.Server
+
+	mu       sync.Mutex
+	requests []url.Values
+	faults   []Fault
+	fault    Fault
+}
+
+// NewServer starts a server accepting token for the domains. It panics when it cannot
+// listen, like httptest.NewServer.
+func NewServer(token string, domains ...string) *Server {
+	service, err := server.New(&server.Config{Token: token, Domains: domains}, server.MemoryStore{})
+	if err != nil {
+		panic(fmt.Sprintf("duckdnstest: %v", err))
+	}
+	s := &Server{Delay: time.Second, token: token, service: service}
+
+	s.http = httptest.NewServer(http.HandlerFunc(s.serveUpdate))
+	s.URL = s.http.URL
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("duckdnstest: failed to listen: %v", err))
+	}
+	s.DNSAddr = pc.LocalAddr().String()
+	l, err := net.Listen("tcp", s.DNSAddr)
+	if err != nil {
+		pc.Close()
+		panic(fmt.Sprintf("duckdnstest: failed to listen: %v", err))
+	}
+
+	s.udp = &dns.Server{PacketConn: pc, Handler: service}
+	s.tcp = &dns.Server{Listener: l, Handler: service}
+	started := make(chan struct{}, 2)
+	s.udp.NotifyStartedFunc = func() { started <- struct{}{} }
+	s.tcp.NotifyStartedFunc = func() { started <- struct{}{} }
+	go s.udp.ActivateAndServe()
+	go s.tcp.ActivateAndServe()
+	<-started
+	<-started
+
+	return s
+}
+
+// Close stops the update endpoint and the DNS responder.
+func (s *Server) Close() {
+	s.http.Close()
+	s.udp.Shutdown()
+	s.tcp.Shutdown()
+}
+
+// Client returns a duckdns client of the server domains, resolving the records with the
+// DNS responder.
+func (s *Server) Client() *duckdns.Client {
+	client := duckdns.NewClient(s.http.Client(), &duckdns.Config{Token: s.token, DomainNames: s.service.Domains()})
+	client.BaseURL = s.URL
+	client.SetResolver(s.Resolver())
+	return client
+}
+
+// Token returns the token accepted by the server.
+func (s *Server) Token() string {
+	return s.token
+}
+
+// Resolver returns a resolver querying the DNS responder.
+func (s *Server) Resolver() duckdns.Resolver {
+	return &duckdns.DNSResolver{Servers: []string{s.DNSAddr}, Timeout: time.Second}
+}
+
+// Record returns a copy of the records of domain, nil for an unknown domain.
+func (s *Server) Record(domain string) *Record {
+	r := s.service.Record(domain)
+	if r == nil {
+		return nil
+	}
+	return &Record{IPv4: r.IPv4, IPv6: r.IPv6, TXT: r.TXT}
+}
+
+// SetRecord sets the records of domain, adding the domain when it is unknown.
+func (s *Server) SetRecord(domain string, record Record) {
+	s.service.SetRecord(domain, server.Record{IPv4: record.IPv4, IPv6: record.IPv6, TXT: record.TXT})
+}
+
+// Requests returns the queries of the update requests received so far.
+func (s *Server) Requests() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.requests...)
+}
+
+// Inject queues faults, one per request. FaultNone entries let requests through.
+func (s *Server) Inject(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+// SetFault injects fault in every request once the queued faults are consumed,
+// FaultNone stops it.
+func (s *Server) SetFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fault = fault
+}
+
+func (s *Server) nextFault() Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.faults) == 0 {
+		return s.fault
+	}
+	fault := s.faults[0]
+	s.faults = s.faults[1:]
+	return fault
+}
+
+func (s *Server) serveUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/update" {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	s.mu.Lock()
+	s.requests = append(s.requests, q)
+	s.mu.Unlock()
+
+	switch s.nextFault() {
+	case FaultKO:
+		reply(w, "KO")
+		return
+	case FaultServerError:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	case FaultSlow:
+		select {
+		case <-time.After(s.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	case FaultDrop:
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	s.service.ServeHTTP(w, r)
+}
+
+func reply(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	fmt.Fprint(w, body)
+}
@@ -0,0 +1,123 @@
+package duckdnstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+func TestServer_UpdateIP(t *testing.T) {
+	s := NewServer("token", "example", "other")
+	defer s.Close()
+	client := s.Client()
+	ctx := context.Background()
+
+	resp, err := client.UpdateIPWithValues(ctx, "192.0.2.1", "2001:db8::1")
+	if err != nil || resp.Data != "OK" {
+		t.Fatalf("UpdateIPWithValues() expected OK, got %q, %v", resp.Data, err)
+	}
+	if want, got := (&Record{IPv4: "192.0.2.1", IPv6: "2001:db8::1"}), s.Record("other.duckdns.org"); *want != *got {
+		t.Errorf("Record expected %+v, got %+v", want, got)
+	}
+
+	client.Config.Verbose = true
+	resp, _ = client.UpdateIPWithValues(ctx, "192.0.2.1", "2001:db8::1")
+	if want := "OK\n192.0.2.1\n2001:db8::1\nNOCHANGE"; resp.Data != want {
+		t.Errorf("Verbose answer expected %q, got %q", want, resp.Data)
+	}
+
+	// without IP, the address of the caller is published
+	resp, _ = client.UpdateIP(ctx)
+	if result := duckdns.ParseResult(resp.Data); !result.OK || !result.Changed || result.IPv4 != "127.0.0.1" {
+		t.Errorf("UpdateIP() expected to publish 127.0.0.1, got %+v", result)
+	}
+
+	ips, err := client.Resolver.LookupIP(ctx, "ip6", "www.example.duckdns.org")
+	if err != nil || len(ips) != 1 || ips[0] != "2001:db8::1" {
+		t.Errorf("LookupIP() expected 2001:db8::1, got %v, %v", ips, err)
+	}
+
+	client.ClearIP(ctx)
+	if got := s.Record("example"); *got != (Record{}) {
+		t.Errorf("Record expected to be cleared, got %+v", got)
+	}
+}
+
+func TestServer_TXT(t *testing.T) {
+	s := NewServer("token", "example")
+	defer s.Close()
+	client := s.Client()
+	ctx := context.Background()
+
+	client.UpdateRecord(ctx, "hello")
+	if txt, err := client.GetRecord(ctx); err != nil || txt != "hello" {
+		t.Errorf("GetRecord() expected hello, got %q, %v", txt, err)
+	}
+	client.ClearRecord(ctx, "hello")
+	if txt, err := client.GetRecord(ctx); err != nil || txt != "" {
+		t.Errorf("GetRecord() expected no record, got %q, %v", txt, err)
+	}
+	if got := len(s.Requests()); got != 2 {
+		t.Errorf("Expected 2 requests, got %v", got)
+	}
+}
+
+func TestServer_KO(t *testing.T) {
+	s := NewServer("token", "example")
+	defer s.Close()
+	ctx := context.Background()
+
+	for _, config := range []*duckdns.Config{
+		{Token: "wrong", DomainNames: []string{"example"}},
+		{Token: s.Token(), DomainNames: []string{"unknown"}},
+	} {
+		client := s.Client()
+		client.Config = config
+		if resp, _ := client.UpdateIP(ctx); resp.Data != "KO" {
+			t.Errorf("UpdateIP() with %+v expected KO, got %q", config, resp.Data)
+		}
+	}
+	if resp, _ := s.Client().UpdateIPWithValues(ctx, "not-an-ip", ""); resp.Data != "KO" {
+		t.Errorf("UpdateIPWithValues() with an invalid IP expected KO, got %q", resp.Data)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	s := NewServer("token", "example")
+	defer s.Close()
+	s.Delay = 500 * time.Millisecond
+	p := duckdns.NewProvider(s.Client())
+	ctx := context.Background()
+
+	s.Inject(FaultKO, FaultServerError)
+	var e *provider.Error
+	if _, err := p.UpdateIP(ctx, "192.0.2.1", ""); !errors.As(err, &e) {
+		t.Errorf("FaultKO expected a KO error, got %v", err)
+	}
+	if _, err := p.UpdateIP(ctx, "192.0.2.1", ""); err == nil {
+		t.Errorf("FaultServerError expected an error")
+	}
+	// the HTTP client retries the requests dropped on a reused connection once
+	s.SetFault(FaultDrop)
+	if _, err := p.UpdateIP(ctx, "192.0.2.1", ""); err == nil {
+		t.Errorf("FaultDrop expected an error")
+	}
+	s.SetFault(FaultNone)
+	if _, err := p.UpdateIP(ctx, "192.0.2.1", ""); err != nil {
+		t.Errorf("FaultNone expected no error, got %v", err)
+	}
+
+	s.SetFault(FaultSlow)
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.UpdateIP(timeout, "192.0.2.2", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FaultSlow expected a deadline error, got %v", err)
+	}
+	if got := s.Record("example").IPv4; got != "192.0.2.1" {
+		t.Errorf("Record expected to be kept on faults, got %v", got)
+	}
+}
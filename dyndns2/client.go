@@ -0,0 +1,170 @@
+// Package dyndns2 implements the dyndns2 update protocol used by No-IP, Dynu and many routers.
+//
+// An update is a GET /nic/update?hostname=<names>&myip=<ipv4>&myipv6=<ipv6> authenticated
+// with HTTP basic auth. The service answers one code per hostname, such as "good 192.0.2.1"
+// or "nochg 192.0.2.1" on success and badauth, nohost, abuse or 911 on failure.
+package dyndns2
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+const (
+	updatePath = "/nic/update"
+
+	defaultUserAgent = "duckdns-go/" + duckdns.Version
+)
+
+// errorCodes maps the failure codes to their meaning and whether they are temporary
+var errorCodes = map[string]struct {
+	message   string
+	temporary bool
+}{
+	"badauth":  {"invalid username or password", false},
+	"nohost":   {"the hostname does not exist in the account", false},
+	"notfqdn":  {"the hostname is not a fully qualified domain name", false},
+	"numhost":  {"too many hostnames in the request", false},
+	"badagent": {"the user agent was blocked", false},
+	"!donator": {"the option requires a paid account", false},
+	"abuse":    {"the hostname is blocked for abuse", false},
+	"dnserr":   {"DNS error on the server side", true},
+	"911":      {"the service is down for maintenance", true},
+}
+
+// Config contains the client configuration.
+type Config struct {
+	// Server is the base URL of the service, for instance https://dynupdate.no-ip.com
+	Server    string
+	Username  string
+	Password  string
+	Hostnames []string
+}
+
+// Valid checks that the configuration can be used.
+func (c *Config) Valid() bool {
+	return c.Server != "" && c.Username != "" && c.Password != "" && len(c.Hostnames) > 0
+}
+
+// Response contains the http response and the data from the body.
+type Response struct {
+	HTTPResponse *http.Response
+	Data         string
+}
+
+// Client of a dyndns2 service.
+type Client struct {
+	httpClient *http.Client
+	BaseURL    string
+	UserAgent  string
+
+	Config *Config
+}
+
+// NewClient returns a client of the configured service.
+func NewClient(httpClient *http.Client, config *Config) *Client {
+	if !config.Valid() {
+		klog.Fatal("dyndns2 configuration is not valid, it needs a server, a username, a password and hostnames")
+	}
+
+	return &Client{
+		httpClient: httpClient,
+		BaseURL:    strings.TrimSuffix(config.Server, "/"),
+		UserAgent:  defaultUserAgent,
+		Config:     config,
+	}
+}
+
+// Update publishes the IPs of the hostnames, the service uses the address of the caller
+// when both are empty.
+func (c *Client) Update(ctx context.Context, ipv4, ipv6 string) (*Response, error) {
+	q := url.Values{}
+	q.Set("hostname", strings.Join(c.Config.Hostnames, ","))
+	if ipv4 != "" {
+		q.Set("myip", ipv4)
+	}
+	if ipv6 != "" {
+		q.Set("myipv6", ipv6)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+updatePath+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(c.Config.Username, c.Config.Password)
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	klog.Infof("Sending request to %v", req.URL)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	response := &Response{HTTPResponse: resp, Data: strings.TrimSpace(string(body))}
+
+	if resp.StatusCode == http.StatusUnauthorized && response.Data == "" {
+		response.Data = "badauth"
+	}
+	if resp.StatusCode >= http.StatusInternalServerError && response.Data == "" {
+		response.Data = "911"
+	}
+	return response, nil
+}
+
+// ParseResult parses the answer of an update, one line per hostname. The update changed
+// the records when one of the hostnames answered good, any failure code is returned as
+// a *provider.Error.
+func ParseResult(data string) (*provider.Result, error) {
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return nil, errors.New("Empty dyndns2 response")
+	}
+
+	result := &provider.Result{}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch code := fields[0]; code {
+		case "good", "nochg":
+			result.Changed = result.Changed || code == "good"
+			for _, ip := range strings.Split(strings.Join(fields[1:], ","), ",") {
+				switch {
+				case ip == "":
+				case strings.Contains(ip, ":"):
+					result.IPv6 = ip
+				default:
+					result.IPv4 = ip
+				}
+			}
+		default:
+			e, ok := errorCodes[code]
+			if !ok {
+				return nil, &provider.Error{Provider: "dyndns2", Code: code, Message: "unknown response " + line}
+			}
+			return nil, &provider.Error{Provider: "dyndns2", Code: code, Message: e.message, Temporary: e.temporary}
+		}
+	}
+	return result, nil
+}
+
+// SetUserAgent sets a custom User-Agent header, the services block the generic ones.
+func (c *Client) SetUserAgent(ua string) {
+	c.UserAgent = ua
+}
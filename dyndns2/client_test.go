@@ -0,0 +1,145 @@
+package dyndns2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+var (
+	mux    *http.ServeMux
+	client *Client
+	server *httptest.Server
+)
+
+func setupMockServer() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = NewClient(http.DefaultClient, &Config{
+		Server:    server.URL,
+		Username:  "user",
+		Password:  "secret",
+		Hostnames: []string{"home.example.com", "office.example.com"},
+	})
+}
+
+func teardownMockServer() {
+	server.Close()
+}
+
+func TestUpdate(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	mux.HandleFunc("/nic/update", func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			t.Errorf("Request basic auth expected user/secret, got %v/%v", user, password)
+		}
+		if got := r.Header.Get("User-Agent"); got != defaultUserAgent {
+			t.Errorf("Request User-Agent expected %v, got %v", defaultUserAgent, got)
+		}
+		want := url.Values{}
+		want.Set("hostname", "home.example.com,office.example.com")
+		want.Set("myip", "192.0.2.1")
+		want.Set("myipv6", "2001:db8::1")
+		if got := r.URL.Query(); !reflect.DeepEqual(want, got) {
+			t.Errorf("Request query expected %v, got %v", want, got)
+		}
+		fmt.Fprint(w, "good 192.0.2.1,2001:db8::1\nnochg 192.0.2.1,2001:db8::1\n")
+	})
+
+	resp, err := client.Update(context.Background(), "192.0.2.1", "2001:db8::1")
+	if err != nil {
+		t.Fatalf("Update() returned error: %v", err)
+	}
+	result, err := ParseResult(resp.Data)
+	if err != nil {
+		t.Fatalf("ParseResult() returned error: %v", err)
+	}
+	if want := (&provider.Result{IPv4: "192.0.2.1", IPv6: "2001:db8::1", Changed: true}); !reflect.DeepEqual(want, result) {
+		t.Errorf("ParseResult() expected %+v, got %+v", want, result)
+	}
+}
+
+func TestUpdateDetectIP(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	mux.HandleFunc("/nic/update", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["myip"]; ok {
+			t.Errorf("Request expected without myip, got %v", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, "nochg 192.0.2.1")
+	})
+
+	resp, err := client.Update(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("Update() returned error: %v", err)
+	}
+	if want, got := "nochg 192.0.2.1", resp.Data; want != got {
+		t.Errorf("Update() expected %v, got %v", want, got)
+	}
+}
+
+func TestUpdateStatus(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	status := http.StatusUnauthorized
+	mux.HandleFunc("/nic/update", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+
+	for code, want := range map[int]string{http.StatusUnauthorized: "badauth", http.StatusServiceUnavailable: "911"} {
+		status = code
+		resp, err := client.Update(context.Background(), "", "")
+		if err != nil {
+			t.Fatalf("Update() returned error: %v", err)
+		}
+		if resp.Data != want {
+			t.Errorf("Update() with status %v expected %v, got %v", code, want, resp.Data)
+		}
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	tests := []struct {
+		data      string
+		code      string
+		temporary bool
+	}{
+		{"badauth", "badauth", false},
+		{"good 192.0.2.1\nnohost", "nohost", false},
+		{"abuse", "abuse", false},
+		{"911", "911", true},
+		{"dnserr", "dnserr", true},
+		{"what", "what", false},
+	}
+	for _, test := range tests {
+		_, err := ParseResult(test.data)
+		var e *provider.Error
+		if !errors.As(err, &e) || e.Code != test.code {
+			t.Errorf("ParseResult(%q) expected code %v, got %v", test.data, test.code, err)
+			continue
+		}
+		if got := provider.IsTemporary(err); got != test.temporary {
+			t.Errorf("ParseResult(%q) expected temporary %v, got %v", test.data, test.temporary, got)
+		}
+	}
+
+	if _, err := ParseResult(""); err == nil {
+		t.Errorf("ParseResult() expected an error for an empty response")
+	}
+	result, err := ParseResult("nochg 192.0.2.1")
+	if err != nil || result.Changed || result.IPv4 != "192.0.2.1" {
+		t.Errorf("ParseResult(nochg) expected unchanged 192.0.2.1, got %+v, %v", result, err)
+	}
+}
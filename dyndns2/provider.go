@@ -0,0 +1,56 @@
+package dyndns2
+
+import (
+	"context"
+
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+// Provider adapts the client to the provider interface of the daemon.
+type Provider struct {
+	Client *Client
+}
+
+// NewProvider returns the provider of the client hostnames.
+func NewProvider(client *Client) *Provider {
+	return &Provider{Client: client}
+}
+
+// Name returns the name of the protocol.
+func (p *Provider) Name() string {
+	return "dyndns2"
+}
+
+// Domains returns the hostnames.
+func (p *Provider) Domains() []string {
+	return p.Client.Config.Hostnames
+}
+
+// Capabilities of the protocol, which has neither TXT records nor a clear operation.
+func (p *Provider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{IPv4: true, IPv6: true, DetectIP: true}
+}
+
+// UpdateIP publishes the IPs of the hostnames.
+func (p *Provider) UpdateIP(ctx context.Context, ipv4, ipv6 string) (*provider.Result, error) {
+	resp, err := p.Client.Update(ctx, ipv4, ipv6)
+	if err != nil {
+		return nil, err
+	}
+	return ParseResult(resp.Data)
+}
+
+// ClearIP is not supported.
+func (p *Provider) ClearIP(ctx context.Context) error {
+	return provider.ErrUnsupported
+}
+
+// SetTXT is not supported.
+func (p *Provider) SetTXT(ctx context.Context, value string) error {
+	return provider.ErrUnsupported
+}
+
+// ClearTXT is not supported.
+func (p *Provider) ClearTXT(ctx context.Context, value string) error {
+	return provider.ErrUnsupported
+}
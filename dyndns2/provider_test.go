@@ -0,0 +1,36 @@
+package dyndns2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+func TestProvider(t *testing.T) {
+	setupMockServer()
+	defer teardownMockServer()
+
+	mux.HandleFunc("/nic/update", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "good 192.0.2.1\ngood 192.0.2.1")
+	})
+
+	p := NewProvider(client)
+	result, err := p.UpdateIP(context.Background(), "192.0.2.1", "")
+	if err != nil {
+		t.Fatalf("UpdateIP() returned error: %v", err)
+	}
+	if !result.Changed || result.IPv4 != "192.0.2.1" {
+		t.Errorf("UpdateIP() expected changed 192.0.2.1, got %+v", result)
+	}
+
+	if err := p.SetTXT(context.Background(), "hello"); !errors.Is(err, provider.ErrUnsupported) {
+		t.Errorf("SetTXT() expected to be unsupported, got %v", err)
+	}
+	if p.Capabilities().TXT || p.Capabilities().Clear {
+		t.Errorf("Capabilities() expected without TXT and clear, got %+v", p.Capabilities())
+	}
+}
@@ -0,0 +1,309 @@
+// Package externaldns implements the ExternalDNS webhook provider protocol on top of duckdns.
+//
+// DuckDNS holds one A, one AAAA and one TXT record per domain, every name below a domain
+// resolves to the records of the domain. Only the endpoints of the domains themselves are
+// managed, so that the records reported match the endpoints. Endpoints of other names or
+// types, or with several targets, are dropped by adjustendpoints and rejected when applied.
+package externaldns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+)
+
+const (
+	// MediaType is the content type of the webhook protocol
+	MediaType = "application/external.dns.webhook+json;version=1"
+
+	recordTypeA    = "A"
+	recordTypeAAAA = "AAAA"
+	recordTypeTXT  = "TXT"
+)
+
+// Endpoint is a DNS record as exchanged with ExternalDNS.
+type Endpoint struct {
+	DNSName          string            `json:"dnsName"`
+	Targets          []string          `json:"targets"`
+	RecordType       string            `json:"recordType"`
+	SetIdentifier    string            `json:"setIdentifier,omitempty"`
+	RecordTTL        int64             `json:"recordTTL,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	ProviderSpecific []json.RawMessage `json:"providerSpecific,omitempty"`
+}
+
+// Changes is the plan applied by ExternalDNS, its fields are not renamed in JSON.
+type Changes struct {
+	Create    []*Endpoint
+	UpdateOld []*Endpoint
+	UpdateNew []*Endpoint
+	Delete    []*Endpoint
+}
+
+// DomainFilter is returned by the negotiation.
+type DomainFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Provider serves the webhook endpoints for the domains of the client.
+type Provider struct {
+	Client *duckdns.Client
+}
+
+// NewProvider returns a provider managing the domains of client.
+func NewProvider(client *duckdns.Client) *Provider {
+	return &Provider{Client: client}
+}
+
+// ServeHTTP dispatches the webhook requests.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		p.negotiate(w)
+	case r.URL.Path == "/healthz":
+		w.Write([]byte("ok"))
+	case r.URL.Path == "/records" && r.Method == http.MethodGet:
+		p.records(w, r)
+	case r.URL.Path == "/records" && r.Method == http.MethodPost:
+		p.applyChanges(w, r)
+	case r.URL.Path == "/adjustendpoints" && r.Method == http.MethodPost:
+		p.adjustEndpoints(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Provider) negotiate(w http.ResponseWriter) {
+	filter := DomainFilter{}
+	for _, domain := range p.Client.Config.DomainNames {
+		filter.Include = append(filter.Include, duckdns.FQDN(domain))
+	}
+	writeJSON(w, http.StatusOK, filter)
+}
+
+func (p *Provider) records(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := p.Records(r.Context())
+	if err != nil {
+		klog.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, endpoints)
+}
+
+func (p *Provider) adjustEndpoints(w http.ResponseWriter, r *http.Request) {
+	var endpoints []*Endpoint
+	if err := json.NewDecoder(r.Body).Decode(&endpoints); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.AdjustEndpoints(endpoints))
+}
+
+func (p *Provider) applyChanges(w http.ResponseWriter, r *http.Request) {
+	changes := &Changes{}
+	if err := json.NewDecoder(r.Body).Decode(changes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := p.ApplyChanges(r.Context(), changes); err != nil {
+		klog.Error(err)
+		code := http.StatusInternalServerError
+		if errors.Is(err, errUnsupported) {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Records resolves the A, AAAA and TXT records of every domain with the client resolver.
+func (p *Provider) Records(ctx context.Context) ([]*Endpoint, error) {
+	endpoints := []*Endpoint{}
+	for _, domain := range p.Client.Config.DomainNames {
+		name := duckdns.FQDN(domain)
+		for _, lookup := range []struct {
+			recordType string
+			network    string
+		}{{recordTypeA, "ip4"}, {recordTypeAAAA, "ip6"}, {recordTypeTXT, ""}} {
+			var targets []string
+			var err error
+			if lookup.recordType == recordTypeTXT {
+				targets, err = p.Client.Resolver.LookupTXT(ctx, domain)
+			} else {
+				targets, err = p.Client.Resolver.LookupIP(ctx, lookup.network, domain)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if len(targets) > 0 {
+				endpoints = append(endpoints, &Endpoint{DNSName: name, Targets: targets, RecordType: lookup.recordType})
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+// AdjustEndpoints drops the endpoints that DuckDNS cannot hold.
+func (p *Provider) AdjustEndpoints(endpoints []*Endpoint) []*Endpoint {
+	adjusted := []*Endpoint{}
+	for _, e := range endpoints {
+		if err := p.check(e); err != nil {
+			klog.Warningf("Ignoring endpoint: %v", err)
+			continue
+		}
+		adjusted = append(adjusted, e)
+	}
+	return adjusted
+}
+
+var errUnsupported = errors.New("unsupported endpoint")
+
+func (p *Provider) check(e *Endpoint) error {
+	switch e.RecordType {
+	case recordTypeA, recordTypeAAAA, recordTypeTXT:
+	default:
+		return fmt.Errorf("%w: %v %v, DuckDNS only holds A, AAAA and TXT records", errUnsupported, e.RecordType, e.DNSName)
+	}
+	if len(e.Targets) != 1 {
+		return fmt.Errorf("%w: %v %v has %d targets, DuckDNS holds a single value", errUnsupported, e.RecordType, e.DNSName, len(e.Targets))
+	}
+
+	domain, err := duckdns.Subdomain(e.DNSName)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUnsupported, err)
+	}
+	for _, d := range p.Client.Config.DomainNames {
+		if sub, _ := duckdns.Subdomain(duckdns.FQDN(d)); sub != domain {
+			continue
+		}
+		if name := strings.TrimSuffix(strings.ToLower(e.DNSName), "."); name != duckdns.FQDN(domain) {
+			return fmt.Errorf("%w: %v is below %v, DuckDNS only holds the records of the domain", errUnsupported, e.DNSName, duckdns.FQDN(domain))
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %v is not a configured domain", errUnsupported, e.DNSName)
+}
+
+// state is the records of a domain to publish
+type state struct {
+	ipv4, ipv6, txt    string
+	clearIP, clearIPv4 bool
+	clearTXT           string
+}
+
+// ApplyChanges publishes the created and updated endpoints and clears the deleted ones.
+// Deleting an A or AAAA record clears both, as DuckDNS has a single clear operation.
+func (p *Provider) ApplyChanges(ctx context.Context, changes *Changes) error {
+	states := make(map[string]*state)
+	get := func(e *Endpoint) (*state, error) {
+		if err := p.check(e); err != nil {
+			return nil, err
+		}
+		domain, _ := duckdns.Subdomain(e.DNSName)
+		if states[domain] == nil {
+			states[domain] = &state{}
+		}
+		return states[domain], nil
+	}
+
+	for _, e := range changes.Delete {
+		s, err := get(e)
+		if err != nil {
+			return err
+		}
+		if e.RecordType != recordTypeTXT {
+			s.clearIP = true
+			s.clearIPv4 = s.clearIPv4 || e.RecordType == recordTypeA
+		} else if err := set(&s.clearTXT, e); err != nil {
+			return err
+		}
+	}
+	for _, e := range append(changes.Create, changes.UpdateNew...) {
+		s, err := get(e)
+		if err != nil {
+			return err
+		}
+		value := &s.txt
+		switch e.RecordType {
+		case recordTypeA:
+			value = &s.ipv4
+		case recordTypeAAAA:
+			value = &s.ipv6
+		}
+		if err := set(value, e); err != nil {
+			return err
+		}
+	}
+
+	domains := make([]string, 0, len(states))
+	for domain := range states {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	for _, domain := range domains {
+		if err := p.apply(ctx, domain, states[domain]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set sets value to the target of e, an endpoint of the same domain and type with another
+// target is a conflict as DuckDNS holds a single value
+func set(value *string, e *Endpoint) error {
+	if *value != "" && *value != e.Targets[0] {
+		return fmt.Errorf("%w: %v %v has several values, DuckDNS holds a single value", errUnsupported, e.RecordType, e.DNSName)
+	}
+	*value = e.Targets[0]
+	return nil
+}
+
+func (p *Provider) apply(ctx context.Context, domain string, s *state) error {
+	client := p.Client.WithDomains(domain)
+	var calls []func() (*duckdns.Response, error)
+
+	if s.clearIP && s.ipv4 == "" && s.ipv6 == "" {
+		calls = append(calls, func() (*duckdns.Response, error) { return client.ClearIP(ctx) })
+	}
+	if s.ipv4 == "" && s.ipv6 != "" {
+		// the A record is kept unless the batch deletes it
+		calls = append(calls, func() (*duckdns.Response, error) { return client.UpdateIPv6(ctx, s.ipv6, !s.clearIPv4) })
+	} else if s.ipv4 != "" {
+		calls = append(calls, func() (*duckdns.Response, error) { return client.UpdateIPWithValues(ctx, s.ipv4, s.ipv6) })
+	}
+	if s.clearTXT != "" && s.txt == "" {
+		calls = append(calls, func() (*duckdns.Response, error) { return client.ClearRecord(ctx, s.clearTXT) })
+	}
+	if s.txt != "" {
+		calls = append(calls, func() (*duckdns.Response, error) { return client.UpdateRecord(ctx, s.txt) })
+	}
+
+	for _, call := range calls {
+		if _, err := duckdns.Check(call()); err != nil {
+			return fmt.Errorf("Unable to update %v, %w", duckdns.FQDN(domain), err)
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", MediaType)
+	w.Header().Set("Vary", "Content-Type")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.Error(err)
+	}
+}
@@ -0,0 +1,216 @@
+package externaldns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+)
+
+// staticResolver answers from a map keyed by "<network> <domain>"
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return r["txt "+domain], nil
+}
+
+func (r staticResolver) LookupIP(ctx context.Context, network, domain string) ([]string, error) {
+	return r[network+" "+domain], nil
+}
+
+func (r staticResolver) String() string {
+	return "static"
+}
+
+type fixture struct {
+	provider *Provider
+	queries  []url.Values
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.queries = append(f.queries, r.URL.Query())
+		fmt.Fprint(w, "OK")
+	}))
+	t.Cleanup(server.Close)
+
+	config := &duckdns.Config{Token: "example-token", DomainNames: []string{"example", "other"}}
+	client := duckdns.NewClient(server.Client(), config)
+	client.BaseURL = server.URL
+	client.SetResolver(staticResolver{
+		"ip4 example": {"10.10.10.253"},
+		"txt example": {"heritage=external-dns"},
+		"ip4 other":   {"10.10.10.1"},
+	})
+	f.provider = NewProvider(client)
+	return f
+}
+
+func (f *fixture) do(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", MediaType)
+	f.provider.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNegotiate(t *testing.T) {
+	f := newFixture(t)
+	rec := f.do(t, http.MethodGet, "/", "")
+
+	if got := rec.Header().Get("Content-Type"); got != MediaType {
+		t.Errorf("Content-Type expected to be %v, got %v", MediaType, got)
+	}
+	filter := DomainFilter{}
+	json.NewDecoder(rec.Body).Decode(&filter)
+	if want := []string{"example.duckdns.org", "other.duckdns.org"}; !reflect.DeepEqual(want, filter.Include) {
+		t.Errorf("Domain filter expected %v, got %v", want, filter.Include)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	f := newFixture(t)
+	rec := f.do(t, http.MethodGet, "/records", "")
+
+	var endpoints []*Endpoint
+	json.NewDecoder(rec.Body).Decode(&endpoints)
+	want := []*Endpoint{
+		{DNSName: "example.duckdns.org", Targets: []string{"10.10.10.253"}, RecordType: "A"},
+		{DNSName: "example.duckdns.org", Targets: []string{"heritage=external-dns"}, RecordType: "TXT"},
+		{DNSName: "other.duckdns.org", Targets: []string{"10.10.10.1"}, RecordType: "A"},
+	}
+	if !reflect.DeepEqual(want, endpoints) {
+		t.Errorf("Records expected %v, got %v", want, endpoints)
+	}
+}
+
+func TestAdjustEndpoints(t *testing.T) {
+	f := newFixture(t)
+	body := `[
+		{"dnsName":"example.duckdns.org","targets":["10.10.10.253"],"recordType":"A"},
+		{"dnsName":"www.example.duckdns.org","targets":["example.duckdns.org"],"recordType":"CNAME"},
+		{"dnsName":"www.example.duckdns.org","targets":["10.10.10.253"],"recordType":"A"},
+		{"dnsName":"_externaldns.example.duckdns.org","targets":["heritage=external-dns"],"recordType":"TXT"},
+		{"dnsName":"example.duckdns.org","targets":["10.0.0.1","10.0.0.2"],"recordType":"A"},
+		{"dnsName":"unknown.duckdns.org","targets":["10.0.0.1"],"recordType":"A"},
+		{"dnsName":"example.com","targets":["10.0.0.1"],"recordType":"A"}
+	]`
+	rec := f.do(t, http.MethodPost, "/adjustendpoints", body)
+
+	var endpoints []*Endpoint
+	json.NewDecoder(rec.Body).Decode(&endpoints)
+	if len(endpoints) != 1 || endpoints[0].RecordType != "A" || endpoints[0].Targets[0] != "10.10.10.253" {
+		t.Errorf("AdjustEndpoints expected to keep the single target A record, got %v", endpoints)
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	f := newFixture(t)
+	body := `{
+		"Create": [
+			{"dnsName":"example.duckdns.org","targets":["10.10.10.254"],"recordType":"A"},
+			{"dnsName":"example.duckdns.org.","targets":["\"heritage=external-dns,external-dns/owner=default\""],"recordType":"TXT"}
+		],
+		"UpdateOld": [{"dnsName":"other.duckdns.org","targets":["10.10.10.1"],"recordType":"A"}],
+		"UpdateNew": [{"dnsName":"other.duckdns.org","targets":["2001:db8::1"],"recordType":"AAAA"}],
+		"Delete": []
+	}`
+	rec := f.do(t, http.MethodPost, "/records", body)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("ApplyChanges expected to return 204, got %v: %v", rec.Code, rec.Body)
+	}
+
+	want := []map[string]string{
+		{"domains": "example", "ip": "10.10.10.254", "ipv6": ""},
+		{"domains": "example", "txt": "\"heritage=external-dns,external-dns/owner=default\""},
+		// the A record of other is kept when only its AAAA record changes
+		{"domains": "other", "ip": "10.10.10.1", "ipv6": "2001:db8::1"},
+	}
+	if len(f.queries) != len(want) {
+		t.Fatalf("Expected %d duckdns requests, got %v", len(want), f.queries)
+	}
+	for i, w := range want {
+		for k, v := range w {
+			if got := f.queries[i].Get(k); got != v {
+				t.Errorf("Request %d %v expected %q, got %q", i, k, v, got)
+			}
+		}
+	}
+}
+
+func TestApplyChangesDelete(t *testing.T) {
+	f := newFixture(t)
+	body := `{"Delete": [
+		{"dnsName":"example.duckdns.org","targets":["10.10.10.253"],"recordType":"A"},
+		{"dnsName":"example.duckdns.org","targets":["heritage=external-dns"],"recordType":"TXT"}
+	]}`
+	rec := f.do(t, http.MethodPost, "/records", body)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("ApplyChanges expected to return 204, got %v: %v", rec.Code, rec.Body)
+	}
+
+	if len(f.queries) != 2 || f.queries[0].Get("clear") != "true" || f.queries[0].Get("txt") != "" ||
+		f.queries[1].Get("clear") != "true" || f.queries[1].Get("txt") != "heritage=external-dns" {
+		t.Errorf("Expected a clear of the IP then of the TXT record, got %v", f.queries)
+	}
+}
+
+func TestApplyChangesIPv6Only(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		resolver staticResolver
+		body     string
+	}{
+		{"no A record", staticResolver{}, `{"Create": [
+			{"dnsName":"example.duckdns.org","targets":["2001:db8::1"],"recordType":"AAAA"}
+		]}`},
+		{"A record deleted", nil, `{
+			"Create": [{"dnsName":"example.duckdns.org","targets":["2001:db8::1"],"recordType":"AAAA"}],
+			"Delete": [{"dnsName":"example.duckdns.org","targets":["10.10.10.253"],"recordType":"A"}]
+		}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFixture(t)
+			if test.resolver != nil {
+				f.provider.Client.SetResolver(test.resolver)
+			}
+			rec := f.do(t, http.MethodPost, "/records", test.body)
+			if rec.Code != http.StatusNoContent {
+				t.Fatalf("ApplyChanges expected to return 204, got %v: %v", rec.Code, rec.Body)
+			}
+
+			// an empty ip would publish the address of the webhook
+			if len(f.queries) != 2 || f.queries[0].Get("clear") != "true" ||
+				f.queries[1].Get("ipv6") != "2001:db8::1" || f.queries[1]["ip"] != nil {
+				t.Errorf("Expected a clear of the IP then an update of the IPv6 alone, got %v", f.queries)
+			}
+		})
+	}
+}
+
+func TestApplyChangesUnsupported(t *testing.T) {
+	for _, body := range []string{
+		`{"Create": [{"dnsName":"example.duckdns.org","targets":["mail.example.com"],"recordType":"MX"}]}`,
+		`{"Create": [{"dnsName":"_externaldns.example.duckdns.org","targets":["heritage=external-dns"],"recordType":"TXT"}]}`,
+		`{"Create": [{"dnsName":"example.duckdns.org","targets":["10.0.0.1"],"recordType":"A"}],
+		  "UpdateNew": [{"dnsName":"example.duckdns.org.","targets":["10.0.0.2"],"recordType":"A"}]}`,
+	} {
+		f := newFixture(t)
+		rec := f.do(t, http.MethodPost, "/records", body)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("ApplyChanges expected to reject %v, got %v", body, rec.Code)
+		}
+		if len(f.queries) != 0 {
+			t.Errorf("No duckdns request expected, got %v", f.queries)
+		}
+	}
+}
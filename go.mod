@@ -4,6 +4,8 @@ go 1.15
 
 require (
 	github.com/heetch/confita v0.10.0
-	k8s.io/klog v1.0.0
+	github.com/libdns/libdns v0.2.1
+	github.com/miekg/dns v1.1.43
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
 	k8s.io/klog/v2 v2.8.0
 )
@@ -0,0 +1,236 @@
+// Package libdnsprovider implements the libdns record interfaces used by reverse proxies
+// such as Caddy on top of duckdns.
+//
+// DuckDNS holds one A, one AAAA and one TXT record per domain and every name below a domain
+// resolves to the records of the domain. Appending or setting a record replaces the value of
+// its type, and records of other types are rejected. Reads go through the resolver of the client.
+package libdnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/libdns/libdns"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+)
+
+const (
+	recordTypeA    = "A"
+	recordTypeAAAA = "AAAA"
+	recordTypeTXT  = "TXT"
+)
+
+var errUnsupported = errors.New("unsupported record")
+
+// Provider manages the records of the domains of a duckdns client.
+type Provider struct {
+	Client *duckdns.Client
+
+	mu sync.Mutex
+	// txt holds the TXT value last published per domain
+	txt map[string]string
+}
+
+// Interface guards
+var (
+	_ libdns.RecordGetter   = (*Provider)(nil)
+	_ libdns.RecordAppender = (*Provider)(nil)
+	_ libdns.RecordSetter   = (*Provider)(nil)
+	_ libdns.RecordDeleter  = (*Provider)(nil)
+)
+
+// NewProvider returns a provider publishing the records with client.
+func NewProvider(client *duckdns.Client) *Provider {
+	return &Provider{Client: client}
+}
+
+// GetRecords returns the A, AAAA and TXT records of the zone. For the duckdns.org zone,
+// the records of the configured domains are returned.
+func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	zone = canonicalZone(zone)
+	domains := p.Client.Config.DomainNames
+	if domain, err := duckdns.Subdomain(zone); err == nil {
+		domains = []string{domain}
+	}
+
+	var records []libdns.Record
+	for _, domain := range domains {
+		name := libdns.RelativeName(duckdns.FQDN(domain)+".", zone)
+		for _, lookup := range []struct {
+			recordType string
+			network    string
+		}{{recordTypeA, "ip4"}, {recordTypeAAAA, "ip6"}, {recordTypeTXT, ""}} {
+			var values []string
+			var err error
+			if lookup.recordType == recordTypeTXT {
+				values, err = p.Client.Resolver.LookupTXT(ctx, domain)
+			} else {
+				values, err = p.Client.Resolver.LookupIP(ctx, lookup.network, domain)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Unable to get the records of %v, %v", duckdns.FQDN(domain), err)
+			}
+			for _, value := range values {
+				records = append(records, libdns.Record{Type: lookup.recordType, Name: name, Value: value})
+			}
+		}
+	}
+	return records, nil
+}
+
+// AppendRecords publishes the records. DuckDNS holds a single value per type, so the
+// previous value of the same type is replaced.
+func (p *Provider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return p.SetRecords(ctx, zone, recs)
+}
+
+// SetRecords publishes the records, replacing the current values of their types.
+func (p *Provider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	states, err := p.group(zone, recs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, domain := range sortedDomains(states) {
+		s := states[domain]
+		client := p.Client.WithDomains(domain)
+		if s.ipv4 == "" && s.ipv6 != "" {
+			if err := call(domain, func() (*duckdns.Response, error) { return client.UpdateIPv6(ctx, s.ipv6, true) }); err != nil {
+				return nil, err
+			}
+		} else if s.ipv4 != "" {
+			if err := call(domain, func() (*duckdns.Response, error) { return client.UpdateIPWithValues(ctx, s.ipv4, s.ipv6) }); err != nil {
+				return nil, err
+			}
+		}
+		if s.txt != "" {
+			if err := call(domain, func() (*duckdns.Response, error) { return client.UpdateRecord(ctx, s.txt) }); err != nil {
+				return nil, err
+			}
+			p.mu.Lock()
+			if p.txt == nil {
+				p.txt = make(map[string]string)
+			}
+			p.txt[domain] = s.txt
+			p.mu.Unlock()
+		}
+	}
+	return recs, nil
+}
+
+// DeleteRecords clears the records. Deleting an A or AAAA record clears both, as DuckDNS
+// has a single clear operation, and a TXT value which was replaced since it was published
+// by this provider is left alone.
+func (p *Provider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	states, err := p.group(zone, recs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, domain := range sortedDomains(states) {
+		s := states[domain]
+		client := p.Client.WithDomains(domain)
+		if s.ipv4 != "" || s.ipv6 != "" {
+			if err := call(domain, func() (*duckdns.Response, error) { return client.ClearIP(ctx) }); err != nil {
+				return nil, err
+			}
+		}
+		if s.txt == "" {
+			continue
+		}
+
+		p.mu.Lock()
+		current, published := p.txt[domain]
+		p.mu.Unlock()
+		if published && current != s.txt {
+			recs = without(recs, s.txt)
+			continue
+		}
+		if err := call(domain, func() (*duckdns.Response, error) { return client.ClearRecord(ctx, s.txt) }); err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		delete(p.txt, domain)
+		p.mu.Unlock()
+	}
+	return recs, nil
+}
+
+// state is the records of a domain to publish or clear
+type state struct {
+	ipv4, ipv6, txt string
+}
+
+// group checks the records and groups them by domain
+func (p *Provider) group(zone string, recs []libdns.Record) (map[string]*state, error) {
+	zone = canonicalZone(zone)
+	states := make(map[string]*state)
+	for _, rec := range recs {
+		name := libdns.AbsoluteName(rec.Name, zone)
+		domain, err := duckdns.Subdomain(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errUnsupported, err)
+		}
+		if rec.Value == "" {
+			return nil, fmt.Errorf("%w: %v %v has no value", errUnsupported, rec.Type, name)
+		}
+		if states[domain] == nil {
+			states[domain] = &state{}
+		}
+		s := states[domain]
+
+		var value *string
+		switch strings.ToUpper(rec.Type) {
+		case recordTypeA:
+			value = &s.ipv4
+		case recordTypeAAAA:
+			value = &s.ipv6
+		case recordTypeTXT:
+			value = &s.txt
+		default:
+			return nil, fmt.Errorf("%w: %v %v, DuckDNS only holds A, AAAA and TXT records", errUnsupported, rec.Type, name)
+		}
+		if *value != "" && *value != rec.Value {
+			return nil, fmt.Errorf("%w: %v %v has several values, DuckDNS holds a single value", errUnsupported, rec.Type, duckdns.FQDN(domain))
+		}
+		*value = rec.Value
+	}
+	return states, nil
+}
+
+// canonicalZone returns zone with a trailing dot, as libdns names are relative to it
+func canonicalZone(zone string) string {
+	return strings.TrimSuffix(zone, ".") + "."
+}
+
+func call(domain string, f func() (*duckdns.Response, error)) error {
+	if _, err := duckdns.Check(f()); err != nil {
+		return fmt.Errorf("Unable to update %v, %w", duckdns.FQDN(domain), err)
+	}
+	return nil
+}
+
+func sortedDomains(states map[string]*state) []string {
+	domains := make([]string, 0, len(states))
+	for domain := range states {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// without returns the records except the TXT records of value
+func without(recs []libdns.Record, value string) []libdns.Record {
+	kept := make([]libdns.Record, 0, len(recs))
+	for _, rec := range recs {
+		if strings.ToUpper(rec.Type) != recordTypeTXT || rec.Value != value {
+			kept = append(kept, rec)
+		}
+	}
+	return kept
+}
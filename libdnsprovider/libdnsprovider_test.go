@@ -0,0 +1,213 @@
+package libdnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/libdns/libdns"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+// staticResolver answers from a map keyed by "<network> <domain>"
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	return r["txt "+domain], nil
+}
+
+func (r staticResolver) LookupIP(ctx context.Context, network, domain string) ([]string, error) {
+	return r[network+" "+domain], nil
+}
+
+func (r staticResolver) String() string {
+	return "static"
+}
+
+type fixture struct {
+	provider *Provider
+	queries  []url.Values
+	answer   string
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{answer: "OK"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.queries = append(f.queries, r.URL.Query())
+		fmt.Fprint(w, f.answer)
+	}))
+	t.Cleanup(server.Close)
+
+	config := &duckdns.Config{Token: "example-token", DomainNames: []string{"example", "other"}}
+	client := duckdns.NewClient(server.Client(), config)
+	client.BaseURL = server.URL
+	client.SetResolver(staticResolver{
+		"ip4 example": {"10.10.10.253"},
+		"txt example": {"challenge"},
+		"ip4 other":   {"10.10.10.1"},
+	})
+	f.provider = NewProvider(client)
+	return f
+}
+
+func (f *fixture) query(t *testing.T, i int, want map[string]string) {
+	t.Helper()
+	if len(f.queries) <= i {
+		t.Fatalf("Expected query %d, got %d queries", i, len(f.queries))
+	}
+	for key, value := range want {
+		if got := f.queries[i].Get(key); got != value {
+			t.Errorf("Query %d expected %v=%v, got %v", i, key, value, got)
+		}
+	}
+}
+
+func TestGetRecords(t *testing.T) {
+	f := newFixture(t)
+
+	tests := []struct {
+		zone string
+		want []libdns.Record
+	}{
+		{"example.duckdns.org.", []libdns.Record{
+			{Type: "A", Name: "", Value: "10.10.10.253"},
+			{Type: "TXT", Name: "", Value: "challenge"},
+		}},
+		{"duckdns.org", []libdns.Record{
+			{Type: "A", Name: "example", Value: "10.10.10.253"},
+			{Type: "TXT", Name: "example", Value: "challenge"},
+			{Type: "A", Name: "other", Value: "10.10.10.1"},
+		}},
+	}
+	for _, test := range tests {
+		got, err := f.provider.GetRecords(context.Background(), test.zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(test.want, got) {
+			t.Errorf("Records of %v expected %v, got %v", test.zone, test.want, got)
+		}
+	}
+}
+
+func TestAppendRecords(t *testing.T) {
+	f := newFixture(t)
+
+	recs := []libdns.Record{{Type: "TXT", Name: "_acme-challenge", Value: "token"}}
+	got, err := f.provider.AppendRecords(context.Background(), "example.duckdns.org.", recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recs, got) {
+		t.Errorf("Appended records expected %v, got %v", recs, got)
+	}
+	f.query(t, 0, map[string]string{"domains": "example", "txt": "token", "clear": ""})
+}
+
+func TestSetRecords(t *testing.T) {
+	f := newFixture(t)
+
+	_, err := f.provider.SetRecords(context.Background(), "duckdns.org.", []libdns.Record{
+		{Type: "AAAA", Name: "www.example", Value: "::1"},
+		{Type: "A", Name: "other", Value: "10.10.10.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the current A record is kept when only the AAAA record is set
+	f.query(t, 0, map[string]string{"domains": "example", "ip": "10.10.10.253", "ipv6": "::1"})
+	f.query(t, 1, map[string]string{"domains": "other", "ip": "10.10.10.2", "ipv6": ""})
+}
+
+func TestSetRecordsNoA(t *testing.T) {
+	f := newFixture(t)
+	f.provider.Client.SetResolver(staticResolver{})
+
+	_, err := f.provider.SetRecords(context.Background(), "example.duckdns.org.", []libdns.Record{{Type: "AAAA", Value: "::1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an empty ip would publish the address of the caller
+	f.query(t, 0, map[string]string{"domains": "example", "clear": "true"})
+	f.query(t, 1, map[string]string{"domains": "example", "ipv6": "::1"})
+	if _, ok := f.queries[1]["ip"]; ok || len(f.queries) != 2 {
+		t.Errorf("Expected the IPv6 to be updated alone, got %v", f.queries)
+	}
+}
+
+func TestSetRecordsZeroProvider(t *testing.T) {
+	f := newFixture(t)
+	p := &Provider{Client: f.provider.Client}
+
+	if _, err := p.SetRecords(context.Background(), "example.duckdns.org.", []libdns.Record{{Type: "TXT", Value: "token"}}); err != nil {
+		t.Fatal(err)
+	}
+	f.query(t, 0, map[string]string{"domains": "example", "txt": "token"})
+}
+
+func TestSetRecordsUnsupported(t *testing.T) {
+	f := newFixture(t)
+
+	for _, recs := range [][]libdns.Record{
+		{{Type: "CNAME", Name: "www", Value: "example.com."}},
+		{{Type: "TXT", Name: "a", Value: "one"}, {Type: "TXT", Name: "b", Value: "two"}},
+		{{Type: "A", Name: "", Value: ""}},
+	} {
+		if _, err := f.provider.SetRecords(context.Background(), "example.duckdns.org.", recs); !errors.Is(err, errUnsupported) {
+			t.Errorf("Records %v expected to be unsupported, got %v", recs, err)
+		}
+	}
+	if _, err := f.provider.SetRecords(context.Background(), "example.com.", []libdns.Record{{Type: "A", Value: "10.0.0.1"}}); !errors.Is(err, errUnsupported) {
+		t.Errorf("Zone example.com expected to be unsupported, got %v", err)
+	}
+	if len(f.queries) != 0 {
+		t.Errorf("No query expected, got %v", f.queries)
+	}
+}
+
+func TestSetRecordsKO(t *testing.T) {
+	f := newFixture(t)
+	f.answer = "KO"
+
+	var rejected *provider.Error
+	if _, err := f.provider.SetRecords(context.Background(), "example.duckdns.org.", []libdns.Record{{Type: "TXT", Value: "token"}}); !errors.As(err, &rejected) {
+		t.Errorf("Expected a provider error when duckdns answers KO, got %v", err)
+	}
+}
+
+func TestDeleteRecords(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	f.provider.AppendRecords(ctx, "example.duckdns.org.", []libdns.Record{{Type: "TXT", Name: "_acme-challenge", Value: "first"}})
+	f.provider.AppendRecords(ctx, "example.duckdns.org.", []libdns.Record{{Type: "TXT", Name: "_acme-challenge", Value: "second"}})
+
+	// the first value was replaced, deleting it keeps the second one
+	got, err := f.provider.DeleteRecords(ctx, "example.duckdns.org.", []libdns.Record{{Type: "TXT", Name: "_acme-challenge", Value: "first"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 || len(f.queries) != 2 {
+		t.Errorf("No record expected to be deleted, got %v after %d queries", got, len(f.queries))
+	}
+
+	got, err = f.provider.DeleteRecords(ctx, "example.duckdns.org.", []libdns.Record{
+		{Type: "TXT", Name: "_acme-challenge", Value: "second"},
+		{Type: "A", Name: "", Value: "10.10.10.253"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("Two records expected to be deleted, got %v", got)
+	}
+	f.query(t, 2, map[string]string{"domains": "example", "clear": "true", "txt": ""})
+	f.query(t, 3, map[string]string{"domains": "example", "clear": "true", "txt": "second"})
+}
@@ -2,13 +2,37 @@ package main
 
 import (
 	"context"
-	"k8s.io/klog"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"k8s.io/klog/v2"
+
+	"github.com/ebrianne/duckdns-go/certificate"
+	"github.com/ebrianne/duckdns-go/certmanager"
+	"github.com/ebrianne/duckdns-go/cli"
+	"github.com/ebrianne/duckdns-go/cloudflare"
 	"github.com/ebrianne/duckdns-go/config"
+	"github.com/ebrianne/duckdns-go/controller"
+	"github.com/ebrianne/duckdns-go/daemon"
+	"github.com/ebrianne/duckdns-go/dns01"
 	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/dyndns2"
+	"github.com/ebrianne/duckdns-go/kube"
+	"github.com/ebrianne/duckdns-go/metrics"
+	"github.com/ebrianne/duckdns-go/notify"
+	"github.com/ebrianne/duckdns-go/provider"
+	"github.com/ebrianne/duckdns-go/redact"
+	"github.com/ebrianne/duckdns-go/rfc2136"
+	"github.com/ebrianne/duckdns-go/schedule"
+	"github.com/ebrianne/duckdns-go/server"
+	"github.com/ebrianne/duckdns-go/verify"
 )
 
 const (
@@ -16,102 +40,444 @@ const (
 )
 
 var (
-	c      *config.ClientConfig
-	client *duckdns.Client
+	c           *config.ClientConfig
+	client      *duckdns.Client
+	dnsProvider provider.Provider
+	notifier    *notify.Dispatcher
+	verifier    *verify.Verifier
 )
 
 func main() {
-	c = config.Load()
+	klog.SetLogFilter(redact.Filter{})
+	err := newApp(filepath.Base(os.Args[0])).Run(os.Args[1:])
+	var usage *cli.UsageError
+	switch {
+	case err == nil:
+		return
+	case errors.As(err, new(*reportedError)):
+	case errors.As(err, &usage):
+		reportUsage(stdout, os.Args[1:], err)
+	default:
+		klog.Error(err)
+	}
+	klog.Flush()
+	os.Exit(exitCode(err))
+}
+
+func newApp(name string) *cli.App {
+	return &cli.App{
+		Name:     name,
+		Commands: commands,
+		Legacy:   legacyFlags,
+		Flags: func(fs *flag.FlagSet) error {
+			c = config.New(fs)
+			return c.LoadEnv()
+		},
+	}
+}
+
+// setup configures the notifications, the verification and the provider of the update commands
+func setup() error {
+	client, dnsProvider = nil, nil
 	config := &duckdns.Config{}
 	config.Token = c.Token
 	config.DomainNames = c.DomainNames
 	config.Verbose = c.Verbose
-	client = duckdns.NewClient(http.DefaultClient, config)
 
-	if c.UpdateIP {
-		UpdateIP(c.IPv4, c.IPv6)
-		for range time.Tick(c.Interval) {
-			UpdateIP(c.IPv4, c.IPv6)
+	var err error
+	notifier, err = notify.New(&notify.Config{
+		SlackURL:         c.Notify.SlackURL,
+		DiscordURL:       c.Notify.DiscordURL,
+		MatrixURL:        c.Notify.MatrixURL,
+		NtfyURL:          c.Notify.NtfyURL,
+		NtfyToken:        c.Notify.NtfyToken,
+		GotifyURL:        c.Notify.GotifyURL,
+		GotifyToken:      c.Notify.GotifyToken,
+		SMTPAddr:         c.Notify.SMTPAddr,
+		SMTPUsername:     c.Notify.SMTPUsername,
+		SMTPPassword:     c.Notify.SMTPPassword,
+		SMTPFrom:         c.Notify.SMTPFrom,
+		SMTPTo:           c.Notify.SMTPTo,
+		ChangeTemplate:   c.Notify.ChangeTemplate,
+		FailureTemplate:  c.Notify.FailureTemplate,
+		RecoveryTemplate: c.Notify.RecoveryTemplate,
+		FailureThreshold: c.Notify.FailureThreshold,
+		MinInterval:      c.Notify.MinInterval,
+	}, http.DefaultClient)
+	if err != nil {
+		return configErrorf("Could not configure the notifications: %v", err)
+	}
+	if c.Verify.Enabled {
+		// verification lookups are never cached
+		resolvers, err := duckdns.NewResolvers(c.Verify.Resolvers, duckdns.ResolverOptions{Timeout: c.ResolverTimeout})
+		if err != nil {
+			return configErrorf("Could not configure the verification resolvers: %v", err)
+		}
+		verifier = &verify.Verifier{Resolvers: resolvers}
+	}
+	if notifier.Enabled() || verifier != nil || c.Output == outputJSON {
+		// the verbose response tells whether the IP has changed and which one was published
+		config.Verbose = true
+	}
+	if c.MetricsAddr != "" {
+		metrics.Serve(c.MetricsAddr)
+	}
+
+	switch c.Provider {
+	case "duckdns", "":
+		if !config.Valid() {
+			return configErrorf("The duckdns provider needs -duckdns_token and -duckdns_domains")
 		}
-	} else if c.ClearIP {
-		ClearIP()
-	} else if c.UpdateRecord {
-		if c.Record == "" {
-			klog.Error("Provided TXT record empty... It needs to be provided with -record string to update the txt record")
-			return
+		client = duckdns.NewClient(http.DefaultClient, config)
+		client.BaseURL = c.BaseURL
+		client.Limiter = newLimiter()
+		resolver, err := duckdns.NewResolver(c.Resolver, duckdns.ResolverOptions{Timeout: c.ResolverTimeout, CacheTTL: c.ResolverCache})
+		if err != nil {
+			return configErrorf("Could not configure the resolver: %v", err)
 		}
-		UpdateRecord(c.Record)
-	} else if c.GetRecord {
-		GetRecord()
-	} else if c.ClearRecord {
-		if c.Record == "" {
-			klog.Error("Provided TXT record empty... It needs to be provided with -record string to clear the txt record")
-			return
+		client.SetResolver(resolver)
+		dnsProvider = duckdns.NewProvider(client)
+	case "dyndns2":
+		config := &dyndns2.Config{
+			Server:    c.DynDNS2.Server,
+			Username:  c.DynDNS2.Username,
+			Password:  c.DynDNS2.Password,
+			Hostnames: c.DynDNS2.Hostnames,
 		}
-		ClearRecord(c.Record)
-	} else {
-		klog.Error("CLI option provided unknown...")
+		if !config.Valid() {
+			return configErrorf("The dyndns2 provider needs -dyndns2_server, -dyndns2_username, -dyndns2_password and -dyndns2_hostnames")
+		}
+		dnsProvider = dyndns2.NewProvider(dyndns2.NewClient(http.DefaultClient, config))
+	case "rfc2136":
+		dnsProvider, err = rfc2136.NewProvider(&rfc2136.Config{
+			Server:        c.RFC2136.Server,
+			Network:       c.RFC2136.Network,
+			Zone:          c.RFC2136.Zone,
+			Names:         c.RFC2136.Names,
+			TTL:           c.RFC2136.TTL,
+			TSIGKey:       c.RFC2136.TSIGKey,
+			TSIGSecret:    c.RFC2136.TSIGSecret,
+			TSIGAlgorithm: c.RFC2136.TSIGAlgorithm,
+			Timeout:       c.ResolverTimeout,
+		})
+		if err != nil {
+			return configErrorf("Could not configure the RFC 2136 provider: %v", err)
+		}
+	case "cloudflare":
+		api := cloudflare.NewClient(http.DefaultClient, c.Cloudflare.Token)
+		api.BaseURL = c.Cloudflare.APIURL
+		dnsProvider, err = cloudflare.NewProvider(api, &cloudflare.Config{
+			Names:  c.Cloudflare.Names,
+			Create: c.Cloudflare.Create,
+			TTL:    c.Cloudflare.TTL,
+		})
+		if err != nil {
+			return configErrorf("Could not configure the Cloudflare provider: %v", err)
+		}
+	default:
+		return configErrorf("Unknown provider %q, it needs to be duckdns, dyndns2, rfc2136 or cloudflare", c.Provider)
+	}
+	if c.DryRun {
+		if client == nil {
+			return configErrorf("-dry-run needs the duckdns provider")
+		}
+		client.DryRun = &duckdns.DryRun{}
+		// nothing is published, so nothing to verify
+		verifier = nil
+	}
+	return nil
+}
+
+// needDuckDNS returns an error when the command uses the duckdns client with another provider
+func needDuckDNS(command string) error {
+	if client == nil {
+		return configErrorf("%v needs the duckdns provider", command)
 	}
+	return nil
 }
 
-func UpdateIP(ipv4, ipv6 string) {
-	var body string
+// UpdateIP updates the IP on the schedule, and as soon as the detected IP changes with a
+// detect_interval.
+func UpdateIP(updates schedule.Schedule) {
+	d := newDaemon()
+	d.Schedule = updates
+	d.DelayStart = !c.Schedule.OnStart
+	if c.Breaker.Threshold > 0 {
+		d.Breaker = daemon.NewBreaker(c.Breaker.Threshold, c.Breaker.Backoff, c.Breaker.MaxBackoff)
+	}
+	if c.Schedule.DetectInterval > 0 {
+		d.Detect = detectIP
+		d.DetectInterval = c.Schedule.DetectInterval
+	}
+	d.Run(context.Background())
+}
 
-	if ipv4 == "" && ipv6 == "" {
-		resp, err := client.UpdateIP(context.Background())
+// newSchedule returns the schedule of the updates of the daemon
+func newSchedule() (schedule.Schedule, error) {
+	if c.Schedule.DetectInterval > 0 && !c.AutoIP && !c.IPv4Only {
+		return nil, configErrorf("-detect_interval needs -auto-ip or -ipv4-only to detect the IP")
+	}
+
+	updates := schedule.Every(c.Interval)
+	if c.Schedule.Cron != "" {
+		var err error
+		if updates, err = schedule.Parse(c.Schedule.Cron); err != nil {
+			return nil, &configError{err: err}
+		}
+		now := time.Now()
+		if next := updates.Next(now); updates.Next(next).Sub(next) < 10*time.Minute {
+			klog.Warningf("The schedule %q updates more than once every 10 mins, which is not recommanded", c.Schedule.Cron)
+		}
+	}
+
+	var windows []schedule.Window
+	for _, quiet := range c.Schedule.Quiet {
+		w, err := schedule.ParseWindow(quiet)
 		if err != nil {
-			klog.Fatal("UpdateIP() returned error: ", err)
+			return nil, &configError{err: err}
 		}
-		body = SplitAndJoin(resp.Data)
+		windows = append(windows, w)
+	}
+	// the jitter is applied first so that it cannot move a run into a quiet window, Quiet
+	// then spreads the postponed runs with it
+	return schedule.Quiet(schedule.Jitter(updates, c.Schedule.Jitter), windows...), nil
+}
+
+// newLimiter returns the rate limiter of the duckdns requests, nil when disabled
+func newLimiter() *duckdns.Limiter {
+	if c.RateLimit <= 0 {
+		return nil
+	}
+	return duckdns.NewLimiter(duckdns.Limit{Every: c.RateLimit, Burst: c.RateBurst})
+}
+
+// detectIP returns the current IPs of the device
+func detectIP() (string, string) {
+	c.IPv4, c.IPv6 = "", ""
+	c.DetectIP()
+	return c.IPv4, c.IPv6
+}
+
+func newDaemon() *daemon.Daemon {
+	d := daemon.New(dnsProvider)
+	d.Notifier = notifier
+	d.Verifier = verifier
+	d.IPv4, d.IPv6 = c.IPv4, c.IPv6
+	d.Interval = c.Interval
+	d.VerifyInterval = c.Verify.Interval
+	d.DryRun = c.DryRun
+	return d
+}
+
+// UpdateIPOnce publishes the IPs a single time.
+func UpdateIPOnce(r *Result) error {
+	result, err := newDaemon().Update(context.Background())
+	if err != nil {
+		return err
+	}
+	r.IPv4, r.IPv6 = result.IPv4, result.IPv6
+	if r.IPv4 == "" && r.IPv6 == "" {
+		r.IPv4, r.IPv6 = c.IPv4, c.IPv6
+	}
+	if !c.DryRun {
+		r.Changed = &result.Changed
+	}
+	return nil
+}
+
+// validateIPs returns a configuration error when an IP to publish is not an address of its family
+func validateIPs() error {
+	if ip := net.ParseIP(c.IPv4); c.IPv4 != "" && (ip == nil || ip.To4() == nil) {
+		return configErrorf("Invalid IPv4 address %q", c.IPv4)
+	}
+	if ip := net.ParseIP(c.IPv6); c.IPv6 != "" && (ip == nil || ip.To4() != nil) {
+		return configErrorf("Invalid IPv6 address %q", c.IPv6)
+	}
+	return nil
+}
+
+func ClearIP(r *Result) error {
+	if err := dnsProvider.ClearIP(context.Background()); err != nil {
+		return fmt.Errorf("Unable to clear the IP, %w", err)
+	}
+	if c.DryRun {
+		klog.Info("Dry run, the IP has not been cleared")
 	} else {
-		resp, err := client.UpdateIPWithValues(context.Background(), ipv4, ipv6)
-		if err != nil {
-			klog.Fatal("UpdateIPWithValues() returned error: ", err)
+		klog.Infof("IP has been cleared at %v", time.Now())
+	}
+	return nil
+}
+
+func UpdateRecord(r *Result, record string) error {
+	r.TXT = record
+	if c.Wait {
+		if err := needDuckDNS("-wait"); err != nil {
+			return err
 		}
-		body = SplitAndJoin(resp.Data)
 	}
+	if err := dnsProvider.SetTXT(context.Background(), record); err != nil {
+		return fmt.Errorf("Unable to update the TXT record, %w", err)
+	}
+	if c.DryRun {
+		klog.Infof("Dry run, the TXT Record has not been updated with %v nor waited for", record)
+		return nil
+	}
+	klog.Infof("TXT Record has been update with %v at %v", record, time.Now())
+
+	if c.Wait {
+		return WaitForRecord(record)
+	}
+	return nil
+}
+
+func WaitForRecord(record string) error {
+	resolvers, err := duckdns.NewResolvers(c.WaitResolvers, duckdns.ResolverOptions{Timeout: c.ResolverTimeout})
+	if err != nil {
+		return configErrorf("Could not configure the wait resolvers: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.WaitTimeout)
+	defer cancel()
+	if err := client.WaitForRecord(ctx, record, &duckdns.WaitOptions{Resolvers: resolvers}); err != nil {
+		return fmt.Errorf("Unable to see the TXT record, %w", err)
+	}
+	klog.Infof("TXT Record %v is visible at %v", record, time.Now())
+	return nil
+}
+
+func GetRecord(r *Result) error {
+	record, err := client.GetRecord(context.Background())
+	if err != nil {
+		return fmt.Errorf("Unable to get the TXT record, %w", err)
+	}
+	r.TXT = record
+	klog.Infof("TXT Record is %q", record)
+	return nil
+}
 
-	if strings.Contains(body, "KO") {
-		klog.Errorf("Got response containing KO, verify the provided arguments, will try again in %v", c.Interval)
+func ClearRecord(r *Result, record string) error {
+	r.TXT = record
+	if err := dnsProvider.ClearTXT(context.Background(), record); err != nil {
+		return fmt.Errorf("Unable to clear the TXT record, %w", err)
+	}
+	if c.DryRun {
+		klog.Info("Dry run, the TXT Record has not been cleared")
 	} else {
-		klog.Infof("Got response %v", body)
-		klog.Infof("IP has been updated at %v", time.Now())
+		klog.Infof("TXT Record has been cleared at %v", time.Now())
 	}
+	return nil
 }
 
-func ClearIP() {
-	resp, err := client.ClearIP(context.Background())
+// Status looks the published records of the domains up.
+func Status(r *Result) error {
+	resolver, err := duckdns.NewResolver(c.Resolver, duckdns.ResolverOptions{Timeout: c.ResolverTimeout})
 	if err != nil {
-		klog.Fatal("ClearIP() returned error: ", err)
+		return configErrorf("Could not configure the resolver: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, domain := range dnsProvider.Domains() {
+		record := &Record{Domain: duckdns.FQDN(domain)}
+		if record.A, err = resolver.LookupIP(ctx, "ip4", domain); err != nil {
+			return err
+		}
+		if record.AAAA, err = resolver.LookupIP(ctx, "ip6", domain); err != nil {
+			return err
+		}
+		txt, err := resolver.LookupTXT(ctx, domain)
+		if err != nil {
+			return err
+		}
+		record.TXT = strings.Join(txt, "")
+		r.Records = append(r.Records, record)
 	}
-	klog.Infof("Got response %v", resp.Data)
-	klog.Infof("IP has been cleared at %v", time.Now())
+	return nil
 }
 
-func UpdateRecord(record string) {
-	resp, err := client.UpdateRecord(context.Background(), record)
+// Detect sets the IPs of the device in the result.
+func Detect(r *Result) error {
+	c.DetectIP()
+	r.IPv4, r.IPv6 = c.IPv4, c.IPv6
+	return nil
+}
+
+func ObtainCertificate() {
+	solver := dns01.NewSolver(http.DefaultClient, c.Token)
+	solver.Limiter = newLimiter()
+	resolvers, err := duckdns.NewResolvers(c.WaitResolvers, duckdns.ResolverOptions{Timeout: c.ResolverTimeout})
 	if err != nil {
-		klog.Fatal("UpdateRecord() returned error: ", err)
+		klog.Fatal("Could not configure the wait resolvers: ", err)
+	}
+	solver.Resolvers = resolvers
+	solver.PropagationTimeout = c.WaitTimeout
+
+	manager := certificate.NewManager(http.DefaultClient, &certificate.Config{
+		DirectoryURL:  c.ACME.DirectoryURL,
+		Email:         c.ACME.Email,
+		Domains:       c.DomainNames,
+		Wildcard:      c.ACME.Wildcard,
+		Dir:           c.ACME.Dir,
+		RenewBefore:   c.ACME.RenewBefore,
+		ReloadCommand: c.ACME.ReloadCommand,
+	}, solver)
+	if err := manager.Renew(context.Background()); err != nil {
+		klog.Errorf("Could not renew the certificate, will try again in %v: %v", c.ACME.CheckInterval, err)
 	}
-	klog.Infof("Got response %v", resp.Data)
-	klog.Infof("TXT Record has been update with %v at %v", record, time.Now())
 }
 
-func GetRecord() {
-	record, err := client.GetRecord()
+func ServeCertManagerWebhook() {
+	if c.Webhook.GroupName == "" {
+		klog.Error("Provided group name empty... It needs to be provided with -group_name to serve the cert-manager webhook")
+		return
+	}
+	api, err := kube.InCluster()
 	if err != nil {
-		klog.Fatal("GetRecord() returned error: ", err)
+		klog.Fatal("Could not create the Kubernetes client: ", err)
 	}
-	klog.Infof("TXT Record is %q", record)
+
+	server := certmanager.NewServer(http.DefaultClient, c.Webhook.GroupName, api)
+	server.Limiter = newLimiter()
+	serve(server)
+}
+
+func RunController() {
+	api, err := kube.InCluster()
+	if err != nil {
+		klog.Fatal("Could not create the Kubernetes client: ", err)
+	}
+
+	ctrl := controller.New(http.DefaultClient, api, c.ControllerNamespace)
+	ctrl.ResyncInterval = c.ControllerResync
+	ctrl.Limiter = newLimiter()
+	if ctrl.ResyncInterval < 10*time.Minute {
+		ctrl.ResyncInterval = 10 * time.Minute
+	}
+	ctrl.Run(context.Background())
 }
 
-func ClearRecord(record string) {
-	resp, err := client.ClearRecord(context.Background(), record)
+func Serve() {
+	s, err := server.New(&server.Config{
+		Zone:       c.Server.Zone,
+		Token:      c.Token,
+		Domains:    c.DomainNames,
+		Nameserver: c.Server.Nameserver,
+		TTL:        c.Server.TTL,
+	}, &server.FileStore{Path: c.Server.Store})
 	if err != nil {
-		klog.Fatal("ClearRecord() returned error: ", err)
+		klog.Fatal("Could not start the DuckDNS service: ", err)
+	}
+	klog.Fatal(s.ListenAndServe(c.Server.Addr, c.Server.DNSAddr))
+}
+
+func serve(handler http.Handler) {
+	klog.Infof("Serving on %v", c.Webhook.Addr)
+	var err error
+	if c.Webhook.TLSCert != "" {
+		err = http.ListenAndServeTLS(c.Webhook.Addr, c.Webhook.TLSCert, c.Webhook.TLSKey, handler)
+	} else {
+		err = http.ListenAndServe(c.Webhook.Addr, handler)
 	}
-	klog.Infof("Got response %v", resp.Data)
-	klog.Infof("TXT Record has been cleared at %v", time.Now())
+	klog.Fatal(err)
 }
 
 func SplitAndJoin(data string) string {
@@ -0,0 +1,37 @@
+// Package metrics exposes the client counters with expvar on /debug/vars.
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+var (
+	// Updates counts the IP updates sent to duckdns
+	Updates = expvar.NewInt("duckdns_updates_total")
+	// UpdateFailures counts the IP updates that returned an error or KO
+	UpdateFailures = expvar.NewInt("duckdns_update_failures_total")
+	// Verifications counts the DNS verifications of the published records
+	Verifications = expvar.NewInt("duckdns_verifications_total")
+	// Drifts counts the published records not matching the intended IP, by domain
+	Drifts = expvar.NewMap("duckdns_drifts_total")
+	// BreakerState is the state of the circuit breaker of the updates: closed, open or half-open
+	BreakerState = expvar.NewString("duckdns_breaker_state")
+	// BreakerOpens counts the times the circuit breaker paused the updates
+	BreakerOpens = expvar.NewInt("duckdns_breaker_opens_total")
+)
+
+// Serve starts the metrics HTTP server in the background.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	go func() {
+		klog.Infof("Serving metrics on %v/debug/vars", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			klog.Errorf("Metrics server stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+)
+
+// Format of the JSON payload sent to a chat webhook
+type Format string
+
+const (
+	//FormatSlack sends {"text": ...}
+	FormatSlack Format = "slack"
+	//FormatDiscord sends {"content": ...}
+	FormatDiscord Format = "discord"
+	//FormatMatrix sends {"text": ..., "username": ...} as expected by matrix-hookshot style webhooks
+	FormatMatrix Format = "matrix"
+)
+
+// Webhook structure for Slack, Discord and Matrix compatible incoming webhooks
+type Webhook struct {
+	httpClient *http.Client
+	URL        string
+	Format     Format
+}
+
+// Name function returning the notifier name
+func (w *Webhook) Name() string {
+	return string(w.Format)
+}
+
+// Notify function to post the message to the incoming webhook
+func (w *Webhook) Notify(ctx context.Context, title, text string) error {
+	var payload interface{}
+	switch w.Format {
+	case FormatDiscord:
+		payload = map[string]string{"content": text}
+	case FormatMatrix:
+		payload = map[string]string{"text": text, "username": title}
+	default:
+		payload = map[string]string{"text": text}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.httpClient, w.URL, "application/json", bytes.NewReader(body), nil)
+}
+
+// Ntfy structure for ntfy topics
+type Ntfy struct {
+	httpClient *http.Client
+	URL        string
+	Token      string
+}
+
+// Name function returning the notifier name
+func (n *Ntfy) Name() string {
+	return "ntfy"
+}
+
+// Notify function to publish the message to the ntfy topic
+func (n *Ntfy) Notify(ctx context.Context, title, text string) error {
+	header := http.Header{}
+	header.Set("Title", title)
+	if n.Token != "" {
+		header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return post(ctx, n.httpClient, n.URL, "text/plain; charset=utf-8", strings.NewReader(text), header)
+}
+
+// Gotify structure for Gotify servers
+type Gotify struct {
+	httpClient *http.Client
+	URL        string
+	Token      string
+}
+
+// Name function returning the notifier name
+func (g *Gotify) Name() string {
+	return "gotify"
+}
+
+// Notify function to push the message to the Gotify /message endpoint
+func (g *Gotify) Notify(ctx context.Context, title, text string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"title":    title,
+		"message":  text,
+		"priority": 5,
+	})
+	if err != nil {
+		return err
+	}
+
+	u := strings.TrimSuffix(g.URL, "/") + "/message?" + url.Values{"token": {g.Token}}.Encode()
+	return post(ctx, g.httpClient, u, "application/json", bytes.NewReader(body), nil)
+}
+
+// SMTP structure for email notifications
+type SMTP struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Name function returning the notifier name
+func (s *SMTP) Name() string {
+	return "smtp"
+}
+
+// Notify function to send the message by email
+func (s *SMTP) Notify(ctx context.Context, title, text string) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", title)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n", text)
+
+	return smtp.SendMail(s.Addr, auth, s.From, s.To, msg.Bytes())
+}
+
+func post(ctx context.Context, httpClient *http.Client, url, contentType string, body io.Reader, header http.Header) error {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
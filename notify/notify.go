@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Event type of a notification
+type Event string
+
+const (
+	//EventChange is sent when the published IP changed
+	EventChange Event = "change"
+	//EventFailure is sent when the update failed FailureThreshold times in a row
+	EventFailure Event = "failure"
+	//EventRecovery is sent when an update succeeds after a failure notification
+	EventRecovery Event = "recovery"
+
+	defaultChangeTemplate   = "{{.Domains}}: IP changed to {{.IPv4}}{{if .IPv6}} / {{.IPv6}}{{end}}"
+	defaultFailureTemplate  = "{{.Domains}}: update failed {{.Failures}} times in a row: {{.Error}}"
+	defaultRecoveryTemplate = "{{.Domains}}: update recovered after {{.Failures}} failures"
+
+	defaultFailureThreshold = 3
+	defaultMinInterval      = 30 * time.Minute
+)
+
+// Message structure containing the values available to the templates
+type Message struct {
+	Event    Event
+	Domains  string
+	IPv4     string
+	IPv6     string
+	Error    string
+	Failures int
+	Time     time.Time
+}
+
+// Notifier interface implemented by every notification backend
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, title, text string) error
+}
+
+// Config structure containing the notifications configuration
+type Config struct {
+	SlackURL    string
+	DiscordURL  string
+	MatrixURL   string
+	NtfyURL     string
+	NtfyToken   string
+	GotifyURL   string
+	GotifyToken string
+
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTo       []string
+
+	ChangeTemplate   string
+	FailureTemplate  string
+	RecoveryTemplate string
+
+	FailureThreshold int
+	MinInterval      time.Duration
+}
+
+// Dispatcher structure sending rate limited messages to all the configured notifiers
+type Dispatcher struct {
+	Notifiers        []Notifier
+	FailureThreshold int
+	MinInterval      time.Duration
+
+	templates map[Event]*template.Template
+	now       func() time.Time
+
+	mu       sync.Mutex
+	lastSent map[Event]time.Time
+}
+
+// New function to return a dispatcher for the notifiers enabled in the configuration
+func New(config *Config, httpClient *http.Client) (*Dispatcher, error) {
+	d := &Dispatcher{
+		FailureThreshold: config.FailureThreshold,
+		MinInterval:      config.MinInterval,
+		templates:        make(map[Event]*template.Template),
+		now:              time.Now,
+		lastSent:         make(map[Event]time.Time),
+	}
+	if d.FailureThreshold <= 0 {
+		d.FailureThreshold = defaultFailureThreshold
+	}
+	if d.MinInterval < 0 {
+		d.MinInterval = defaultMinInterval
+	}
+
+	templates := map[Event]string{
+		EventChange:   valueOr(config.ChangeTemplate, defaultChangeTemplate),
+		EventFailure:  valueOr(config.FailureTemplate, defaultFailureTemplate),
+		EventRecovery: valueOr(config.RecoveryTemplate, defaultRecoveryTemplate),
+	}
+	for event, text := range templates {
+		tmpl, err := template.New(string(event)).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse %v template, %v", event, err)
+		}
+		d.templates[event] = tmpl
+	}
+
+	if config.SlackURL != "" {
+		d.Notifiers = append(d.Notifiers, &Webhook{httpClient: httpClient, URL: config.SlackURL, Format: FormatSlack})
+	}
+	if config.DiscordURL != "" {
+		d.Notifiers = append(d.Notifiers, &Webhook{httpClient: httpClient, URL: config.DiscordURL, Format: FormatDiscord})
+	}
+	if config.MatrixURL != "" {
+		d.Notifiers = append(d.Notifiers, &Webhook{httpClient: httpClient, URL: config.MatrixURL, Format: FormatMatrix})
+	}
+	if config.NtfyURL != "" {
+		d.Notifiers = append(d.Notifiers, &Ntfy{httpClient: httpClient, URL: config.NtfyURL, Token: config.NtfyToken})
+	}
+	if config.GotifyURL != "" {
+		d.Notifiers = append(d.Notifiers, &Gotify{httpClient: httpClient, URL: config.GotifyURL, Token: config.GotifyToken})
+	}
+	if config.SMTPAddr != "" {
+		if config.SMTPFrom == "" || len(config.SMTPTo) == 0 {
+			return nil, fmt.Errorf("SMTP notifications need a sender and at least one recipient")
+		}
+		d.Notifiers = append(d.Notifiers, &SMTP{
+			Addr:     config.SMTPAddr,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.SMTPFrom,
+			To:       config.SMTPTo,
+		})
+	}
+
+	return d, nil
+}
+
+// Enabled function to check if at least one notifier is configured
+func (d *Dispatcher) Enabled() bool {
+	return d != nil && len(d.Notifiers) > 0
+}
+
+// Send function to render the message and send it to every notifier, unless the same
+// event was already sent less than MinInterval ago
+func (d *Dispatcher) Send(ctx context.Context, msg *Message) error {
+	if !d.Enabled() {
+		return nil
+	}
+	if msg.Time.IsZero() {
+		msg.Time = d.now()
+	}
+
+	d.mu.Lock()
+	if last, ok := d.lastSent[msg.Event]; ok && msg.Time.Sub(last) < d.MinInterval {
+		d.mu.Unlock()
+		klog.Infof("Skipping %v notification, last one was sent at %v", msg.Event, last)
+		return nil
+	}
+	d.lastSent[msg.Event] = msg.Time
+	d.mu.Unlock()
+
+	tmpl, ok := d.templates[msg.Event]
+	if !ok {
+		return fmt.Errorf("Unknown notification event %q", msg.Event)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, msg); err != nil {
+		return fmt.Errorf("Unable to render %v template, %v", msg.Event, err)
+	}
+
+	title := fmt.Sprintf("duckdns-go: %v", msg.Event)
+	var errs []string
+	for _, n := range d.Notifiers {
+		if err := n.Notify(ctx, title, buf.String()); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", n.Name(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Unable to send %v notification, %v", msg.Event, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func valueOr(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,206 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookFormats(t *testing.T) {
+	bodies := make(chan map[string]string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type expected to be application/json, got %v", got)
+		}
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	for format, key := range map[Format]string{FormatSlack: "text", FormatDiscord: "content", FormatMatrix: "text"} {
+		w := &Webhook{httpClient: server.Client(), URL: server.URL, Format: format}
+		if err := w.Notify(context.Background(), "title", "hello"); err != nil {
+			t.Fatalf("Notify() returned error: %v", err)
+		}
+		if got := (<-bodies)[key]; got != "hello" {
+			t.Errorf("%v payload %v expected to be hello, got %v", format, key, got)
+		}
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "hello" {
+			t.Errorf("ntfy body expected to be hello, got %q", body)
+		}
+		if got := r.Header.Get("Title"); got != "title" {
+			t.Errorf("ntfy Title header expected to be title, got %q", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer tk" {
+			t.Errorf("ntfy Authorization header expected to be Bearer tk, got %q", got)
+		}
+	}))
+	defer server.Close()
+
+	n := &Ntfy{httpClient: server.Client(), URL: server.URL + "/topic", Token: "tk"}
+	if err := n.Notify(context.Background(), "title", "hello"); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+}
+
+func TestGotify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/message" || r.URL.Query().Get("token") != "app-token" {
+			t.Errorf("Unexpected gotify request %v", r.URL)
+		}
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["message"] != "hello" || body["title"] != "title" {
+			t.Errorf("Unexpected gotify payload %v", body)
+		}
+	}))
+	defer server.Close()
+
+	g := &Gotify{httpClient: server.Client(), URL: server.URL + "/", Token: "app-token"}
+	if err := g.Notify(context.Background(), "title", "hello"); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	w := &Webhook{httpClient: server.Client(), URL: server.URL, Format: FormatSlack}
+	if err := w.Notify(context.Background(), "title", "hello"); err == nil {
+		t.Errorf("Notify() expected to return an error on 500")
+	}
+}
+
+// fakeSMTP accepts a single mail and sends its DATA section to the returned channel
+func fakeSMTP(t *testing.T) (string, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	data := make(chan string, 1)
+
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		fmt.Fprintf(conn, "220 localhost ESMTP\r\n")
+		var mail strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					data <- mail.String()
+					fmt.Fprintf(conn, "250 OK\r\n")
+					continue
+				}
+				mail.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				fmt.Fprintf(conn, "250 localhost\r\n")
+			case cmd == "DATA":
+				inData = true
+				fmt.Fprintf(conn, "354 go ahead\r\n")
+			case cmd == "QUIT":
+				fmt.Fprintf(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprintf(conn, "250 OK\r\n")
+			}
+		}
+	}()
+
+	return l.Addr().String(), data
+}
+
+func TestSMTP(t *testing.T) {
+	addr, data := fakeSMTP(t)
+
+	s := &SMTP{Addr: addr, From: "duckdns@example.com", To: []string{"ops@example.com"}}
+	if err := s.Notify(context.Background(), "title", "hello"); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	mail := <-data
+	if !strings.Contains(mail, "Subject: title\r\n") || !strings.Contains(mail, "\r\n\r\nhello\r\n") {
+		t.Errorf("Unexpected mail %q", mail)
+	}
+}
+
+type recorder struct {
+	texts []string
+}
+
+func (r *recorder) Name() string {
+	return "recorder"
+}
+
+func (r *recorder) Notify(ctx context.Context, title, text string) error {
+	r.texts = append(r.texts, text)
+	return nil
+}
+
+func TestDispatcherTemplatesAndRateLimit(t *testing.T) {
+	d, err := New(&Config{
+		ChangeTemplate: "{{.Domains}} -> {{.IPv4}}",
+		MinInterval:    10 * time.Minute,
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	rec := &recorder{}
+	d.Notifiers = []Notifier{rec}
+	now := time.Date(2021, 1, 13, 11, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	d.Send(context.Background(), &Message{Event: EventChange, Domains: "example", IPv4: "1.2.3.4"})
+	now = now.Add(time.Minute)
+	d.Send(context.Background(), &Message{Event: EventChange, Domains: "example", IPv4: "1.2.3.5"})
+	d.Send(context.Background(), &Message{Event: EventFailure, Domains: "example", Failures: 3, Error: "KO"})
+	now = now.Add(10 * time.Minute)
+	d.Send(context.Background(), &Message{Event: EventChange, Domains: "example", IPv4: "1.2.3.6"})
+
+	want := []string{
+		"example -> 1.2.3.4",
+		"example: update failed 3 times in a row: KO",
+		"example -> 1.2.3.6",
+	}
+	if strings.Join(rec.texts, "|") != strings.Join(want, "|") {
+		t.Errorf("Dispatcher sent %q, want %q", rec.texts, want)
+	}
+}
+
+func TestNewInvalidTemplate(t *testing.T) {
+	if _, err := New(&Config{FailureTemplate: "{{.Nope"}, http.DefaultClient); err == nil {
+		t.Errorf("New() expected to return an error for an invalid template")
+	}
+}
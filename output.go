@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ebrianne/duckdns-go/cli"
+	"github.com/ebrianne/duckdns-go/provider"
+	"github.com/ebrianne/duckdns-go/redact"
+)
+
+const outputJSON = "json"
+
+// stdout receives the results of the one-shot commands
+var stdout io.Writer = os.Stdout
+
+// Exit codes of the commands
+const (
+	exitOK = 0
+	// exitRejected is returned when the service answered KO or refused the credentials
+	exitRejected = 1
+	// exitConfig is returned for a wrong command line or configuration, nothing was sent
+	exitConfig = 2
+	// exitNetwork is returned when the service or the resolvers could not be reached, or
+	// failed temporarily
+	exitNetwork = 3
+)
+
+// Result is the outcome of a one-shot command, printed as a single object with -output json.
+type Result struct {
+	Action   string    `json:"action"`
+	Provider string    `json:"provider,omitempty"`
+	Domains  []string  `json:"domains,omitempty"`
+	IPv4     string    `json:"ipv4,omitempty"`
+	IPv6     string    `json:"ipv6,omitempty"`
+	TXT      string    `json:"txt,omitempty"`
+	Changed  *bool     `json:"changed,omitempty"`
+	Records  []*Record `json:"records,omitempty"`
+	Version  string    `json:"version,omitempty"`
+	// DryRun tells that the requests were not sent, Requests lists them with the token masked
+	DryRun   bool     `json:"dry_run,omitempty"`
+	Requests []string `json:"requests,omitempty"`
+	// Status is OK, the code answered by the service or ERROR when it could not be reached
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	ExitCode   int       `json:"exit_code"`
+	Started    time.Time `json:"started"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Record is the published records of a domain, as shown by status
+type Record struct {
+	Domain string   `json:"domain"`
+	A      []string `json:"a"`
+	AAAA   []string `json:"aaaa"`
+	TXT    string   `json:"txt"`
+}
+
+// configError is an error of the configuration, found before any request
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string {
+	return e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+func configErrorf(format string, a ...interface{}) error {
+	return &configError{err: fmt.Errorf(format, a...)}
+}
+
+// reportedError is an error already printed in the JSON result
+type reportedError struct {
+	err error
+}
+
+func (e *reportedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reportedError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the exit code of the error of a command
+func exitCode(err error) int {
+	var usage *cli.UsageError
+	var config *configError
+	var rejected *provider.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage), errors.As(err, &config), errors.Is(err, provider.ErrUnsupported):
+		return exitConfig
+	case errors.As(err, &rejected) && !rejected.Temporary:
+		return exitRejected
+	}
+	return exitNetwork
+}
+
+// status returns the status of the result of err
+func status(err error) string {
+	var rejected *provider.Error
+	switch {
+	case err == nil:
+		return "OK"
+	case errors.As(err, &rejected):
+		return rejected.Code
+	}
+	return "ERROR"
+}
+
+// oneShot returns the Run of a command filling a result with run, the result is printed
+// once run returned
+func oneShot(action string, run func(r *Result, args []string) error) func([]string) error {
+	return func(args []string) error {
+		r := &Result{Action: action, Started: time.Now()}
+		return report(stdout, r, run(r, args))
+	}
+}
+
+// report completes r with err and prints it, the error is returned for the exit code
+func report(w io.Writer, r *Result, err error) error {
+	r.DurationMS = time.Since(r.Started).Milliseconds()
+	if dnsProvider != nil {
+		r.Provider, r.Domains = dnsProvider.Name(), dnsProvider.Domains()
+	}
+	if client != nil && client.DryRun != nil {
+		r.DryRun, r.Requests = true, client.DryRun.Requests()
+	}
+	r.Status = status(err)
+	r.ExitCode = exitCode(err)
+	if err != nil {
+		r.Error = redact.String(err.Error())
+	}
+
+	if c.Output != outputJSON {
+		if err == nil {
+			r.print(w)
+		}
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		return err
+	}
+	if err != nil {
+		return &reportedError{err: err}
+	}
+	return nil
+}
+
+// reportUsage prints err, the usage error of the command line args, on stderr and as the
+// JSON result when -output json was given, the flags may not all have been parsed
+func reportUsage(w io.Writer, args []string, err error) {
+	fmt.Fprintln(os.Stderr, err)
+	if !jsonRequested(args) {
+		return
+	}
+	r := &Result{Started: time.Now(), Status: status(err), ExitCode: exitCode(err), Error: redact.String(err.Error())}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		r.Action = strings.TrimSpace(r.Action + " " + arg)
+	}
+	json.NewEncoder(w).Encode(r)
+}
+
+// jsonRequested returns whether the environment or the command line args ask for the JSON
+// output
+func jsonRequested(args []string) bool {
+	if c != nil && c.Output == outputJSON {
+		return true
+	}
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name == arg {
+			continue
+		}
+		if name == "output="+outputJSON || name == "output" && i+1 < len(args) && args[i+1] == outputJSON {
+			return true
+		}
+	}
+	return false
+}
+
+// print writes the result of the commands printing a value, the others log their outcome
+func (r *Result) print(w io.Writer) {
+	for _, url := range r.Requests {
+		fmt.Fprintf(w, "Dry run: GET %v\n", url)
+	}
+	switch r.Action {
+	case "update":
+		fields := []string{strings.Join(r.Domains, ",")}
+		for _, ip := range []string{r.IPv4, r.IPv6} {
+			if ip != "" {
+				fields = append(fields, ip)
+			}
+		}
+		if r.Changed != nil && *r.Changed {
+			fields = append(fields, "updated")
+		} else if r.Changed != nil {
+			fields = append(fields, "unchanged")
+		}
+		fmt.Fprintln(w, strings.Join(fields, " "))
+	case "txt set", "txt clear":
+		if r.DryRun {
+			fmt.Fprintf(w, "TXT: %q\n", r.TXT)
+		}
+	case "status":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "DOMAIN\tA\tAAAA\tTXT")
+		for _, record := range r.Records {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%q\n", record.Domain, strings.Join(record.A, ","), strings.Join(record.AAAA, ","), record.TXT)
+		}
+		tw.Flush()
+	case "detect":
+		fmt.Fprintf(w, "IPv4: %v\nIPv6: %v\n", r.IPv4, r.IPv6)
+	case "version":
+		fmt.Fprintln(w, r.Version)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ebrianne/duckdns-go/cli"
+	"github.com/ebrianne/duckdns-go/config"
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, exitOK},
+		{&provider.Error{Provider: "duckdns", Code: "KO"}, exitRejected},
+		{fmt.Errorf("Unable to clear the IP, %w", &provider.Error{Provider: "dyndns2", Code: "badauth"}), exitRejected},
+		{&provider.Error{Provider: "dyndns2", Code: "911", Temporary: true}, exitNetwork},
+		{cli.Usagef("No command given"), exitConfig},
+		{configErrorf("Unknown provider %q", "bogus"), exitConfig},
+		{fmt.Errorf("Unable to clear the IP, %w", provider.ErrUnsupported), exitConfig},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, exitNetwork},
+		{&reportedError{err: &provider.Error{Provider: "duckdns", Code: "KO"}}, exitRejected},
+	}
+	for _, test := range tests {
+		if got := exitCode(test.err); got != test.code {
+			t.Errorf("exitCode(%v) expected %v, got %v", test.err, test.code, got)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	c = &config.ClientConfig{Output: outputJSON}
+	defer func() { c = nil }()
+
+	var out bytes.Buffer
+	r := &Result{Action: "txt set", TXT: "value", Started: time.Now()}
+	err := report(&out, r, &provider.Error{Provider: "duckdns", Code: "KO", Message: "verify the token and the domains"})
+	if !errors.As(err, new(*reportedError)) || exitCode(err) != exitRejected {
+		t.Errorf("report() expected to return the reported KO, got %v", err)
+	}
+
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("report() expected a single JSON object, got %q: %v", out.String(), err)
+	}
+	for k, v := range map[string]interface{}{"action": "txt set", "txt": "value", "status": "KO", "exit_code": 1.0,
+		"error": "duckdns answered KO: verify the token and the domains"} {
+		if got[k] != v {
+			t.Errorf("%v expected %v, got %v", k, v, got[k])
+		}
+	}
+	if _, ok := got["duration_ms"]; !ok {
+		t.Errorf("duration_ms expected in %v", got)
+	}
+}
+
+func TestReportUsage(t *testing.T) {
+	defer func() { c = nil }()
+	for _, args := range [][]string{
+		{"txt", "set", "-unknown", "-output", "json"},
+		{"txt", "set", "-wait_timeout", "soon", "--output=json"},
+	} {
+		err := newApp("duckdns-go").Run(args)
+		var out bytes.Buffer
+		reportUsage(&out, args, err)
+
+		got := map[string]interface{}{}
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("%v expected a JSON result, got %q: %v", args, out.String(), err)
+		}
+		if got["action"] != "txt set" || got["status"] != "ERROR" || got["exit_code"] != 2.0 || got["error"] == nil {
+			t.Errorf("%v expected the usage error result, got %v", args, got)
+		}
+	}
+
+	c = nil
+	var out bytes.Buffer
+	reportUsage(&out, []string{"update", "-unknown"}, cli.Usagef("flag provided but not defined: -unknown"))
+	if out.Len() != 0 {
+		t.Errorf("No JSON result expected without -output json, got %q", out.String())
+	}
+}
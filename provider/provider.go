@@ -0,0 +1,80 @@
+// Package provider defines the interface implemented by the dynamic DNS services.
+//
+// A provider publishes the IPs and the TXT record of its configured domains. The daemon
+// only relies on this interface, so every provider shares the IP detection, the scheduling,
+// the verification and the notifications.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupported is returned by the operations a provider does not have.
+var ErrUnsupported = errors.New("operation not supported by the provider")
+
+// Capabilities of a provider
+type Capabilities struct {
+	// IPv4 and IPv6 tell which address families can be published
+	IPv4 bool
+	IPv6 bool
+	// TXT tells whether SetTXT and ClearTXT are supported
+	TXT bool
+	// Clear tells whether ClearIP is supported
+	Clear bool
+	// DetectIP tells whether the service publishes the address of the caller when no IP is given
+	DetectIP bool
+}
+
+// Result of an IP update
+type Result struct {
+	// IPv4 and IPv6 are the published addresses, when the service reports them
+	IPv4 string
+	IPv6 string
+	// Changed tells whether the published addresses changed
+	Changed bool
+}
+
+// Error is returned when the service answered but rejected the request.
+type Error struct {
+	Provider string
+	// Code is the answer of the service, for instance KO or badauth
+	Code string
+	// Message describes the code
+	Message string
+	// Temporary tells whether the same request may succeed later, the other errors need a
+	// configuration change
+	Temporary bool
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s answered %s", e.Provider, e.Code)
+	}
+	return fmt.Sprintf("%s answered %s: %s", e.Provider, e.Code, e.Message)
+}
+
+// IsTemporary tells whether err may not happen again with the same request. Errors that were
+// not returned by the service, network errors for instance, are temporary.
+func IsTemporary(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Temporary
+	}
+	return err != nil
+}
+
+// Provider of dynamic DNS records
+type Provider interface {
+	// Name of the service
+	Name() string
+	// Domains returns the fully qualified names updated by the provider
+	Domains() []string
+	Capabilities() Capabilities
+	// UpdateIP publishes the addresses, empty ones are detected by the service when it can
+	UpdateIP(ctx context.Context, ipv4, ipv6 string) (*Result, error)
+	ClearIP(ctx context.Context) error
+	SetTXT(ctx context.Context, value string) error
+	ClearTXT(ctx context.Context, value string) error
+}
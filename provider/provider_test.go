@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	err := &Error{Provider: "duckdns", Code: "KO"}
+	if want, got := "duckdns answered KO", err.Error(); want != got {
+		t.Errorf("Error() expected %v, got %v", want, got)
+	}
+	err = &Error{Provider: "dyndns2", Code: "badauth", Message: "bad credentials"}
+	if want, got := "dyndns2 answered badauth: bad credentials", err.Error(); want != got {
+		t.Errorf("Error() expected %v, got %v", want, got)
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("connection refused"), true},
+		{&Error{Code: "911", Temporary: true}, true},
+		{fmt.Errorf("Unable to update, %w", &Error{Code: "badauth"}), false},
+	}
+	for _, test := range tests {
+		if got := IsTemporary(test.err); got != test.want {
+			t.Errorf("IsTemporary(%v) expected %v, got %v", test.err, test.want, got)
+		}
+	}
+}
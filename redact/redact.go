@@ -0,0 +1,81 @@
+// Package redact scrubs the secrets, such as the DuckDNS token, from the errors and the logs.
+//
+// The secrets are registered once the configuration is loaded. Filter is set as the filter
+// of klog, so every log line is scrubbed, and String scrubs what is printed elsewhere.
+package redact
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Mask replaces the secrets.
+const Mask = "*********"
+
+var (
+	mu      sync.RWMutex
+	secrets []string
+)
+
+// Add registers secrets to scrub, in clear and query escaped. The empty and the already
+// registered values are ignored.
+func Add(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, value := range values {
+		if value == "" || registered(value) {
+			continue
+		}
+		secrets = append(secrets, value)
+		if escaped := url.QueryEscape(value); escaped != value {
+			secrets = append(secrets, escaped)
+		}
+	}
+}
+
+func registered(value string) bool {
+	for _, secret := range secrets {
+		if secret == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset forgets the registered secrets.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	secrets = nil
+}
+
+// String returns s with the secrets masked.
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, Mask, -1)
+	}
+	return s
+}
+
+// Filter is a klog.LogFilter scrubbing the secrets from the log lines.
+type Filter struct{}
+
+func (Filter) Filter(args []interface{}) []interface{} {
+	return []interface{}{String(fmt.Sprint(args...))}
+}
+
+func (Filter) FilterF(format string, args []interface{}) (string, []interface{}) {
+	return "%s", []interface{}{String(fmt.Sprintf(format, args...))}
+}
+
+func (Filter) FilterS(msg string, keysAndValues []interface{}) (string, []interface{}) {
+	values := make([]interface{}, len(keysAndValues))
+	for i, v := range keysAndValues {
+		values[i] = String(fmt.Sprint(v))
+	}
+	return String(msg), values
+}
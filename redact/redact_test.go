@@ -0,0 +1,59 @@
+package redact
+
+import (
+	"bytes"
+	"flag"
+	"net/url"
+	"strings"
+	"testing"
+
+	"k8s.io/klog/v2"
+)
+
+const token = "a1b2c3d4-e5f6+secret"
+
+func TestString(t *testing.T) {
+	Add(token, "")
+	Add(token)
+	defer Reset()
+
+	if len(secrets) != 2 {
+		t.Errorf("Expected the token registered once in clear and escaped, got %v", secrets)
+	}
+
+	for _, s := range []string{
+		"/update?domains=example&token=" + token,
+		"/update?domains=example&token=" + url.QueryEscape(token),
+		"Token : " + token + " and " + token,
+	} {
+		if got := String(s); strings.Contains(got, "secret") || !strings.Contains(got, Mask) {
+			t.Errorf("String(%q) expected the token masked, got %q", s, got)
+		}
+	}
+	if got := String("nothing to hide"); got != "nothing to hide" {
+		t.Errorf("String() expected to keep the other values, got %q", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	Add(token)
+	defer Reset()
+
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	fs.Set("logtostderr", "false")
+	defer fs.Set("logtostderr", "true")
+	var out bytes.Buffer
+	klog.SetOutput(&out)
+	klog.SetLogFilter(Filter{})
+	defer klog.SetLogFilter(nil)
+
+	klog.Info("Token ", token)
+	klog.Errorf("Get %q: %v", "https://www.duckdns.org/update?token="+url.QueryEscape(token), "EOF")
+	klog.InfoS("Sending request", "token", token)
+	klog.Flush()
+
+	if strings.Contains(out.String(), "secret") || !strings.Contains(out.String(), "token="+Mask) {
+		t.Errorf("Expected the token masked in the logs, got %q", out.String())
+	}
+}
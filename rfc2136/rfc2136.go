@@ -0,0 +1,267 @@
+// Package rfc2136 publishes the records with RFC 2136 dynamic DNS UPDATE messages.
+//
+// The updates replace the A, AAAA and TXT RRsets of the configured names in the zone of the
+// primary server and are signed with TSIG when a key is set. After each update, the server
+// is queried to check that it serves the new records.
+package rfc2136
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+const (
+	defaultTTL       = time.Minute
+	defaultAlgorithm = dns.HmacSHA256
+	tsigFudge        = 300
+)
+
+// Config contains the provider configuration.
+type Config struct {
+	// Server is the host:port of the primary server, the port defaults to 53
+	Server string
+	// Network is udp (default) or tcp
+	Network string
+	Zone    string
+	// Names are the records to update, relative to the zone or fully qualified
+	Names []string
+	TTL   time.Duration
+	// TSIGKey is the name of the key, no TSIG is sent when empty
+	TSIGKey string
+	// TSIGSecret is the base64 secret of the key
+	TSIGSecret string
+	// TSIGAlgorithm defaults to hmac-sha256
+	TSIGAlgorithm string
+	Timeout       time.Duration
+}
+
+// Provider updates the records of the names on the server.
+type Provider struct {
+	Config *Config
+	// Resolver queries the server to verify the updates
+	Resolver duckdns.Resolver
+
+	server    string
+	zone      string
+	names     []string
+	algorithm string
+	client    *dns.Client
+}
+
+// NewProvider returns a provider for the configuration.
+func NewProvider(config *Config) (*Provider, error) {
+	if config.Server == "" || config.Zone == "" || len(config.Names) == 0 {
+		return nil, errors.New("RFC 2136 provider needs a server, a zone and names")
+	}
+
+	p := &Provider{
+		Config:    config,
+		server:    config.Server,
+		zone:      dns.Fqdn(strings.ToLower(config.Zone)),
+		algorithm: config.TSIGAlgorithm,
+		client:    &dns.Client{Net: config.Network, Timeout: config.Timeout},
+	}
+	if _, _, err := net.SplitHostPort(p.server); err != nil {
+		p.server = net.JoinHostPort(p.server, "53")
+	}
+	for _, name := range config.Names {
+		name = dns.Fqdn(strings.ToLower(name))
+		if !dns.IsSubDomain(p.zone, name) {
+			name = name + p.zone
+		}
+		p.names = append(p.names, name)
+	}
+
+	if config.TSIGKey != "" {
+		if _, err := base64.StdEncoding.DecodeString(config.TSIGSecret); err != nil {
+			return nil, fmt.Errorf("Unable to decode the TSIG secret, %v", err)
+		}
+		if p.algorithm == "" {
+			p.algorithm = defaultAlgorithm
+		}
+		p.algorithm = dns.Fqdn(p.algorithm)
+		p.client.TsigSecret = map[string]string{dns.Fqdn(config.TSIGKey): config.TSIGSecret}
+	}
+
+	p.Resolver = &duckdns.DNSResolver{Servers: []string{p.server}, Network: config.Network, Timeout: config.Timeout}
+	return p, nil
+}
+
+// Name returns the name of the protocol.
+func (p *Provider) Name() string {
+	return "rfc2136"
+}
+
+// Domains returns the fully qualified names.
+func (p *Provider) Domains() []string {
+	domains := make([]string, 0, len(p.names))
+	for _, name := range p.names {
+		domains = append(domains, strings.TrimSuffix(name, "."))
+	}
+	return domains
+}
+
+// Capabilities of the provider, the server cannot tell the public IP of the daemon.
+func (p *Provider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{IPv4: true, IPv6: true, TXT: true, Clear: true}
+}
+
+// UpdateIP replaces the A RRsets when ipv4 is set and the AAAA RRsets when ipv6 is set.
+func (p *Provider) UpdateIP(ctx context.Context, ipv4, ipv6 string) (*provider.Result, error) {
+	if ipv4 == "" && ipv6 == "" {
+		return nil, errors.New("RFC 2136 updates need an IP address")
+	}
+
+	result := &provider.Result{IPv4: ipv4, IPv6: ipv6}
+	var rrs []dns.RR
+	for _, record := range []struct {
+		network string
+		value   string
+	}{{"ip4", ipv4}, {"ip6", ipv6}} {
+		if record.value == "" {
+			continue
+		}
+		ip := net.ParseIP(record.value)
+		if ip == nil {
+			return nil, fmt.Errorf("Invalid IP address %q", record.value)
+		}
+		changed, err := p.differs(ctx, record.network, record.value)
+		if err != nil {
+			return nil, err
+		}
+		result.Changed = result.Changed || changed
+
+		for _, name := range p.names {
+			if record.network == "ip4" {
+				rrs = append(rrs, &dns.A{Hdr: p.header(name, dns.TypeA), A: ip.To4()})
+			} else {
+				rrs = append(rrs, &dns.AAAA{Hdr: p.header(name, dns.TypeAAAA), AAAA: ip})
+			}
+		}
+	}
+
+	if err := p.update(ctx, rrs, rrs, nil); err != nil {
+		return nil, err
+	}
+	for _, record := range []struct {
+		network string
+		value   string
+	}{{"ip4", ipv4}, {"ip6", ipv6}} {
+		if record.value == "" {
+			continue
+		}
+		if changed, err := p.differs(ctx, record.network, record.value); err != nil || changed {
+			return nil, p.verifyError(record.value, err)
+		}
+	}
+	return result, nil
+}
+
+// ClearIP removes the A and AAAA RRsets.
+func (p *Provider) ClearIP(ctx context.Context) error {
+	var rrsets []dns.RR
+	for _, name := range p.names {
+		rrsets = append(rrsets, &dns.A{Hdr: p.header(name, dns.TypeA)}, &dns.AAAA{Hdr: p.header(name, dns.TypeAAAA)})
+	}
+	return p.update(ctx, rrsets, nil, nil)
+}
+
+// SetTXT replaces the TXT RRsets with value.
+func (p *Provider) SetTXT(ctx context.Context, value string) error {
+	var rrs []dns.RR
+	for _, name := range p.names {
+		rrs = append(rrs, &dns.TXT{Hdr: p.header(name, dns.TypeTXT), Txt: []string{value}})
+	}
+	if err := p.update(ctx, rrs, rrs, nil); err != nil {
+		return err
+	}
+
+	for _, name := range p.names {
+		txt, err := p.Resolver.LookupTXT(ctx, name)
+		if err != nil || len(txt) != 1 || txt[0] != value {
+			return fmt.Errorf("Unable to verify the TXT record of %v, the server answers %q %v", name, txt, err)
+		}
+	}
+	return nil
+}
+
+// ClearTXT removes the TXT record of value, other TXT values are kept.
+func (p *Provider) ClearTXT(ctx context.Context, value string) error {
+	var rrs []dns.RR
+	for _, name := range p.names {
+		rrs = append(rrs, &dns.TXT{Hdr: p.header(name, dns.TypeTXT), Txt: []string{value}})
+	}
+	return p.update(ctx, nil, nil, rrs)
+}
+
+func (p *Provider) header(name string, rrtype uint16) dns.RR_Header {
+	ttl := p.Config.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: uint32(ttl / time.Second)}
+}
+
+// update sends a single UPDATE message removing the RRsets of rrsets, inserting insert
+// and removing the records of remove
+func (p *Provider) update(ctx context.Context, rrsets, insert, remove []dns.RR) error {
+	m := new(dns.Msg)
+	m.SetUpdate(p.zone)
+	if len(rrsets) > 0 {
+		m.RemoveRRset(rrsets)
+	}
+	if len(remove) > 0 {
+		m.Remove(remove)
+	}
+	if len(insert) > 0 {
+		m.Insert(insert)
+	}
+	if p.Config.TSIGKey != "" {
+		m.SetTsig(dns.Fqdn(p.Config.TSIGKey), p.algorithm, tsigFudge, time.Now().Unix())
+	}
+
+	resp, _, err := p.client.ExchangeContext(ctx, m, p.server)
+	if err != nil {
+		return fmt.Errorf("Unable to update %v on %v, %v", p.zone, p.server, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return &provider.Error{
+			Provider:  "rfc2136",
+			Code:      dns.RcodeToString[resp.Rcode],
+			Message:   fmt.Sprintf("update of %v rejected by %v", p.zone, p.server),
+			Temporary: resp.Rcode == dns.RcodeServerFailure,
+		}
+	}
+	return nil
+}
+
+// differs tells whether one of the names does not resolve to ip on the server
+func (p *Provider) differs(ctx context.Context, network, ip string) (bool, error) {
+	for _, name := range p.names {
+		got, err := p.Resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return false, err
+		}
+		if len(got) != 1 || !net.ParseIP(got[0]).Equal(net.ParseIP(ip)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *Provider) verifyError(ip string, err error) error {
+	if err != nil {
+		return fmt.Errorf("Unable to verify the update of %v, %v", p.zone, err)
+	}
+	return fmt.Errorf("Unable to verify the update of %v, %v does not serve %v on every name", p.zone, p.server, ip)
+}
@@ -0,0 +1,241 @@
+package rfc2136
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/ebrianne/duckdns-go/provider"
+)
+
+const (
+	testKey    = "duckdns-go."
+	testSecret = "c2VjcmV0LXNoYXJlZC13aXRoLXRoZS1wcmltYXJ5LXNlcnZlcg=="
+)
+
+// zoneServer is an in-process primary server of example.com applying the UPDATE messages
+type zoneServer struct {
+	mu      sync.Mutex
+	records map[string][]dns.RR
+	updates int
+}
+
+func key(name string, rrtype uint16) string {
+	return dns.CanonicalName(name) + " " + dns.TypeToString[rrtype]
+}
+
+func (s *zoneServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	if r.Opcode == dns.OpcodeUpdate {
+		if r.IsTsig() == nil || w.TsigStatus() != nil {
+			m.Rcode = dns.RcodeNotAuth
+			w.WriteMsg(m)
+			return
+		}
+		s.updates++
+		for _, rr := range r.Ns {
+			h := rr.Header()
+			k := key(h.Name, h.Rrtype)
+			switch h.Class {
+			case dns.ClassANY:
+				delete(s.records, k)
+			case dns.ClassNONE:
+				kept := s.records[k][:0]
+				for _, existing := range s.records[k] {
+					deleted := dns.Copy(rr)
+					deleted.Header().Class = dns.ClassINET
+					if !dns.IsDuplicate(existing, deleted) {
+						kept = append(kept, existing)
+					}
+				}
+				s.records[k] = kept
+			default:
+				s.records[k] = append(s.records[k], rr)
+			}
+		}
+		m.SetTsig(testKey, dns.HmacSHA256, 300, time.Now().Unix())
+		w.WriteMsg(m)
+		return
+	}
+
+	q := r.Question[0]
+	m.Answer = append(m.Answer, s.records[key(q.Name, q.Qtype)]...)
+	if len(m.Answer) == 0 {
+		m.Rcode = dns.RcodeNameError
+	}
+	w.WriteMsg(m)
+}
+
+func (s *zoneServer) values(name string, rrtype uint16) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var values []string
+	for _, rr := range s.records[key(name, rrtype)] {
+		switch rr := rr.(type) {
+		case *dns.A:
+			values = append(values, rr.A.String())
+		case *dns.AAAA:
+			values = append(values, rr.AAAA.String())
+		case *dns.TXT:
+			values = append(values, rr.Txt...)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func startZoneServer(t *testing.T) (*zoneServer, string) {
+	zone := &zoneServer{records: make(map[string][]dns.RR)}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	server := &dns.Server{
+		PacketConn: pc,
+		Handler:    zone,
+		TsigSecret: map[string]string{testKey: testSecret},
+		// the default accept function rejects the UPDATE messages
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return zone, pc.LocalAddr().String()
+}
+
+func newProvider(t *testing.T, addr, secret string) *Provider {
+	p, err := NewProvider(&Config{
+		Server:     addr,
+		Zone:       "example.com",
+		Names:      []string{"home", "office.example.com"},
+		TSIGKey:    testKey,
+		TSIGSecret: secret,
+		Timeout:    time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestUpdateIP(t *testing.T) {
+	zone, addr := startZoneServer(t)
+	p := newProvider(t, addr, testSecret)
+
+	result, err := p.UpdateIP(context.Background(), "192.0.2.1", "2001:db8::1")
+	if err != nil {
+		t.Fatalf("UpdateIP() returned error: %v", err)
+	}
+	if !result.Changed {
+		t.Errorf("UpdateIP() expected to change the records")
+	}
+	for _, name := range []string{"home.example.com.", "office.example.com."} {
+		if got := zone.values(name, dns.TypeA); !reflect.DeepEqual([]string{"192.0.2.1"}, got) {
+			t.Errorf("A of %v expected 192.0.2.1, got %v", name, got)
+		}
+		if got := zone.values(name, dns.TypeAAAA); !reflect.DeepEqual([]string{"2001:db8::1"}, got) {
+			t.Errorf("AAAA of %v expected 2001:db8::1, got %v", name, got)
+		}
+	}
+
+	// the RRset is replaced
+	result, err = p.UpdateIP(context.Background(), "192.0.2.2", "")
+	if err != nil || !result.Changed {
+		t.Fatalf("UpdateIP() expected a change, got %+v, %v", result, err)
+	}
+	if got := zone.values("home.example.com.", dns.TypeA); !reflect.DeepEqual([]string{"192.0.2.2"}, got) {
+		t.Errorf("A expected to be replaced by 192.0.2.2, got %v", got)
+	}
+	result, err = p.UpdateIP(context.Background(), "192.0.2.2", "")
+	if err != nil || result.Changed {
+		t.Errorf("UpdateIP() expected no change, got %+v, %v", result, err)
+	}
+
+	if err := p.ClearIP(context.Background()); err != nil {
+		t.Fatalf("ClearIP() returned error: %v", err)
+	}
+	if got := zone.values("home.example.com.", dns.TypeAAAA); len(got) != 0 {
+		t.Errorf("AAAA expected to be cleared, got %v", got)
+	}
+}
+
+func TestTXT(t *testing.T) {
+	zone, addr := startZoneServer(t)
+	p := newProvider(t, addr, testSecret)
+	ctx := context.Background()
+
+	if err := p.SetTXT(ctx, "first"); err != nil {
+		t.Fatalf("SetTXT() returned error: %v", err)
+	}
+	if err := p.SetTXT(ctx, "second"); err != nil {
+		t.Fatalf("SetTXT() returned error: %v", err)
+	}
+	if got := zone.values("office.example.com.", dns.TypeTXT); !reflect.DeepEqual([]string{"second"}, got) {
+		t.Errorf("TXT expected to be replaced by second, got %v", got)
+	}
+
+	if err := p.ClearTXT(ctx, "other"); err != nil {
+		t.Fatalf("ClearTXT() returned error: %v", err)
+	}
+	if got := zone.values("office.example.com.", dns.TypeTXT); len(got) != 1 {
+		t.Errorf("TXT expected to be kept when clearing another value, got %v", got)
+	}
+	if err := p.ClearTXT(ctx, "second"); err != nil {
+		t.Fatalf("ClearTXT() returned error: %v", err)
+	}
+	if got := zone.values("office.example.com.", dns.TypeTXT); len(got) != 0 {
+		t.Errorf("TXT expected to be cleared, got %v", got)
+	}
+}
+
+func TestBadKey(t *testing.T) {
+	zone, addr := startZoneServer(t)
+	p := newProvider(t, addr, "d3Jvbmctc2VjcmV0")
+
+	_, err := p.UpdateIP(context.Background(), "192.0.2.1", "")
+	if err == nil {
+		t.Fatalf("UpdateIP() expected to fail with a wrong TSIG secret")
+	}
+	var e *provider.Error
+	if !errors.As(err, &e) || e.Code != "NOTAUTH" {
+		t.Errorf("UpdateIP() expected a NOTAUTH error, got %v", err)
+	}
+	if zone.updates != 0 {
+		t.Errorf("No update expected to be applied, got %v", zone.updates)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if _, err := NewProvider(&Config{Server: "10.0.0.1"}); err == nil {
+		t.Errorf("NewProvider() expected an error without zone and names")
+	}
+	if _, err := NewProvider(&Config{Server: "10.0.0.1", Zone: "example.com", Names: []string{"home"}, TSIGKey: "k", TSIGSecret: "!"}); err == nil {
+		t.Errorf("NewProvider() expected an error for an invalid secret")
+	}
+
+	p, err := NewProvider(&Config{Server: "10.0.0.1", Zone: "Example.com.", Names: []string{"home", "www.example.com."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.server != "10.0.0.1:53" {
+		t.Errorf("Server expected to default to port 53, got %v", p.server)
+	}
+	if want, got := []string{"home.example.com", "www.example.com"}, p.Domains(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Domains() expected %v, got %v", want, got)
+	}
+	if p.Capabilities().DetectIP {
+		t.Errorf("Capabilities() expected without IP detection")
+	}
+}
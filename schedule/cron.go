@@ -0,0 +1,156 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cron is a cron expression, each field is the set of its allowed values
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	// a day matches both the day of month and the day of week only when none is *
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCron(spec string) (*cron, error) {
+	if macro, ok := macros[spec]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("Invalid schedule %q, a cron expression has 5 fields: minute hour day-of-month month day-of-week", spec)
+	}
+
+	sets := make([]uint64, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule %q, %v", spec, err)
+		}
+		sets[i] = set
+	}
+	// 7 is also Sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	c := &cron{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domStar: fields[2] == "*", dowStar: fields[4] == "*",
+	}
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("Invalid schedule %q, it never runs", spec)
+	}
+	return c, nil
+}
+
+// parseCronField parses a list of *, values or ranges, each with an optional /step
+func parseCronField(field string, f cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, step := part, 1
+		if idx := strings.Index(part, "/"); idx != -1 {
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step in %v %q", f.name, part)
+			}
+			expr, step = part[:idx], s
+		}
+
+		low, high := f.min, f.max
+		switch {
+		case expr == "*":
+		case strings.Contains(expr, "-"):
+			bounds := strings.SplitN(expr, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid %v %q", f.name, part)
+			}
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid %v %q", f.name, part)
+			}
+		default:
+			v, err := strconv.Atoi(expr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %v %q", f.name, part)
+			}
+			low = v
+			// a value with a step starts a range, as in 5/15
+			if step == 1 {
+				high = v
+			}
+		}
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("%v %q out of %v-%v", f.name, part, f.min, f.max)
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first minute after t matching the expression, in the location of t
+func (c *cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(5, 0, 0)
+	for next.Before(limit) {
+		y, m, d := next.Date()
+		var skip time.Time
+		switch {
+		case !has(c.month, int(m)):
+			skip = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(next):
+			skip = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case !has(c.hour, next.Hour()):
+			skip = time.Date(y, m, d, next.Hour()+1, 0, 0, 0, loc)
+		case !has(c.minute, next.Minute()):
+			skip = next.Add(time.Minute)
+		default:
+			return next
+		}
+		// the daylight saving changes can normalize the date backward
+		if !skip.After(next) {
+			skip = next.Truncate(time.Minute).Add(time.Minute)
+		}
+		next = skip
+	}
+	return time.Time{}
+}
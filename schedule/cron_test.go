@@ -0,0 +1,89 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParse_Cron(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want []string
+	}{
+		{"*/30 * * * *", "2021-01-13 11:17", []string{"2021-01-13 11:30", "2021-01-13 12:00", "2021-01-13 12:30"}},
+		{"0 */6 * * *", "2021-01-13 11:17", []string{"2021-01-13 12:00", "2021-01-13 18:00", "2021-01-14 00:00"}},
+		{"5/20 3 * * *", "2021-01-13 03:30", []string{"2021-01-13 03:45", "2021-01-14 03:05"}},
+		{"15 4 1,15 * *", "2021-01-13 11:17", []string{"2021-01-15 04:15", "2021-02-01 04:15"}},
+		{"0 9 * * 1-5", "2021-01-15 10:00", []string{"2021-01-18 09:00", "2021-01-19 09:00"}},
+		{"0 0 * * 7", "2021-01-13 11:17", []string{"2021-01-17 00:00", "2021-01-24 00:00"}},
+		// both days set: either matches
+		{"0 0 13 * 5", "2021-01-12 00:00", []string{"2021-01-13 00:00", "2021-01-15 00:00"}},
+		{"0 0 29 2 *", "2021-01-13 11:17", []string{"2024-02-29 00:00"}},
+		{"@daily", "2021-01-13 11:17", []string{"2021-01-14 00:00", "2021-01-15 00:00"}},
+		{"@hourly", "2021-01-13 11:17", []string{"2021-01-13 12:00"}},
+		{"@every 90m", "2021-01-13 11:17", []string{"2021-01-13 12:47", "2021-01-13 14:17"}},
+	}
+	for _, test := range tests {
+		s, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", test.spec, err)
+			continue
+		}
+		next := date(test.from)
+		for _, want := range test.want {
+			next = s.Next(next)
+			if !next.Equal(date(want)) {
+				t.Errorf("%q expected to run at %v, got %v", test.spec, want, next)
+				break
+			}
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"* * * *", "5 fields"},
+		{"60 * * * *", "minute \"60\" out of 0-59"},
+		{"* 5-2 * * *", "hour \"5-2\" out of 0-23"},
+		{"*/0 * * * *", "invalid step"},
+		{"a * * * *", "invalid minute"},
+		{"0 0 30 2 *", "never runs"},
+		{"@every x", "Invalid schedule"},
+		{"@every -1h", "needs to be positive"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.spec)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Parse(%q) expected error containing %q, got %v", test.spec, test.want, err)
+		}
+	}
+}
+
+func TestCron_DaylightSaving(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	s, err := Parse("30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 02:30 does not exist on 2021-03-28 in Paris
+	next := s.Next(time.Date(2021, 3, 27, 12, 0, 0, 0, paris))
+	if want := time.Date(2021, 3, 29, 2, 30, 0, 0, paris); !next.Equal(want) {
+		t.Errorf("Expected to run at %v, got %v", want, next)
+	}
+}
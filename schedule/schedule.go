@@ -0,0 +1,181 @@
+// Package schedule computes when the periodic updates run.
+//
+// A schedule is a fixed interval or a cron expression, optionally postponed out of quiet
+// windows and delayed by a random jitter so that many clients do not update together. The
+// time comes from a Clock, replaced by a FakeClock in the tests.
+package schedule
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule returns the times of the runs.
+type Schedule interface {
+	// Next returns the first run after t, the zero time when there is none
+	Next(t time.Time) time.Time
+}
+
+// Every returns a schedule running every d.
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// Parse returns the schedule of a cron expression of five fields (minute, hour, day of
+// month, month and day of week), of @hourly, @daily, @weekly, @monthly or @yearly, or of
+// "@every <duration>".
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule %q, %v", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("Invalid schedule %q, the interval needs to be positive", spec)
+		}
+		return Every(d), nil
+	}
+	return parseCron(spec)
+}
+
+// Jitter returns s with the runs delayed by a random duration up to max.
+func Jitter(s Schedule, max time.Duration) Schedule {
+	if max <= 0 {
+		return s
+	}
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var mu sync.Mutex
+	return &jitter{Schedule: s, max: max, rand: func(n int64) int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Int63n(n)
+	}}
+}
+
+type jitter struct {
+	Schedule
+	max  time.Duration
+	rand func(n int64) int64
+}
+
+func (j *jitter) Next(t time.Time) time.Time {
+	next := j.Schedule.Next(t)
+	if next.IsZero() {
+		return next
+	}
+	return next.Add(time.Duration(j.rand(int64(j.max))))
+}
+
+// Window is a daily time window, from Start to End in the day. It goes over midnight when
+// End is before Start.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseWindow parses a window written as 23:00-06:00.
+func ParseWindow(s string) (Window, error) {
+	bounds := strings.Split(s, "-")
+	if len(bounds) != 2 {
+		return Window{}, fmt.Errorf("Invalid window %q, needs to be written as 23:00-06:00", s)
+	}
+	var w Window
+	for i, bound := range bounds {
+		t, err := time.Parse("15:04", strings.TrimSpace(bound))
+		if err != nil {
+			return Window{}, fmt.Errorf("Invalid window %q, needs to be written as 23:00-06:00", s)
+		}
+		d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		if i == 0 {
+			w.Start = d
+		} else {
+			w.End = d
+		}
+	}
+	if w.Start == w.End {
+		return Window{}, fmt.Errorf("Invalid window %q, the start and the end are the same", s)
+	}
+	return w, nil
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", int(w.Start.Hours()), int(w.Start.Minutes())%60, int(w.End.Hours()), int(w.End.Minutes())%60)
+}
+
+// Contains returns whether t is in the window, in the location of t.
+func (w Window) Contains(t time.Time) bool {
+	d := sinceMidnight(t)
+	if w.Start < w.End {
+		return d >= w.Start && d < w.End
+	}
+	return d >= w.Start || d < w.End
+}
+
+// EndAfter returns the first end of the window after t.
+func (w Window) EndAfter(t time.Time) time.Time {
+	y, m, d := t.Date()
+	end := time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Add(w.End)
+	if !end.After(t) {
+		end = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location()).Add(w.End)
+	}
+	return end
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// Quiet returns s with the runs falling in one of the windows postponed to the end of the
+// window. When s is a Jitter schedule, the postponed runs are delayed after the end of the
+// window by a random duration up to its max, so that they are not all at the end.
+func Quiet(s Schedule, windows ...Window) Schedule {
+	if len(windows) == 0 {
+		return s
+	}
+	q := &quiet{Schedule: s, windows: windows}
+	q.jitter, _ = s.(*jitter)
+	return q
+}
+
+type quiet struct {
+	Schedule
+	windows []Window
+	// jitter spreads the postponed runs, nil when s has no jitter
+	jitter *jitter
+}
+
+// endAfter returns the end of w after t, with the jitter
+func (q *quiet) endAfter(w Window, t time.Time) time.Time {
+	end := w.EndAfter(t)
+	if q.jitter != nil {
+		end = end.Add(time.Duration(q.jitter.rand(int64(q.jitter.max))))
+	}
+	return end
+}
+
+func (q *quiet) Next(t time.Time) time.Time {
+	next := q.Schedule.Next(t)
+	// the end of a window may be in another one
+	for i := 0; i <= len(q.windows) && !next.IsZero(); i++ {
+		moved := false
+		for _, w := range q.windows {
+			if w.Contains(next) {
+				next, moved = q.endAfter(w, next), true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+	return next
+}
@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitter(t *testing.T) {
+	j := Jitter(Every(time.Hour), 10*time.Minute).(*jitter)
+	delays := []int64{0, int64(5 * time.Minute), int64(10*time.Minute) - 1}
+	j.rand = func(n int64) int64 {
+		if n != int64(10*time.Minute) {
+			t.Errorf("Expected a delay below 10m, got bound %v", time.Duration(n))
+		}
+		d := delays[0]
+		delays = delays[1:]
+		return d
+	}
+
+	from := date("2021-01-13 11:00")
+	for _, want := range []time.Duration{time.Hour, time.Hour + 5*time.Minute, time.Hour + 10*time.Minute - 1} {
+		if next := j.Next(from); !next.Equal(from.Add(want)) {
+			t.Errorf("Expected to run at %v, got %v", from.Add(want), next)
+		}
+	}
+
+	if s := Jitter(Every(time.Hour), 0); s != Every(time.Hour) {
+		t.Errorf("Expected no jitter with a zero max, got %#v", s)
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow("23:00-06:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Start != 23*time.Hour || w.End != 6*time.Hour+30*time.Minute || w.String() != "23:00-06:30" {
+		t.Errorf("Unexpected window %v", w)
+	}
+
+	for _, s := range []string{"23:00", "23:00-25:00", "10:00-10:00", "a-b"} {
+		if _, err := ParseWindow(s); err == nil {
+			t.Errorf("ParseWindow(%q) expected an error", s)
+		}
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	night, _ := ParseWindow("23:00-06:00")
+	lunch, _ := ParseWindow("12:00-13:00")
+	lunchEnd, _ := ParseWindow("13:00-13:30")
+	s := Quiet(Every(time.Hour), night, lunch, lunchEnd)
+
+	tests := []struct {
+		from string
+		want string
+	}{
+		{"2021-01-13 10:00", "2021-01-13 11:00"},
+		{"2021-01-13 11:30", "2021-01-13 13:30"},
+		{"2021-01-13 22:30", "2021-01-14 06:00"},
+		{"2021-01-14 02:00", "2021-01-14 06:00"},
+		{"2021-01-14 05:30", "2021-01-14 06:30"},
+	}
+	for _, test := range tests {
+		if next := s.Next(date(test.from)); !next.Equal(date(test.want)) {
+			t.Errorf("From %v expected to run at %v, got %v", test.from, test.want, next)
+		}
+	}
+}
+
+func TestQuietJitter(t *testing.T) {
+	night, _ := ParseWindow("23:00-06:00")
+	j := Jitter(Every(time.Hour), 10*time.Minute).(*jitter)
+	j.rand = func(n int64) int64 { return int64(4 * time.Minute) }
+	s := Quiet(j, night)
+
+	// the run is delayed once by the jitter, then postponed with another delay
+	if next, want := s.Next(date("2021-01-13 22:30")), date("2021-01-14 06:04"); !next.Equal(want) {
+		t.Errorf("Expected to run at %v, got %v", want, next)
+	}
+	if next, want := s.Next(date("2021-01-14 08:00")), date("2021-01-14 09:04"); !next.Equal(want) {
+		t.Errorf("Expected to run at %v, got %v", want, next)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	start := date("2021-01-13 11:00")
+	c := NewFakeClock(start)
+	done := make(chan time.Time)
+	go func() {
+		done <- <-c.After(time.Minute)
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(30 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("Timer fired before its time")
+	default:
+	}
+	c.Advance(30 * time.Second)
+	if fired := <-done; !fired.Equal(start.Add(time.Minute)) {
+		t.Errorf("Timer expected to fire at %v, got %v", start.Add(time.Minute), fired)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+	"k8s.io/klog/v2"
+)
+
+// ServeDNS answers the queries of the zone with authority. Names outside of the zone are
+// refused, unknown domains are NXDOMAIN and the negative answers carry the SOA.
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	if len(r.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		w.WriteMsg(m)
+		return
+	}
+
+	q := r.Question[0]
+	name := dns.CanonicalName(q.Name)
+	if !dns.IsSubDomain(s.zone, name) {
+		m.Authoritative = false
+		m.Rcode = dns.RcodeRefused
+		w.WriteMsg(m)
+		return
+	}
+
+	s.mu.Lock()
+	soa := s.soa()
+	var record Record
+	var found bool
+	if name != s.zone {
+		var saved *Record
+		saved, found = s.records[s.domain(name)]
+		if found {
+			record = *saved
+		}
+	}
+	s.mu.Unlock()
+
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: s.ttl()}
+	switch {
+	case name == s.zone:
+		switch q.Qtype {
+		case dns.TypeSOA:
+			m.Answer = append(m.Answer, soa)
+		case dns.TypeNS:
+			m.Answer = append(m.Answer, &dns.NS{Hdr: hdr, Ns: s.nameserver})
+		}
+	case !found:
+		m.Rcode = dns.RcodeNameError
+	default:
+		for _, rr := range answers(record, hdr) {
+			if q.Qtype == dns.TypeANY || rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+	}
+
+	if len(m.Answer) == 0 {
+		m.Ns = append(m.Ns, soa)
+	}
+	w.WriteMsg(m)
+}
+
+// soa returns the SOA of the zone, the serial is bumped on every change
+func (s *Server) soa() *dns.SOA {
+	ttl := s.ttl()
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: s.zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:      s.nameserver,
+		Mbox:    "hostmaster." + s.zone,
+		Serial:  s.serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  ttl,
+	}
+}
+
+func (s *Server) ttl() uint32 {
+	ttl := s.Config.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return uint32(ttl / time.Second)
+}
+
+// answers returns the A, AAAA and TXT records of a domain with the header of the question
+func answers(record Record, hdr dns.RR_Header) []dns.RR {
+	header := func(rrtype uint16) dns.RR_Header {
+		h := hdr
+		h.Rrtype = rrtype
+		return h
+	}
+
+	var rrs []dns.RR
+	if ip := net.ParseIP(record.IPv4); ip != nil {
+		rrs = append(rrs, &dns.A{Hdr: header(dns.TypeA), A: ip.To4()})
+	}
+	if ip := net.ParseIP(record.IPv6); ip != nil {
+		rrs = append(rrs, &dns.AAAA{Hdr: header(dns.TypeAAAA), AAAA: ip})
+	}
+	if record.TXT != "" {
+		rrs = append(rrs, &dns.TXT{Hdr: header(dns.TypeTXT), Txt: splitTXT(record.TXT)})
+	}
+	return rrs
+}
+
+// splitTXT splits a value in the 255 bytes strings of a TXT record
+func splitTXT(value string) []string {
+	var parts []string
+	for len(value) > 255 {
+		parts = append(parts, value[:255])
+		value = value[255:]
+	}
+	return append(parts, value)
+}
+
+// ListenAndServe serves the update endpoint on httpAddr and the DNS server on dnsAddr over
+// UDP and TCP, it returns the first error.
+func (s *Server) ListenAndServe(httpAddr, dnsAddr string) error {
+	errs := make(chan error, 3)
+	for _, network := range []string{"udp", "tcp"} {
+		server := &dns.Server{Addr: dnsAddr, Net: network, Handler: s}
+		go func() { errs <- server.ListenAndServe() }()
+	}
+	go func() { errs <- http.ListenAndServe(httpAddr, s) }()
+
+	klog.Infof("Serving the updates on %v and the %v zone on %v", httpAddr, s.zone, dnsAddr)
+	return <-errs
+}
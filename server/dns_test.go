@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func startDNS(t *testing.T, s *Server) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: s}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func exchange(t *testing.T, addr, name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	resp, err := dns.Exchange(m, addr)
+	if err != nil {
+		t.Fatalf("Exchange(%v) returned error: %v", name, err)
+	}
+	return resp
+}
+
+func TestServeDNS(t *testing.T) {
+	s := newServer(t, MemoryStore{})
+	s.SetRecord("home", Record{IPv4: "192.0.2.1", TXT: "hello"})
+	addr := startDNS(t, s)
+
+	tests := []struct {
+		name    string
+		qtype   uint16
+		rcode   int
+		answers int
+		soa     bool
+	}{
+		{"home.dyn.lab.", dns.TypeA, dns.RcodeSuccess, 1, false},
+		{"www.home.dyn.lab.", dns.TypeTXT, dns.RcodeSuccess, 1, false},
+		{"home.dyn.lab.", dns.TypeAAAA, dns.RcodeSuccess, 0, true},
+		{"home.dyn.lab.", dns.TypeANY, dns.RcodeSuccess, 2, false},
+		{"office.dyn.lab.", dns.TypeA, dns.RcodeSuccess, 0, true},
+		{"unknown.dyn.lab.", dns.TypeA, dns.RcodeNameError, 0, true},
+		{"dyn.lab.", dns.TypeSOA, dns.RcodeSuccess, 1, false},
+		{"dyn.lab.", dns.TypeNS, dns.RcodeSuccess, 1, false},
+		{"example.com.", dns.TypeA, dns.RcodeRefused, 0, false},
+	}
+	for _, test := range tests {
+		resp := exchange(t, addr, test.name, test.qtype)
+		if resp.Rcode != test.rcode || len(resp.Answer) != test.answers {
+			t.Errorf("%v %v expected %v with %d answers, got %v with %v", test.name, dns.TypeToString[test.qtype],
+				dns.RcodeToString[test.rcode], test.answers, dns.RcodeToString[resp.Rcode], resp.Answer)
+		}
+		if test.soa && (len(resp.Ns) != 1 || resp.Ns[0].Header().Rrtype != dns.TypeSOA) {
+			t.Errorf("%v %v expected the SOA in the authority section, got %v", test.name, dns.TypeToString[test.qtype], resp.Ns)
+		}
+		if test.rcode != dns.RcodeRefused && !resp.Authoritative {
+			t.Errorf("%v expected an authoritative answer", test.name)
+		}
+	}
+
+	before := exchange(t, addr, "dyn.lab.", dns.TypeSOA).Answer[0].(*dns.SOA).Serial
+	s.Update(map[string][]string{"domains": {"home"}, "token": {"token"}, "ip": {"192.0.2.2"}}, "")
+	if after := exchange(t, addr, "dyn.lab.", dns.TypeSOA).Answer[0].(*dns.SOA).Serial; after <= before {
+		t.Errorf("SOA serial expected to increase after an update, got %v then %v", before, after)
+	}
+}
@@ -0,0 +1,247 @@
+// Package server implements a self-hosted DuckDNS compatible service.
+//
+// Server accepts the /update?domains=&token=&ip=&ipv6=&txt=&clear=&verbose= requests of the
+// DuckDNS API with the same answers, keeps the records in a Store and serves them as the
+// authoritative DNS server of its zone. Every name below a domain resolves to the records
+// of the domain, as on duckdns.org.
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultZone = "duckdns.org"
+	defaultTTL  = time.Minute
+)
+
+// Record holds the records of a domain
+type Record struct {
+	IPv4    string    `json:"ipv4,omitempty"`
+	IPv6    string    `json:"ipv6,omitempty"`
+	TXT     string    `json:"txt,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// Config contains the service configuration.
+type Config struct {
+	// Zone served by the DNS server, duckdns.org by default
+	Zone string
+	// Token accepted by the update endpoint
+	Token string
+	// Domains that can be updated, relative to the zone
+	Domains []string
+	// Nameserver is the name of the DNS server in the SOA and NS records, ns1.<zone> by default
+	Nameserver string
+	TTL        time.Duration
+}
+
+// Server is the update endpoint and the DNS server of the zone.
+type Server struct {
+	Config *Config
+
+	zone       string
+	nameserver string
+	store      Store
+	now        func() time.Time
+
+	mu      sync.Mutex
+	records map[string]*Record
+	serial  uint32
+}
+
+// New returns a server of the configured domains, with the records loaded from store.
+func New(config *Config, store Store) (*Server, error) {
+	if config.Token == "" || len(config.Domains) == 0 {
+		return nil, errors.New("The server needs a token and domains")
+	}
+
+	s := &Server{
+		Config: config,
+		zone:   dns.Fqdn(strings.ToLower(config.Zone)),
+		store:  store,
+		now:    time.Now,
+	}
+	if s.zone == "." {
+		s.zone = dns.Fqdn(defaultZone)
+	}
+	s.nameserver = dns.Fqdn(config.Nameserver)
+	if config.Nameserver == "" {
+		s.nameserver = "ns1." + s.zone
+	}
+
+	records, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	s.records = make(map[string]*Record)
+	for _, domain := range config.Domains {
+		domain = s.domain(domain)
+		s.records[domain] = &Record{}
+		if saved, ok := records[domain]; ok {
+			s.records[domain] = saved
+		}
+	}
+	s.serial = uint32(s.now().Unix())
+	return s, nil
+}
+
+// Domains returns the domains of the server.
+func (s *Server) Domains() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	domains := make([]string, 0, len(s.records))
+	for domain := range s.records {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// Record returns a copy of the records of domain, nil for an unknown domain.
+func (s *Server) Record(domain string) *Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[s.domain(domain)]
+	if !ok {
+		return nil
+	}
+	record := *r
+	return &record
+}
+
+// SetRecord sets the records of domain, adding the domain when it is unknown.
+func (s *Server) SetRecord(domain string, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[s.domain(domain)] = &record
+	s.serial++
+	return s.store.Save(s.records)
+}
+
+// ServeHTTP answers the /update requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/update" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	fmt.Fprint(w, s.Update(r.URL.Query(), r.RemoteAddr))
+}
+
+// Update applies an update query like DuckDNS and returns the body of the answer. Without
+// ip and ipv6, the IPv4 of remoteAddr is published.
+func (s *Server) Update(q url.Values, remoteAddr string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if subtle.ConstantTimeCompare([]byte(q.Get("token")), []byte(s.Config.Token)) != 1 || q.Get("domains") == "" {
+		return "KO"
+	}
+	var records []*Record
+	for _, domain := range strings.Split(q.Get("domains"), ",") {
+		record, ok := s.records[s.domain(domain)]
+		if !ok {
+			return "KO"
+		}
+		records = append(records, record)
+	}
+
+	clearing := q.Get("clear") == "true"
+	verbose := q.Get("verbose") == "true"
+
+	if _, ok := q["txt"]; ok {
+		txt := q.Get("txt")
+		if clearing {
+			txt = ""
+		}
+		changed := s.apply(records, func(record *Record) { record.TXT = txt })
+		if verbose {
+			return fmt.Sprintf("OK\n%s\n%s", txt, status(changed))
+		}
+		return "OK"
+	}
+
+	ipv4, ipv6 := q.Get("ip"), q.Get("ipv6")
+	if !clearing {
+		if ipv4 == "" && ipv6 == "" {
+			if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+				ipv4 = host
+			}
+		}
+		if ip := net.ParseIP(ipv4); ipv4 != "" && ip == nil {
+			return "KO"
+		} else if ip != nil && ip.To4() == nil {
+			// an IPv6 address in ip is published as the AAAA record
+			ipv4, ipv6 = "", ipv4
+		}
+		if ipv6 != "" && net.ParseIP(ipv6) == nil {
+			return "KO"
+		}
+	}
+
+	changed := s.apply(records, func(record *Record) {
+		if clearing {
+			record.IPv4, record.IPv6 = "", ""
+		}
+		if ipv4 != "" {
+			record.IPv4 = ipv4
+		}
+		if ipv6 != "" {
+			record.IPv6 = ipv6
+		}
+	})
+	if verbose {
+		return fmt.Sprintf("OK\n%s\n%s\n%s", ipv4, ipv6, status(changed))
+	}
+	return "OK"
+}
+
+// apply changes the records and saves them when one of them changed
+func (s *Server) apply(records []*Record, change func(*Record)) bool {
+	changed := false
+	for _, record := range records {
+		before := *record
+		change(record)
+		if *record != before {
+			record.Updated = s.now()
+			changed = true
+		}
+	}
+	if changed {
+		s.serial++
+		if err := s.store.Save(s.records); err != nil {
+			klog.Error(err)
+		}
+	}
+	return changed
+}
+
+// domain returns the domain of a name: example for example, example.<zone> or www.example.<zone>
+func (s *Server) domain(name string) string {
+	name = dns.Fqdn(strings.ToLower(name))
+	if !dns.IsSubDomain(s.zone, name) || name == s.zone {
+		return strings.TrimSuffix(name, ".")
+	}
+	labels := dns.SplitDomainName(strings.TrimSuffix(name, "."+s.zone))
+	return labels[len(labels)-1]
+}
+
+func status(changed bool) string {
+	if changed {
+		return "UPDATED"
+	}
+	return "NOCHANGE"
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T, store Store) *Server {
+	s, err := New(&Config{Zone: "dyn.lab", Token: "token", Domains: []string{"home", "office"}}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return time.Date(2021, 1, 13, 11, 17, 15, 0, time.UTC) }
+	return s
+}
+
+func update(t *testing.T, s *Server, query string) string {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/update?"+query, nil)
+	req.RemoteAddr = "192.0.2.9:41000"
+	s.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; charset=UTF-8" {
+		t.Errorf("Content-Type expected text/plain, got %v", got)
+	}
+	return rec.Body.String()
+}
+
+func TestUpdate(t *testing.T) {
+	s := newServer(t, MemoryStore{})
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"domains=home&token=wrong&ip=192.0.2.1", "KO"},
+		{"domains=unknown&token=token&ip=192.0.2.1", "KO"},
+		{"domains=home&token=token&ip=not-an-ip", "KO"},
+		{"domains=home,office.dyn.lab&token=token&ip=192.0.2.1", "OK"},
+		{"domains=home&token=token&ip=192.0.2.1&verbose=true", "OK\n192.0.2.1\n\nNOCHANGE"},
+		{"domains=home&token=token&ip=&verbose=true", "OK\n192.0.2.9\n\nUPDATED"},
+		{"domains=home&token=token&ip=2001:db8::1&verbose=true", "OK\n\n2001:db8::1\nUPDATED"},
+		{"domains=home&token=token&txt=hello%20world&verbose=true", "OK\nhello world\nUPDATED"},
+	}
+	for _, test := range tests {
+		if got := update(t, s, test.query); got != test.want {
+			t.Errorf("Update(%v) expected %q, got %q", test.query, test.want, got)
+		}
+	}
+
+	want := Record{IPv4: "192.0.2.9", IPv6: "2001:db8::1", TXT: "hello world", Updated: s.now()}
+	if got := s.Record("home.dyn.lab"); *got != want {
+		t.Errorf("Record expected %+v, got %+v", want, got)
+	}
+
+	update(t, s, "domains=home&token=token&txt=hello&clear=true")
+	update(t, s, "domains=home&token=token&clear=true")
+	if got := s.Record("home"); got.IPv4 != "" || got.IPv6 != "" || got.TXT != "" {
+		t.Errorf("Record expected to be cleared, got %+v", got)
+	}
+	if got := s.Record("office"); got.IPv4 != "192.0.2.1" {
+		t.Errorf("office expected to be kept, got %+v", got)
+	}
+}
+
+func TestUpdatePersistence(t *testing.T) {
+	store := &FileStore{Path: filepath.Join(t.TempDir(), "records.json")}
+	s := newServer(t, store)
+	update(t, s, url.Values{"domains": {"office"}, "token": {"token"}, "ip": {"192.0.2.1"}, "txt": {"a&b=c"}}.Encode())
+	update(t, s, "domains=office&token=token&ip=192.0.2.1")
+
+	restarted := newServer(t, store)
+	if got := restarted.Record("office"); got.IPv4 != "192.0.2.1" {
+		t.Errorf("Record expected to be loaded from the store, got %+v", got)
+	}
+	if got := restarted.Record("office"); got.TXT != "a&b=c" {
+		t.Errorf("TXT expected to be loaded from the store, got %+v", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(&Config{Token: "token"}, MemoryStore{}); err == nil {
+		t.Errorf("New() expected an error without domains")
+	}
+	s, err := New(&Config{Token: "token", Domains: []string{"example"}}, MemoryStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.zone != "duckdns.org." || s.nameserver != "ns1.duckdns.org." {
+		t.Errorf("Zone expected to default to duckdns.org, got %v %v", s.zone, s.nameserver)
+	}
+}
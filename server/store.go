@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Store persists the records of the domains.
+type Store interface {
+	// Load returns the saved records, an empty map when nothing was saved yet
+	Load() (map[string]*Record, error)
+	Save(records map[string]*Record) error
+}
+
+// MemoryStore keeps nothing, the records are lost on restart.
+type MemoryStore struct{}
+
+// Load returns no record.
+func (MemoryStore) Load() (map[string]*Record, error) {
+	return map[string]*Record{}, nil
+}
+
+// Save does nothing.
+func (MemoryStore) Save(records map[string]*Record) error {
+	return nil
+}
+
+// FileStore saves the records in a JSON file, replaced atomically on every save.
+type FileStore struct {
+	Path string
+}
+
+// Load reads the file, a missing file holds no record.
+func (f *FileStore) Load() (map[string]*Record, error) {
+	records := map[string]*Record{}
+	data, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the records, %v", err)
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("Unable to decode the records of %v, %v", f.Path, err)
+	}
+	return records, nil
+}
+
+// Save writes the records to a temporary file renamed over the previous one.
+func (f *FileStore) Save(records map[string]*Record) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("Unable to save the records, %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Unable to save the records, %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Unable to save the records, %v", err)
+	}
+	if err := os.Rename(tmp.Name(), f.Path); err != nil {
+		return fmt.Errorf("Unable to save the records, %v", err)
+	}
+	return nil
+}
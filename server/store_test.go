@@ -0,0 +1,42 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	store := &FileStore{Path: filepath.Join(dir, "records.json")}
+
+	records, err := store.Load()
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Load() of a missing file expected no record, got %v, %v", records, err)
+	}
+
+	want := map[string]*Record{"home": {IPv4: "192.0.2.1", TXT: "hello", Updated: time.Date(2021, 1, 13, 0, 0, 0, 0, time.UTC)}}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Load() expected %v, got %v", want, got)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Save() expected to leave a single file, got %d", len(files))
+	}
+
+	ioutil.WriteFile(store.Path, []byte("{"), os.ModePerm)
+	if _, err := store.Load(); err == nil {
+		t.Errorf("Load() expected an error for a corrupted file")
+	}
+}
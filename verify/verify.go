@@ -0,0 +1,90 @@
+// Package verify compares the records published in DNS with the IPs sent to duckdns.
+package verify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+)
+
+// Drift describes a published record that does not match the intended IP.
+type Drift struct {
+	Domain   string
+	Resolver string
+	Type     string
+	Want     string
+	Got      []string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s %s from %s is %v, want %s", d.Domain, d.Type, d.Resolver, d.Got, d.Want)
+}
+
+// Verifier resolves the domains with every resolver and reports the drifts.
+type Verifier struct {
+	Resolvers []duckdns.Resolver
+}
+
+// Check resolves A (when ipv4 is set) and AAAA (when ipv6 is set) records of every domain.
+// Lookup errors do not stop the verification, they are returned together once every resolver was queried.
+func (v *Verifier) Check(ctx context.Context, domains []string, ipv4, ipv6 string) ([]Drift, error) {
+	var drifts []Drift
+	var errs []string
+
+	checks := []struct {
+		network string
+		rrtype  string
+		want    string
+	}{
+		{"ip4", "A", ipv4},
+		{"ip6", "AAAA", ipv6},
+	}
+
+	for _, domain := range domains {
+		for _, r := range v.Resolvers {
+			for _, check := range checks {
+				if check.want == "" {
+					continue
+				}
+				got, err := r.LookupIP(ctx, check.network, domain)
+				if err != nil {
+					errs = append(errs, err.Error())
+					continue
+				}
+				if !matches(got, check.want) {
+					drifts = append(drifts, Drift{
+						Domain:   domain,
+						Resolver: r.String(),
+						Type:     check.rrtype,
+						Want:     check.want,
+						Got:      got,
+					})
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return drifts, fmt.Errorf("Unable to verify every record, %v", strings.Join(errs, "; "))
+	}
+	return drifts, nil
+}
+
+// matches checks the single duckdns record against the intended IP, comparing the
+// canonical forms so that 0:0:0:0:0:ffff:a0a:afd and ::ffff:a0a:afd are equal
+func matches(got []string, want string) bool {
+	if len(got) != 1 {
+		return false
+	}
+	return canonical(got[0]) == canonical(want)
+}
+
+func canonical(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+	return ip
+}
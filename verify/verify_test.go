@@ -0,0 +1,86 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/ebrianne/duckdns-go/duckdns"
+)
+
+// startDNSServer serves the given records, keyed by question type, for every name
+func startDNSServer(t *testing.T, records map[uint16]string) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+		q := r.Question[0]
+		if value, ok := records[q.Qtype]; ok {
+			rr, err := dns.NewRR(q.Name + " 60 IN " + dns.TypeToString[q.Qtype] + " " + value)
+			if err != nil {
+				t.Errorf("Unable to build record: %v", err)
+			}
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func TestCheck(t *testing.T) {
+	addr := startDNSServer(t, map[uint16]string{
+		dns.TypeA:    "10.10.10.253",
+		dns.TypeAAAA: "2001:db8::1",
+	})
+	resolvers, err := duckdns.NewResolvers([]string{addr}, duckdns.ResolverOptions{})
+	if err != nil {
+		t.Fatalf("NewResolvers() returned error: %v", err)
+	}
+	v := &Verifier{Resolvers: resolvers}
+
+	drifts, err := v.Check(context.Background(), []string{"example"}, "10.10.10.253", "2001:db8:0:0:0:0:0:1")
+	if err != nil {
+		t.Fatalf("Check() returned error: %v", err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("Check() expected no drift, got %v", drifts)
+	}
+
+	drifts, err = v.Check(context.Background(), []string{"example", "other.duckdns.org"}, "10.10.10.1", "")
+	if err != nil {
+		t.Fatalf("Check() returned error: %v", err)
+	}
+	if len(drifts) != 2 {
+		t.Fatalf("Check() expected 2 drifts, got %v", drifts)
+	}
+	if want, got := "example A from udp://"+addr+" is [10.10.10.253], want 10.10.10.1", drifts[0].String(); want != got {
+		t.Errorf("Drift expected to be %q, got %q", want, got)
+	}
+}
+
+func TestCheckMissingRecord(t *testing.T) {
+	addr := startDNSServer(t, map[uint16]string{dns.TypeA: "10.10.10.253"})
+	resolvers, err := duckdns.NewResolvers([]string{addr}, duckdns.ResolverOptions{})
+	if err != nil {
+		t.Fatalf("NewResolvers() returned error: %v", err)
+	}
+	v := &Verifier{Resolvers: resolvers}
+
+	drifts, err := v.Check(context.Background(), []string{"example"}, "", "2001:db8::1")
+	if err != nil {
+		t.Fatalf("Check() returned error: %v", err)
+	}
+	if len(drifts) != 1 || len(drifts[0].Got) != 0 {
+		t.Errorf("Check() expected a drift without records, got %v", drifts)
+	}
+}